@@ -0,0 +1,220 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"GO_LANG_WORKSPACE/internal/journal"
+	"GO_LANG_WORKSPACE/internal/offline"
+	"GO_LANG_WORKSPACE/internal/outbox"
+	"GO_LANG_WORKSPACE/internal/ws"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AdminWSStats godoc
+// @Summary      สถานะ WebSocket hub
+// @Description  ห้องทั้งหมด, client ที่ต่ออยู่ (remote, user agent, token, เวลาเชื่อมต่อ, pong ล่าสุด, sent/dropped) และการปฏิเสธล่าสุด
+// @Tags         admin
+// @Produce      json
+// @Param        X-Admin-Token  header    string  true  "ADMIN_TOKEN"
+// @Success      200            {object}  map[string]interface{}
+// @Failure      401            {object}  map[string]interface{}  "invalid admin token"
+// @Router       /api/admin/ws [get]
+func AdminWSStats(hub *ws.Hub, auth *ws.Authenticator) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{
+			"status":     true,
+			"data":       hub.Stats(),
+			"rejections": auth.Rejections(),
+		})
+	}
+}
+
+// AdminWSKick godoc
+// @Summary      ตัดการเชื่อมต่อ client
+// @Tags         admin
+// @Produce      json
+// @Param        X-Admin-Token  header    string  true  "ADMIN_TOKEN"
+// @Param        id             path      string  true  "client id (จาก GET /api/admin/ws)"
+// @Success      200            {object}  map[string]interface{}
+// @Failure      404            {object}  map[string]interface{}  "client not found"
+// @Router       /api/admin/ws/clients/{id}/kick [post]
+func AdminWSKick(hub *ws.Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+		if !hub.Kick(id) {
+			c.JSON(http.StatusNotFound, gin.H{"status": false, "message": "client not found"})
+			return
+		}
+		log.Printf("[admin] kicked ws client %s from %s", id, c.ClientIP())
+		c.JSON(http.StatusOK, gin.H{"status": true, "message": "kicked"})
+	}
+}
+
+type adminTestMessage struct {
+	Message string `json:"message"`
+}
+
+// AdminWSTest godoc
+// @Summary      ส่งข้อความทดสอบเข้าห้อง
+// @Description  broadcast {"type":"test","message":...} เข้าห้อง (ไว้เช็คว่า kiosk ยังรับข้อความได้)
+// @Tags         admin
+// @Accept       json
+// @Produce      json
+// @Param        X-Admin-Token  header    string            true   "ADMIN_TOKEN"
+// @Param        room           path      string            true   "ชื่อห้อง เช่น gate_out_1"
+// @Param        body           body      adminTestMessage  false  "ข้อความ"
+// @Success      200            {object}  map[string]interface{}
+// @Router       /api/admin/ws/rooms/{room}/test [post]
+func AdminWSTest(hub *ws.Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var in adminTestMessage
+		if err := c.ShouldBindJSON(&in); err != nil && !errors.Is(err, io.EOF) {
+			c.JSON(http.StatusBadRequest, gin.H{"status": false, "message": err.Error()})
+			return
+		}
+		if in.Message == "" {
+			in.Message = "test"
+		}
+		room := c.Param("room")
+		b, _ := json.Marshal(gin.H{
+			"type":       "test",
+			"message":    in.Message,
+			"time_stamp": time.Now().Format(time.RFC3339),
+		})
+		hub.Broadcast(room, b)
+		log.Printf("[admin] test message to %s from %s", room, c.ClientIP())
+		c.JSON(http.StatusOK, gin.H{"status": true, "message": "sent", "room": room})
+	}
+}
+
+// AdminEvents godoc
+// @Summary      ค้น journal ของป้ายทะเบียน
+// @Description  ทุกป้ายที่กล้องส่งมา พร้อม request/response ของ Cloud, ผลสั่งไม้กั้น, LED และเวลาแต่ละขั้น (ใหม่ → เก่า)
+// @Tags         admin
+// @Produce      json
+// @Param        X-Admin-Token  header    string  true   "ADMIN_TOKEN"
+// @Param        plate          query     string  false  "ป้ายทะเบียน (บางส่วนได้)"
+// @Param        gate           query     string  false  "หมายเลขประตู"
+// @Param        route          query     string  false  "gate_in | gate_out | reserve_in | reserve_out | zoning_entrance | zoning_exit"
+// @Param        zoning         query     string  false  "zoning code"
+// @Param        uuid           query     string  false  "uuid ของกล้อง"
+// @Param        from           query     string  false  "RFC3339 หรือ YYYY-MM-DD"
+// @Param        to             query     string  false  "RFC3339 หรือ YYYY-MM-DD (ทั้งวัน)"
+// @Param        limit          query     int     false  "default 100, สูงสุด 1000"
+// @Success      200            {object}  map[string]interface{}
+// @Failure      400            {object}  map[string]interface{}  "invalid time"
+// @Failure      503            {object}  map[string]interface{}  "journal disabled"
+// @Router       /api/admin/events [get]
+func AdminEvents(c *gin.Context) {
+	store := journal.Default()
+	if store == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": false, "message": "journal disabled"})
+		return
+	}
+	f := journal.Filter{
+		Plate:  c.Query("plate"),
+		Gate:   c.Query("gate"),
+		Route:  c.Query("route"),
+		Zoning: c.Query("zoning"),
+		UUID:   c.Query("uuid"),
+	}
+	f.Limit, _ = strconv.Atoi(c.Query("limit"))
+	var err error
+	if f.From, err = parseAdminTime(c.Query("from"), false); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": false, "message": "invalid from: " + err.Error()})
+		return
+	}
+	if f.To, err = parseAdminTime(c.Query("to"), true); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": false, "message": "invalid to: " + err.Error()})
+		return
+	}
+	entries, err := store.Query(f)
+	if err != nil {
+		log.Printf("[admin] journal query: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"status": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": true, "count": len(entries), "data": entries})
+}
+
+// parseAdminTime RFC3339 หรือ YYYY-MM-DD (endOfDay = ถึงสิ้นวันนั้น)
+func parseAdminTime(s string, endOfDay bool) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", s, time.Local)
+	if err != nil {
+		return time.Time{}, errors.New("use RFC3339 or YYYY-MM-DD")
+	}
+	if endOfDay {
+		t = t.Add(24*time.Hour - time.Nanosecond)
+	}
+	return t, nil
+}
+
+// AdminOutbox godoc
+// @Summary      งานที่รอส่ง Cloud (outbox)
+// @Description  สถานะการเชื่อมต่อ, จำนวน/ขนาดงานค้าง, งานที่ Cloud ปฏิเสธ (failed) — ไม่รวม body
+// @Tags         admin
+// @Produce      json
+// @Param        X-Admin-Token  header    string  true   "ADMIN_TOKEN"
+// @Param        limit          query     int     false  "จำนวนรายการสูงสุด (default 200)"
+// @Success      200            {object}  map[string]interface{}
+// @Router       /api/admin/outbox [get]
+func AdminOutbox(c *gin.Context) {
+	limit, err := strconv.Atoi(c.Query("limit"))
+	if err != nil || limit <= 0 {
+		limit = 200
+	}
+	c.JSON(http.StatusOK, gin.H{"status": true, "data": outbox.Default().Stats(limit)})
+}
+
+// AdminOutboxDrain godoc
+// @Summary      ส่งงานค้างใน outbox ทันที
+// @Description  ล้าง backoff ของทุกงานแล้วลองส่งใหม่
+// @Tags         admin
+// @Produce      json
+// @Param        X-Admin-Token  header    string  true  "ADMIN_TOKEN"
+// @Success      200            {object}  map[string]interface{}
+// @Router       /api/admin/outbox/drain [post]
+func AdminOutboxDrain(c *gin.Context) {
+	outbox.Default().Retry()
+	log.Printf("[admin] outbox drain requested from %s", c.ClientIP())
+	c.JSON(http.StatusOK, gin.H{"status": true, "message": "draining"})
+}
+
+// AdminOffline godoc
+// @Summary      สถานะโหมดออฟไลน์
+// @Description  circuit breaker ของ Cloud, จำนวนข้อมูลใน offline cache และเวลา sync ล่าสุด, นโยบายตั้งต้น
+// @Tags         admin
+// @Produce      json
+// @Param        X-Admin-Token  header    string  true  "ADMIN_TOKEN"
+// @Success      200            {object}  map[string]interface{}
+// @Router       /api/admin/offline [get]
+func AdminOffline(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": true, "data": offline.Stats()})
+}
+
+// AdminOfflineSync godoc
+// @Summary      sync offline cache ทันที
+// @Description  ดึงสมาชิก/การจอง/รถที่ชำระแล้วจาก Cloud ใหม่โดยไม่รอรอบ OFFLINE_SYNC_INTERVAL
+// @Tags         admin
+// @Produce      json
+// @Param        X-Admin-Token  header    string  true  "ADMIN_TOKEN"
+// @Success      200            {object}  map[string]interface{}
+// @Router       /api/admin/offline/sync [post]
+func AdminOfflineSync(c *gin.Context) {
+	offline.SyncNow()
+	log.Printf("[admin] offline cache sync requested from %s", c.ClientIP())
+	c.JSON(http.StatusOK, gin.H{"status": true, "message": "syncing"})
+}
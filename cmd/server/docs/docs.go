@@ -18,6 +18,352 @@ const docTemplate = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
+        "/api/admin/events": {
+            "get": {
+                "description": "ทุกป้ายที่กล้องส่งมา พร้อม request/response ของ Cloud, ผลสั่งไม้กั้น, LED และเวลาแต่ละขั้น (ใหม่ → เก่า)",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "ค้น journal ของป้ายทะเบียน",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "ADMIN_TOKEN",
+                        "name": "X-Admin-Token",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "ป้ายทะเบียน (บางส่วนได้)",
+                        "name": "plate",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "หมายเลขประตู",
+                        "name": "gate",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "gate_in | gate_out | reserve_in | reserve_out | zoning_entrance | zoning_exit",
+                        "name": "route",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "zoning code",
+                        "name": "zoning",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "uuid ของกล้อง",
+                        "name": "uuid",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "RFC3339 หรือ YYYY-MM-DD",
+                        "name": "from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "RFC3339 หรือ YYYY-MM-DD (ทั้งวัน)",
+                        "name": "to",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "default 100, สูงสุด 1000",
+                        "name": "limit",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "400": {
+                        "description": "invalid time",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "503": {
+                        "description": "journal disabled",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/api/admin/offline": {
+            "get": {
+                "description": "circuit breaker ของ Cloud, จำนวนข้อมูลใน offline cache และเวลา sync ล่าสุด, นโยบายตั้งต้น",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "สถานะโหมดออฟไลน์",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "ADMIN_TOKEN",
+                        "name": "X-Admin-Token",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/api/admin/offline/sync": {
+            "post": {
+                "description": "ดึงสมาชิก/การจอง/รถที่ชำระแล้วจาก Cloud ใหม่โดยไม่รอรอบ OFFLINE_SYNC_INTERVAL",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "sync offline cache ทันที",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "ADMIN_TOKEN",
+                        "name": "X-Admin-Token",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/api/admin/outbox": {
+            "get": {
+                "description": "สถานะการเชื่อมต่อ, จำนวน/ขนาดงานค้าง, งานที่ Cloud ปฏิเสธ (failed) — ไม่รวม body",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "งานที่รอส่ง Cloud (outbox)",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "ADMIN_TOKEN",
+                        "name": "X-Admin-Token",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "จำนวนรายการสูงสุด (default 200)",
+                        "name": "limit",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/api/admin/outbox/drain": {
+            "post": {
+                "description": "ล้าง backoff ของทุกงานแล้วลองส่งใหม่",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "ส่งงานค้างใน outbox ทันที",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "ADMIN_TOKEN",
+                        "name": "X-Admin-Token",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/api/admin/ws": {
+            "get": {
+                "description": "ห้องทั้งหมด, client ที่ต่ออยู่ (remote, user agent, token, เวลาเชื่อมต่อ, pong ล่าสุด, sent/dropped) และการปฏิเสธล่าสุด",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "สถานะ WebSocket hub",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "ADMIN_TOKEN",
+                        "name": "X-Admin-Token",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "401": {
+                        "description": "invalid admin token",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/api/admin/ws/clients/{id}/kick": {
+            "post": {
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "ตัดการเชื่อมต่อ client",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "ADMIN_TOKEN",
+                        "name": "X-Admin-Token",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "client id (จาก GET /api/admin/ws)",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "404": {
+                        "description": "client not found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/api/admin/ws/rooms/{room}/test": {
+            "post": {
+                "description": "broadcast {\"type\":\"test\",\"message\":...} เข้าห้อง (ไว้เช็คว่า kiosk ยังรับข้อความได้)",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "ส่งข้อความทดสอบเข้าห้อง",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "ADMIN_TOKEN",
+                        "name": "X-Admin-Token",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "ชื่อห้อง เช่น gate_out_1",
+                        "name": "room",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "ข้อความ",
+                        "name": "body",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/main.adminTestMessage"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
         "/api/v2-202402/gate/close-barrier/{direction}/{gate}": {
             "get": {
                 "description": "สั่งปิดไม้กั้นตามทิศทางและหมายเลขประตู\\n\n- direction: ENT (ขาเข้า) หรือ EXT (ขาออก)\\n\n- gate: หมายเลขประตู (ตัวเลขตามระบบ)",
@@ -78,9 +424,203 @@ const docTemplate = `{
                         }
                     }
                 }
+            },
+            "post": {
+                "description": "เหมือน GET close-barrier แต่รับ Idempotency-Key",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "barrier"
+                ],
+                "summary": "ปิดไม้กั้น (POST, idempotent)",
+                "parameters": [
+                    {
+                        "enum": [
+                            "ENT",
+                            "EXT"
+                        ],
+                        "type": "string",
+                        "description": "ทิศทาง",
+                        "name": "direction",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "หมายเลขประตู",
+                        "name": "gate",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "key สำหรับกันคำสั่งซ้ำ",
+                        "name": "Idempotency-Key",
+                        "in": "header"
+                    },
+                    {
+                        "description": "เหตุผล",
+                        "name": "body",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/barrier_v2.CommandRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "closed",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "400": {
+                        "description": "invalid direction/gate",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "404": {
+                        "description": "IP not found for this gate",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "500": {
+                        "description": "modbus error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v2-202402/gate/close-zoning/{direction}/{gate}": {
+            "get": {
+                "description": "สั่งเปิดไม้กั้นตามทิศทางและหมายเลขประตู\\n\n- direction: ENT (ขาเข้า) หรือ EXT (ขาออก)\\n\n- gate: หมายเลขประตู (ตัวเลขตามระบบ)",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "barrier"
+                ],
+                "summary": "ปิดไม้กั้นโซน (Barrier)",
+                "parameters": [
+                    {
+                        "enum": [
+                            "ENT",
+                            "EXT"
+                        ],
+                        "type": "string",
+                        "description": "ทิศทาง",
+                        "name": "direction",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "หมายเลขประตู",
+                        "name": "gate",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "closed",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "400": {
+                        "description": "invalid direction/gate",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "404": {
+                        "description": "IP not found for this gate",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "500": {
+                        "description": "modbus error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            },
+            "post": {
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "barrier"
+                ],
+                "summary": "ปิดไม้กั้นโซน (POST, idempotent)",
+                "parameters": [
+                    {
+                        "enum": [
+                            "ENT",
+                            "EXT"
+                        ],
+                        "type": "string",
+                        "description": "ทิศทาง",
+                        "name": "direction",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "หมายเลขประตู",
+                        "name": "gate",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "key สำหรับกันคำสั่งซ้ำ",
+                        "name": "Idempotency-Key",
+                        "in": "header"
+                    },
+                    {
+                        "description": "เหตุผล",
+                        "name": "body",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/barrier_v2.CommandRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "closed",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
             }
         },
-        "/api/v2-202402/gate/close-zoning/{direction}/{gate}": {
+        "/api/v2-202402/gate/open-barrier/{direction}/{gate}": {
             "get": {
                 "description": "สั่งเปิดไม้กั้นตามทิศทางและหมายเลขประตู\\n\n- direction: ENT (ขาเข้า) หรือ EXT (ขาออก)\\n\n- gate: หมายเลขประตู (ตัวเลขตามระบบ)",
                 "produces": [
@@ -89,7 +629,7 @@ const docTemplate = `{
                 "tags": [
                     "barrier"
                 ],
-                "summary": "ปิดไม้กั้นโซน (Barrier)",
+                "summary": "เปิดไม้กั้น (Barrier)",
                 "parameters": [
                     {
                         "enum": [
@@ -108,11 +648,17 @@ const docTemplate = `{
                         "name": "gate",
                         "in": "path",
                         "required": true
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "เปิดแม้ประตูปิดตามตารางเวลา",
+                        "name": "force",
+                        "in": "query"
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "closed",
+                        "description": "opened",
                         "schema": {
                             "type": "object",
                             "additionalProperties": true
@@ -132,6 +678,13 @@ const docTemplate = `{
                             "additionalProperties": true
                         }
                     },
+                    "409": {
+                        "description": "gate closed by schedule",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
                     "500": {
                         "description": "modbus error",
                         "schema": {
@@ -140,18 +693,19 @@ const docTemplate = `{
                         }
                     }
                 }
-            }
-        },
-        "/api/v2-202402/gate/open-barrier/{direction}/{gate}": {
-            "get": {
-                "description": "สั่งเปิดไม้กั้นตามทิศทางและหมายเลขประตู\\n\n- direction: ENT (ขาเข้า) หรือ EXT (ขาออก)\\n\n- gate: หมายเลขประตู (ตัวเลขตามระบบ)",
+            },
+            "post": {
+                "description": "เหมือน GET open-barrier แต่รับ Idempotency-Key — retry ด้วย key เดิมภายในช่วงเวลาจะได้ผลเดิมโดยไม่สั่งไม้กั้นซ้ำ",
+                "consumes": [
+                    "application/json"
+                ],
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
                     "barrier"
                 ],
-                "summary": "เปิดไม้กั้น (Barrier)",
+                "summary": "เปิดไม้กั้น (POST, idempotent)",
                 "parameters": [
                     {
                         "enum": [
@@ -170,6 +724,20 @@ const docTemplate = `{
                         "name": "gate",
                         "in": "path",
                         "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "key สำหรับกันคำสั่งซ้ำ",
+                        "name": "Idempotency-Key",
+                        "in": "header"
+                    },
+                    {
+                        "description": "เหตุผล",
+                        "name": "body",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/barrier_v2.CommandRequest"
+                        }
                     }
                 ],
                 "responses": {
@@ -194,6 +762,13 @@ const docTemplate = `{
                             "additionalProperties": true
                         }
                     },
+                    "409": {
+                        "description": "gate closed by schedule",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
                     "500": {
                         "description": "modbus error",
                         "schema": {
@@ -232,6 +807,12 @@ const docTemplate = `{
                         "name": "gate",
                         "in": "path",
                         "required": true
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "เปิดแม้ประตูปิดตามตารางเวลา",
+                        "name": "force",
+                        "in": "query"
                     }
                 ],
                 "responses": {
@@ -256,6 +837,13 @@ const docTemplate = `{
                             "additionalProperties": true
                         }
                     },
+                    "409": {
+                        "description": "gate closed by schedule",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
                     "500": {
                         "description": "modbus error",
                         "schema": {
@@ -264,6 +852,159 @@ const docTemplate = `{
                         }
                     }
                 }
+            },
+            "post": {
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "barrier"
+                ],
+                "summary": "เปิดไม้กั้นโซน (POST, idempotent)",
+                "parameters": [
+                    {
+                        "enum": [
+                            "ENT",
+                            "EXT"
+                        ],
+                        "type": "string",
+                        "description": "ทิศทาง",
+                        "name": "direction",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "หมายเลขประตู",
+                        "name": "gate",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "key สำหรับกันคำสั่งซ้ำ",
+                        "name": "Idempotency-Key",
+                        "in": "header"
+                    },
+                    {
+                        "description": "เหตุผล",
+                        "name": "body",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/barrier_v2.CommandRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "opened",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v2-202402/gate/status": {
+            "get": {
+                "description": "รายการไม้กั้นที่ตั้งค่าไว้ พร้อม mode ตามตารางเวลา (normal, free-flow, closed, reservation-only)",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "barrier"
+                ],
+                "summary": "สถานะประตูทั้งหมด",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v3/anpr/{gate_type}/{gate_no}": {
+            "post": {
+                "description": "ส่งเข้า flow เดียวกับกล้อง Hikvision/Dahua ของประตูนั้น — รูปส่งเป็น base64 หรือ URL",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "anpr"
+                ],
+                "summary": "รับป้ายทะเบียนจาก LPR engine (JSON)",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "ANPR_WEBHOOK_TOKEN",
+                        "name": "X-Webhook-Token",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "gate-in | gate-out | reserve-in | reserve-out | zoning-entrance | zoning-exit",
+                        "name": "gate_type",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "หมายเลขประตู",
+                        "name": "gate_no",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "plate event",
+                        "name": "body",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/anpr.WebhookEvent"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "400": {
+                        "description": "validation failed",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "401": {
+                        "description": "invalid webhook token",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "404": {
+                        "description": "unknown gate type",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
             }
         },
         "/healthz": {
@@ -288,6 +1029,140 @@ const docTemplate = `{
                     }
                 }
             }
+        },
+        "/media/{id}": {
+            "get": {
+                "description": "URL ได้จาก field *_url ใน broadcast — หมดอายุตาม MEDIA_TTL",
+                "produces": [
+                    "image/jpeg"
+                ],
+                "tags": [
+                    "media"
+                ],
+                "summary": "รูปจากกล้อง (signed URL)",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "media id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "เวลาหมดอายุ (unix)",
+                        "name": "exp",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "ลายเซ็น",
+                        "name": "sig",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "1 = ภาพย่อ",
+                        "name": "thumb",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    },
+                    "403": {
+                        "description": "invalid or expired signature",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "404": {
+                        "description": "media not found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        }
+    },
+    "definitions": {
+        "anpr.WebhookEvent": {
+            "type": "object",
+            "properties": {
+                "camera_ip": {
+                    "type": "string"
+                },
+                "confidence": {
+                    "description": "0-1 หรือ 0-100",
+                    "type": "number"
+                },
+                "event_id": {
+                    "description": "ใช้เป็น uuid (ไม่ส่ง = สร้างให้)",
+                    "type": "string"
+                },
+                "next_zone": {
+                    "description": "zoning-exit",
+                    "type": "string"
+                },
+                "plate": {
+                    "description": "จำเป็น (\"unknown\" = อ่านไม่ออก)",
+                    "type": "string"
+                },
+                "plate_image": {
+                    "$ref": "#/definitions/anpr.WebhookImage"
+                },
+                "scene_image": {
+                    "$ref": "#/definitions/anpr.WebhookImage"
+                },
+                "timestamp": {
+                    "description": "RFC3339 (ไม่ส่ง = เวลาที่รับ)",
+                    "type": "string"
+                },
+                "vehicle_type": {
+                    "description": "car | truck | motorcycle",
+                    "type": "string"
+                },
+                "zoning_code": {
+                    "description": "จำเป็นสำหรับ zoning-*",
+                    "type": "string"
+                }
+            }
+        },
+        "anpr.WebhookImage": {
+            "type": "object",
+            "properties": {
+                "base64": {
+                    "type": "string"
+                },
+                "url": {
+                    "type": "string"
+                }
+            }
+        },
+        "barrier_v2.CommandRequest": {
+            "type": "object",
+            "properties": {
+                "force": {
+                    "type": "boolean"
+                },
+                "reason": {
+                    "type": "string"
+                }
+            }
+        },
+        "main.adminTestMessage": {
+            "type": "object",
+            "properties": {
+                "message": {
+                    "type": "string"
+                }
+            }
         }
     }
 }`
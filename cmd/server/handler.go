@@ -1,9 +1,14 @@
 package main
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
 	"net"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"GO_LANG_WORKSPACE/internal/ws"
@@ -12,93 +17,192 @@ import (
 	"github.com/gorilla/websocket"
 )
 
-var upgrader = websocket.Upgrader{
-	CheckOrigin: func(r *http.Request) bool {
-		return true // ⚠️ production ควรเช็ค origin
-	},
+const (
+	wsReadWait  = 60 * time.Second
+	wsWriteWait = 10 * time.Second // เพิ่ม timeout สำหรับขาส่ง
+)
+
+func newUpgrader(auth *ws.Authenticator) *websocket.Upgrader {
+	return &websocket.Upgrader{
+		CheckOrigin: auth.CheckOrigin, // WS_ALLOWED_ORIGINS
+	}
 }
 
-func serveGateWS(hub *ws.Hub, prefix string) gin.HandlerFunc {
+func serveGateWS(hub *ws.Hub, auth *ws.Authenticator, kiosk *kioskActions, prefix string) gin.HandlerFunc {
+	upgrader := newUpgrader(auth)
 	return func(c *gin.Context) {
 		gateNo := c.Param("gate_no")
 		group := fmt.Sprintf("%s_%s", prefix, gateNo)
+		serveRoom(c, hub, auth, kiosk, upgrader, group)
+	}
+}
 
-		conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
-		if err != nil {
-			return
-		}
-
-		const readWait = 60 * time.Second
-		const writeWait = 10 * time.Second // เพิ่ม timeout สำหรับขาส่ง
-
-		conn.SetReadDeadline(time.Now().Add(readWait))
+func serveZoningWS(hub *ws.Hub, auth *ws.Authenticator, kiosk *kioskActions, prefix string) gin.HandlerFunc {
+	upgrader := newUpgrader(auth)
+	return func(c *gin.Context) {
+		zoningCode := c.Param("zoning_code")
+		gateNo := c.Param("gate_no")
+		group := fmt.Sprintf("%s:%s:%s", prefix, zoningCode, gateNo)
+		serveRoom(c, hub, auth, kiosk, upgrader, group)
+	}
+}
 
-		conn.SetPingHandler(func(appData string) error {
-			// 1. ยืดเวลาตาย (Read Deadline)
-			conn.SetReadDeadline(time.Now().Add(readWait))
+// serveRoom ตรวจ token → upgrade → เข้าห้อง แล้วอ่านจนกว่า connection จะหลุด
+func serveRoom(c *gin.Context, hub *ws.Hub, auth *ws.Authenticator, kiosk *kioskActions, upgrader *websocket.Upgrader, group string) {
+	tok, err := auth.Authenticate(c.Request, group)
+	if err != nil {
+		status := http.StatusUnauthorized
+		if errors.Is(err, ws.ErrRoomDenied) || errors.Is(err, ws.ErrAuthDisabled) {
+			status = http.StatusForbidden
+		}
+		c.AbortWithStatusJSON(status, gin.H{"status": false, "message": err.Error()})
+		return
+	}
 
-			// 2. ⚠️ เพิ่มบรรทัดนี้: ต้องตอบ Pong กลับไปหา Android ด้วย (ตามกฎ WebSocket)
-			err := conn.WriteControl(websocket.PongMessage, []byte(appData), time.Now().Add(writeWait))
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		return
+	}
 
-			// ถ้าตอบกลับไม่ได้ แสดงว่า Connection มีปัญหา ให้ return error เพื่อจบ Loop
-			if err == websocket.ErrCloseSent {
-				return nil
-			} else if e, ok := err.(net.Error); ok && e.Temporary() {
-				return nil
-			}
-			return err
-		})
+	// ?since=<seq> → resume: ส่งข้อความที่พลาดไประหว่างหลุดจาก buffer
+	info := ws.NewClientInfo("ws", c.Request, tok)
+	var client *ws.Client
+	if since, err := strconv.ParseUint(c.Query("since"), 10, 64); err == nil {
+		client = hub.RegisterSince(group, conn, since, info)
+	} else {
+		client = hub.Register(group, conn, info)
+	}
+	defer hub.Unregister(client)
+	keepAlive(conn, client)
 
-		hub.Register(group, conn)
-		defer hub.Unregister(group, conn)
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			break // ถ้า Error หรือ Connection หลุด ให้ break ออกจาก Loop เพื่อทำลาย connection
+		}
+		conn.SetReadDeadline(time.Now().Add(wsReadWait))
 
-		for {
-			if _, _, err := conn.ReadMessage(); err != nil {
-				break
-			}
+		in, ok := ws.ParseInbound(data)
+		if !ok {
+			continue
+		}
+		switch in.Type {
+		case ws.TypeAck:
+			hub.Ack(client, in.Seq)
+		default:
+			// คำสั่งจาก kiosk ใช้เวลา (modbus/HTTP) → ทำนอก read loop แล้วตอบกลับผ่าน hub
+			go func(in ws.Inbound) {
+				b, _ := json.Marshal(kiosk.handle(group, tok, in))
+				hub.Send(client, b)
+			}(in)
 		}
 	}
 }
 
-func serveZoningWS(hub *ws.Hub, prefix string) gin.HandlerFunc {
+// keepAlive ตั้ง read deadline + ตอบ ping ของ client
+func keepAlive(conn *websocket.Conn, client *ws.Client) {
+	conn.SetReadDeadline(time.Now().Add(wsReadWait))
+
+	// pong ตอบ ping ของ server (ดู WS_PING_INTERVAL) → วัด latency
+	conn.SetPongHandler(func(appData string) error {
+		conn.SetReadDeadline(time.Now().Add(wsReadWait))
+		client.Pong(appData)
+		return nil
+	})
+
+	conn.SetPingHandler(func(appData string) error {
+		// 1. ยืดเวลาตาย (Read Deadline)
+		conn.SetReadDeadline(time.Now().Add(wsReadWait))
+		client.Pong("")
+
+		// 2. ⚠️ เพิ่มบรรทัดนี้: ต้องตอบ Pong กลับไปหา Android ด้วย (ตามกฎ WebSocket)
+		err := conn.WriteControl(websocket.PongMessage, []byte(appData), time.Now().Add(wsWriteWait))
+
+		// ถ้าตอบกลับไม่ได้ แสดงว่า Connection มีปัญหา ให้ return error เพื่อจบ Loop
+		if err == websocket.ErrCloseSent {
+			return nil
+		} else if e, ok := err.(net.Error); ok && e.Temporary() {
+			return nil
+		}
+		return err
+	})
+}
+
+// serveSupervisorWS จอห้องควบคุม: ติดตามหลายห้องใน connection เดียว
+//
+//	GET /supervisor?rooms=gate_out_*,exit:ZN01:*
+//
+// เพิ่ม/ลบห้องระหว่างต่ออยู่ด้วย {"type":"subscribe"|"unsubscribe","rooms":[...]}
+func serveSupervisorWS(hub *ws.Hub, auth *ws.Authenticator) gin.HandlerFunc {
+	upgrader := newUpgrader(auth)
 	return func(c *gin.Context) {
-		zoningCode := c.Param("zoning_code")
-		gateNo := c.Param("gate_no")
-		group := fmt.Sprintf("%s:%s:%s", prefix, zoningCode, gateNo)
+		tok, err := auth.Authenticate(c.Request, "")
+		if err != nil {
+			status := http.StatusUnauthorized
+			if errors.Is(err, ws.ErrAuthDisabled) {
+				status = http.StatusForbidden
+			}
+			c.AbortWithStatusJSON(status, gin.H{"status": false, "message": err.Error()})
+			return
+		}
+		initial := splitRooms(c.Query("rooms"))
 
 		conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
 		if err != nil {
 			return
 		}
-
-		const readWait = 60 * time.Second
-		const writeWait = 10 * time.Second // เพิ่ม timeout สำหรับขาส่ง
-
-		conn.SetReadDeadline(time.Now().Add(readWait))
-
-		conn.SetPingHandler(func(appData string) error {
-			// 1. ยืดเวลาตาย (Read Deadline)
-			conn.SetReadDeadline(time.Now().Add(readWait))
-
-			// 2. ⚠️ เพิ่มบรรทัดนี้: ต้องตอบ Pong กลับไปหา Android ด้วย (ตามกฎ WebSocket)
-			err := conn.WriteControl(websocket.PongMessage, []byte(appData), time.Now().Add(writeWait))
-
-			// ถ้าตอบกลับไม่ได้ แสดงว่า Connection มีปัญหา ให้ return error เพื่อจบ Loop
-			if err == websocket.ErrCloseSent {
-				return nil
-			} else if e, ok := err.(net.Error); ok && e.Temporary() {
-				return nil
+		client := hub.Watch(conn, tok.Allows, ws.NewClientInfo("supervisor", c.Request, tok))
+		defer hub.Unregister(client)
+		keepAlive(conn, client)
+		if len(initial) > 0 {
+			if _, err := hub.SetPatterns(client, initial, nil); err != nil {
+				b, _ := json.Marshal(ws.NewResponse(ws.Inbound{Type: ws.TypeSubscribe}, false, err.Error(), nil))
+				hub.Send(client, b)
 			}
-			return err
-		})
-
-		hub.Register(group, conn)
-		defer hub.Unregister(group, conn)
+		}
+		log.Printf("[WS] supervisor joined token=%s rooms=%v", tok.Name, initial)
 
 		for {
-			if _, _, err := conn.ReadMessage(); err != nil {
-				break // ถ้า Error หรือ Connection หลุด ให้ break ออกจาก Loop เพื่อทำลาย connection
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				break
 			}
+			conn.SetReadDeadline(time.Now().Add(wsReadWait))
+
+			in, ok := ws.ParseInbound(data)
+			if !ok {
+				continue
+			}
+			var res ws.Response
+			switch in.Type {
+			case ws.TypeAck:
+				continue // seq เป็นของแต่ละห้อง supervisor ไม่ต้อง ack
+			case ws.TypeSubscribe, ws.TypeUnsubscribe:
+				add, remove := in.Rooms, []string(nil)
+				if in.Type == ws.TypeUnsubscribe {
+					add, remove = nil, in.Rooms
+				}
+				rooms, err := hub.SetPatterns(client, add, remove)
+				if err != nil {
+					res = ws.NewResponse(in, false, err.Error(), nil)
+				} else {
+					res = ws.NewResponse(in, true, "ok", gin.H{"rooms": rooms})
+				}
+			default:
+				res = ws.NewResponse(in, false, "unsupported on supervisor connection", nil)
+			}
+			b, _ := json.Marshal(res)
+			hub.Send(client, b)
+		}
+	}
+}
+
+func splitRooms(s string) []string {
+	var out []string
+	for _, r := range strings.Split(s, ",") {
+		if r = strings.TrimSpace(r); r != "" {
+			out = append(out, r)
 		}
 	}
+	return out
 }
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"GO_LANG_WORKSPACE/internal/barrier_v2"
+	"GO_LANG_WORKSPACE/internal/config"
+	"GO_LANG_WORKSPACE/internal/events"
+	"GO_LANG_WORKSPACE/internal/utils"
+	"GO_LANG_WORKSPACE/internal/ws"
+)
+
+// kioskActions คำสั่งที่ kiosk / แท็บเล็ตพนักงานส่งมาทาง WebSocket ของห้องประตู
+type kioskActions struct {
+	cfg        *config.Config
+	hub        *ws.Hub
+	events     *events.Publisher
+	httpClient *http.Client
+}
+
+func newKioskActions(cfg *config.Config, hub *ws.Hub) *kioskActions {
+	return &kioskActions{
+		cfg:    cfg,
+		hub:    hub,
+		events: events.NewPublisher(hub),
+		httpClient: &http.Client{
+			Timeout:   6 * time.Second,
+			Transport: config.NewHTTPTransport(),
+		},
+	}
+}
+
+// handle ทำคำสั่งหนึ่งรายการ แล้วคืน response (caller เป็นคนส่งกลับ)
+func (k *kioskActions) handle(room string, tok *ws.Token, in ws.Inbound) ws.Response {
+	if !tok.Can(in.Type) {
+		log.Printf("[kiosk] denied %s for token=%s room=%s", in.Type, tok.Name, room)
+		return ws.NewResponse(in, false, "permission denied", nil)
+	}
+	info, ok := ws.ParseRoom(room)
+	if !ok {
+		return ws.NewResponse(in, false, "room is not bound to a gate", nil)
+	}
+	log.Printf("[kiosk] %s token=%s room=%s request_id=%s", in.Type, tok.Name, room, in.RequestID)
+
+	switch in.Type {
+	case ws.TypeOpenBarrier, ws.TypeCloseBarrier:
+		return k.barrier(info, tok, in)
+	case ws.TypePlateCorrection:
+		return k.plateCorrection(info, tok, in)
+	case ws.TypeSnapshotRequest:
+		return k.snapshot(info, in)
+	case ws.TypeClearLED:
+		return k.clearLED(info, in)
+	default:
+		return ws.NewResponse(in, false, "unknown message type", nil)
+	}
+}
+
+func (k *kioskActions) barrier(info ws.RoomInfo, tok *ws.Token, in ws.Inbound) ws.Response {
+	action := "open"
+	if in.Type == ws.TypeCloseBarrier {
+		action = "close"
+	}
+	reason := fmt.Sprintf("ws:%s %s", tok.Name, in.Reason)
+	res, err := barrier_v2.Execute(action, info.Location, info.Direction, info.Gate, strings.TrimSpace(reason))
+	if err != nil {
+		return ws.NewResponse(in, false, err.Error(), res)
+	}
+	return ws.NewResponse(in, true, res.Result, res)
+}
+
+func (k *kioskActions) plateCorrection(info ws.RoomInfo, tok *ws.Token, in ws.Inbound) ws.Response {
+	plate := strings.TrimSpace(in.Plate)
+	if plate == "" {
+		return ws.NewResponse(in, false, "plate is required", nil)
+	}
+
+	body := map[string]any{
+		"license_plate":          plate,
+		"original_license_plate": in.OriginalPlate,
+		"uuid":                   in.UUID,
+		"park_code":              k.cfg.ParkingCode,
+		"zoning_code":            info.Zoning,
+		"gate":                   strings.ToLower(info.Direction),
+		"gate_no":                info.Gate,
+		"corrected_by":           tok.Name,
+		"time_stamp":             time.Now().Format(time.RFC3339),
+	}
+	path := os.Getenv("PLATE_CORRECTION_PATH")
+	if path == "" {
+		path = "/api/v1-202402/order/plate-correction"
+	}
+	url := strings.TrimRight(k.cfg.ServerURL, "/") + path
+	res, err := k.postJSON(url, body)
+	if err != nil {
+		log.Printf("[kiosk] plate correction %s → %s failed: %v", in.OriginalPlate, plate, err)
+		return ws.NewResponse(in, false, err.Error(), res)
+	}
+	// Cloud ตอบ 200 แต่ status=false (เช่น หา transaction ไม่เจอ) → ไม่แจ้งจออื่น
+	if ok, _ := res["status"].(bool); !ok {
+		msg, _ := res["message"].(string)
+		if msg == "" {
+			msg = "plate correction rejected"
+		}
+		return ws.NewResponse(in, false, msg, res)
+	}
+
+	// แจ้งทุกจอในห้องว่ามีการแก้ป้าย
+	corrected := events.PlateCorrected{
+		LicensePlate:  plate,
+		OriginalPlate: in.OriginalPlate,
+		UUID:          in.UUID,
+		CorrectedBy:   tok.Name,
+	}
+	k.events.Publish(events.New(events.TypePlateCorrected, info.Room, info.Gate, info.Direction, in.RequestID, corrected), map[string]any{
+		"type":           "plate_corrected",
+		"license_plate":  plate,
+		"original_plate": in.OriginalPlate,
+		"uuid":           in.UUID,
+		"corrected_by":   tok.Name,
+	})
+
+	return ws.NewResponse(in, true, "corrected", res)
+}
+
+func (k *kioskActions) snapshot(info ws.RoomInfo, in ws.Inbound) ws.Response {
+	var (
+		b64 string
+		err error
+	)
+	if info.Direction == "ENT" {
+		b64, err = utils.FetchLicensePlateEntranceImage(k.cfg, info.Gate)
+	} else {
+		b64, err = utils.FetchLicensePlateExitImage(k.cfg, info.Gate)
+	}
+	if err != nil {
+		return ws.NewResponse(in, false, err.Error(), nil)
+	}
+	return ws.NewResponse(in, true, "ok", map[string]any{"license_plate_img_base64": b64})
+}
+
+func (k *kioskActions) clearLED(info ws.RoomInfo, in ws.Inbound) ws.Response {
+	gateNo, err := strconv.Atoi(info.Gate)
+	if err != nil {
+		return ws.NewResponse(in, false, "invalid gate number", nil)
+	}
+
+	board := "MAIN"
+	if info.Location == "ZONE" {
+		board = "ZONE"
+	}
+	envKey := fmt.Sprintf("HIK_LED_%s_%s_%02d", board, info.Direction, gateNo)
+	ip, ok := os.LookupEnv(envKey)
+	if !ok || ip == "" {
+		return ws.NewResponse(in, false, fmt.Sprintf("%s not configured", envKey), nil)
+	}
+
+	if err := utils.DisplayHexData(ip, 9999, "", strings.ToLower(info.Direction), "clear", ""); err != nil {
+		return ws.NewResponse(in, false, err.Error(), nil)
+	}
+	return ws.NewResponse(in, true, "cleared", nil)
+}
+
+func (k *kioskActions) postJSON(url string, body map[string]any) (map[string]any, error) {
+	b, _ := json.Marshal(body)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(b))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := k.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	out := map[string]any{}
+	decodeErr := json.NewDecoder(resp.Body).Decode(&out)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return out, fmt.Errorf("cloud returned HTTP %d", resp.StatusCode)
+	}
+	if decodeErr != nil {
+		return nil, fmt.Errorf("invalid cloud response: %w", decodeErr)
+	}
+	return out, nil
+}
@@ -11,10 +11,15 @@ import (
 	"time"
 
 	mqttsvc "GO_LANG_WORKSPACE/cmd/server/mqtt"
+	"GO_LANG_WORKSPACE/internal/anpr"
 	"GO_LANG_WORKSPACE/internal/barrier_v2"
+	"GO_LANG_WORKSPACE/internal/capture"
 	"GO_LANG_WORKSPACE/internal/config"
 	"GO_LANG_WORKSPACE/internal/image_v2"
+	"GO_LANG_WORKSPACE/internal/media"
+	"GO_LANG_WORKSPACE/internal/offline"
 	"GO_LANG_WORKSPACE/internal/order"
+	"GO_LANG_WORKSPACE/internal/outbox"
 	"GO_LANG_WORKSPACE/internal/reserve"
 	"GO_LANG_WORKSPACE/internal/ws"
 	zoningpkg "GO_LANG_WORKSPACE/internal/zoning"
@@ -49,6 +54,12 @@ func Healthz(c *gin.Context) {
 // @BasePath        /
 // @schemes         http
 func main() {
+	// ---------- Subcommands ----------
+	//   server replay [flags] <file|dir> ...   ส่ง request ของกล้องที่ capture ไว้ซ้ำ (ดู internal/capture)
+	if len(os.Args) > 1 && os.Args[1] == "replay" {
+		os.Exit(capture.ReplayMain(os.Args[2:]))
+	}
+
 	// ---------- .env ----------
 	// ลองโหลด .env จากหลายที่เพื่อรองรับทั้ง direct run และ air
 	cwd, _ := os.Getwd()
@@ -87,9 +98,18 @@ func main() {
 		}
 	}()
 
+	// ---------- Outbox (ส่งงานที่ค้างจากรอบก่อนต่อ) ----------
+	outbox.Default()
+
+	// ---------- Gate schedules ----------
+	go barrier_v2.RunScheduler(ctx)
+
 	// ---------- WebSocket hub ----------
 	hub := ws.NewHub()
 	go hub.Run()
+	wsAuth := ws.NewAuthenticatorFromEnv()
+	kiosk := newKioskActions(cfg, hub)
+	anpr.SetBroadcaster(hub)
 
 	// ---------- Gin ----------
 	gin.SetMode(gin.ReleaseMode)
@@ -103,13 +123,29 @@ func main() {
 	// ---------- Health ----------
 	r.GET("/healthz", Healthz)
 
+	// ---------- Media (รูปแบบ signed URL แทน base64 ใน broadcast) ----------
+	r.GET("/media/:id", media.Serve)
+
 	// ---------- WebSocket rooms ----------
-	r.GET("/gate-in/:gate_no", serveGateWS(hub, "gate_in"))
-	r.GET("/reserve-in/:gate_no", serveGateWS(hub, "reserve_in"))
-	r.GET("/reserve-out/:gate_no", serveGateWS(hub, "reserve_out"))
-	r.GET("/gate-out/:gate_no", serveGateWS(hub, "gate_out"))
-	r.GET("/zoning/entrance/:zoning_code/:gate_no", serveZoningWS(hub, "entrance"))
-	r.GET("/zoning/exit/:zoning_code/:gate_no", serveZoningWS(hub, "exit"))
+	r.GET("/gate-in/:gate_no", serveGateWS(hub, wsAuth, kiosk, "gate_in"))
+	r.GET("/reserve-in/:gate_no", serveGateWS(hub, wsAuth, kiosk, "reserve_in"))
+	r.GET("/reserve-out/:gate_no", serveGateWS(hub, wsAuth, kiosk, "reserve_out"))
+	r.GET("/gate-out/:gate_no", serveGateWS(hub, wsAuth, kiosk, "gate_out"))
+	r.GET("/zoning/entrance/:zoning_code/:gate_no", serveZoningWS(hub, wsAuth, kiosk, "entrance"))
+	r.GET("/zoning/exit/:zoning_code/:gate_no", serveZoningWS(hub, wsAuth, kiosk, "exit"))
+	r.GET("/supervisor", serveSupervisorWS(hub, wsAuth))
+
+	// ---------- Server-Sent Events (ห้องเดียวกับ WebSocket) ----------
+	events := r.Group("/events")
+	{
+		events.GET("/:room", serveSSERoom(hub, wsAuth))
+		events.GET("/gate-in/:gate_no", serveSSEGate(hub, wsAuth, "gate_in"))
+		events.GET("/reserve-in/:gate_no", serveSSEGate(hub, wsAuth, "reserve_in"))
+		events.GET("/reserve-out/:gate_no", serveSSEGate(hub, wsAuth, "reserve_out"))
+		events.GET("/gate-out/:gate_no", serveSSEGate(hub, wsAuth, "gate_out"))
+		events.GET("/zoning/entrance/:zoning_code/:gate_no", serveSSEZoning(hub, wsAuth, "entrance"))
+		events.GET("/zoning/exit/:zoning_code/:gate_no", serveSSEZoning(hub, wsAuth, "exit"))
+	}
 
 	// ---------- API group ----------
 	api := r.Group("/api")
@@ -118,41 +154,71 @@ func main() {
 		{
 			// Order
 			Order := order.NewHandler(cfg, hub)
+			anpr.Register(Order.Routes()...)
 			orderGroup := v1.Group("/order")
 			{
-				orderGroup.POST("/verify-member", Order.VerifyMember)
-				orderGroup.POST("/verify-license-plate-out", Order.VerifyLicensePlateOut)
+				orderGroup.POST("/verify-member", anpr.Handler("gate_in"))
+				orderGroup.POST("/verify-license-plate-out", anpr.Handler("gate_out"))
 			}
 
 			// Reserve
 			Reserve := reserve.NewHandler(cfg, hub)
+			anpr.Register(Reserve.Routes()...)
 			reserveGroup := v1.Group("/reserve")
 			{
-				reserveGroup.POST("/entrance", Reserve.VerifyReserve)
-				reserveGroup.POST("/exit", Reserve.VerifyReserveExit)
+				reserveGroup.POST("/entrance", anpr.Handler("reserve_in"))
+				reserveGroup.POST("/exit", anpr.Handler("reserve_out"))
 			}
 
 			// Barrier
 			gateGroup := v1.Group("/gate")
 			{
-				gateGroup.GET("/open-barrier/:direction/:gate", barrier_v2.OpenBarrier)
-				gateGroup.GET("/close-barrier/:direction/:gate", barrier_v2.CloseBarrier)
-				gateGroup.GET("/open-zoning/:direction/:gate", barrier_v2.OpenZoning)
-				gateGroup.GET("/close-zoning/:direction/:gate", barrier_v2.CloseZoning)
+				// GET เดิม (deprecated — ดู BARRIER_GET_MODE)
+				gateGroup.GET("/open-barrier/:direction/:gate", barrier_v2.DeprecatedGET(), barrier_v2.OpenBarrier)
+				gateGroup.GET("/close-barrier/:direction/:gate", barrier_v2.DeprecatedGET(), barrier_v2.CloseBarrier)
+				gateGroup.GET("/open-zoning/:direction/:gate", barrier_v2.DeprecatedGET(), barrier_v2.OpenZoning)
+				gateGroup.GET("/close-zoning/:direction/:gate", barrier_v2.DeprecatedGET(), barrier_v2.CloseZoning)
+
+				// POST (Idempotency-Key)
+				gateGroup.POST("/open-barrier/:direction/:gate", barrier_v2.OpenBarrierCommand)
+				gateGroup.POST("/close-barrier/:direction/:gate", barrier_v2.CloseBarrierCommand)
+				gateGroup.POST("/open-zoning/:direction/:gate", barrier_v2.OpenZoningCommand)
+				gateGroup.POST("/close-zoning/:direction/:gate", barrier_v2.CloseZoningCommand)
+				gateGroup.GET("/status", barrier_v2.GateStatus)
 			}
 
 			// Zoning
 			zn := zoningpkg.NewHandler(cfg, hub)
+			anpr.Register(zn.Routes()...)
 			routeZoning := v1.Group("/zoning")
 			{
-				routeZoning.POST("/entrance/:zoning_code", zn.ZoningEntrance)
-				routeZoning.POST("/exit/:zoning_code", zn.ZoningExit)
+				routeZoning.POST("/entrance/:zoning_code", anpr.Handler("zoning_entrance"))
+				routeZoning.POST("/exit/:zoning_code", anpr.Handler("zoning_exit"))
 				routeZoning.GET("/exit/:zoning_code", func(c *gin.Context) {
 					c.JSON(http.StatusOK, gin.H{"ok": true})
 				})
 			}
 		}
 
+		// ANPR webhook (JSON จาก LPR engine — flow เดียวกับกล้อง, ANPR_WEBHOOK_TOKEN)
+		v3 := api.Group("/v3", config.WebhookAuthMiddleware())
+		{
+			v3.POST("/anpr/:gate_type/:gate_no", anpr.Webhook)
+		}
+
+		// Admin (ADMIN_TOKEN)
+		admin := api.Group("/admin", config.AdminAuthMiddleware())
+		{
+			admin.GET("/ws", AdminWSStats(hub, wsAuth))
+			admin.POST("/ws/clients/:id/kick", AdminWSKick(hub))
+			admin.POST("/ws/rooms/:room/test", AdminWSTest(hub))
+			admin.GET("/events", AdminEvents)
+			admin.GET("/outbox", AdminOutbox)
+			admin.POST("/outbox/drain", AdminOutboxDrain)
+			admin.GET("/offline", AdminOffline)
+			admin.POST("/offline/sync", AdminOfflineSync)
+		}
+
 		// Image v2 (อยู่นอก v2-202402 ตามของเดิม)
 		v2img := api.Group("/v2-202401/image")
 		{
@@ -168,6 +234,12 @@ func main() {
 		log.Printf("[route] %s %s", rt.Method, rt.Path)
 	}
 
+	// ---------- ANPR workers (ANPR_ASYNC: ทำ event ที่ค้างใน spool ต่อ) ----------
+	anpr.StartWorkers(ctx)
+
+	// ---------- Offline cache (สมาชิก/การจอง/รถชำระแล้ว ไว้ตัดสินตอน Cloud ไม่ตอบ) ----------
+	offline.Start(ctx, cfg.ServerURL, cfg.ParkingCode)
+
 	// ---------- HTTP server (timeouts + graceful shutdown) ----------
 	srv := &http.Server{
 		Addr:              ":8000",
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"GO_LANG_WORKSPACE/internal/ws"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ---------- Server-Sent Events ----------
+//
+// สำหรับ dashboard ที่อยู่หลัง proxy ที่ตัด WebSocket — ข้อความชุดเดียวกับห้อง WebSocket
+//   GET /events/:room                                 (เช่น gate_out_1, exit:ZN01:1)
+//   GET /events/gate-in/:gate_no ... /events/zoning/exit/:zoning_code/:gate_no
+// token ใช้ตัวเดียวกับ WebSocket (EventSource ตั้ง header ไม่ได้ → ส่ง ?token=...)
+// resume: header Last-Event-ID (browser ส่งเองตอน reconnect) หรือ ?since=<seq>
+
+const (
+	sseKeepAlive = 15 * time.Second
+	sseWriteWait = 10 * time.Second
+)
+
+func serveSSERoom(hub *ws.Hub, auth *ws.Authenticator) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		serveSSE(c, hub, auth, c.Param("room"))
+	}
+}
+
+func serveSSEGate(hub *ws.Hub, auth *ws.Authenticator, prefix string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		serveSSE(c, hub, auth, fmt.Sprintf("%s_%s", prefix, c.Param("gate_no")))
+	}
+}
+
+func serveSSEZoning(hub *ws.Hub, auth *ws.Authenticator, prefix string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		serveSSE(c, hub, auth, fmt.Sprintf("%s:%s:%s", prefix, c.Param("zoning_code"), c.Param("gate_no")))
+	}
+}
+
+func serveSSE(c *gin.Context, hub *ws.Hub, auth *ws.Authenticator, group string) {
+	if !auth.CheckOrigin(c.Request) {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"status": false, "message": "origin not allowed"})
+		return
+	}
+	tok, err := auth.Authenticate(c.Request, group)
+	if err != nil {
+		status := http.StatusUnauthorized
+		if errors.Is(err, ws.ErrRoomDenied) || errors.Is(err, ws.ErrAuthDisabled) {
+			status = http.StatusForbidden
+		}
+		c.AbortWithStatusJSON(status, gin.H{"status": false, "message": err.Error()})
+		return
+	}
+
+	since := int64(-1)
+	lastID := c.GetHeader("Last-Event-ID")
+	if lastID == "" {
+		lastID = c.Query("since")
+	}
+	if n, err := strconv.ParseUint(strings.TrimSpace(lastID), 10, 64); err == nil {
+		since = int64(n)
+	}
+
+	w := c.Writer
+	rc := http.NewResponseController(w)
+	h := w.Header()
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("Cache-Control", "no-cache")
+	h.Set("Connection", "keep-alive")
+	h.Set("X-Accel-Buffering", "no") // nginx: ห้าม buffer
+	w.WriteHeader(http.StatusOK)
+
+	client := hub.Subscribe(group, since, ws.NewClientInfo("sse", c.Request, tok))
+	defer hub.Unregister(client)
+	log.Printf("[SSE] client joined %s since=%d remote=%s", group, since, c.ClientIP())
+
+	// บอก browser ให้รอ 3 วิ ก่อน reconnect
+	if !sseWrite(w, rc, "retry: 3000\n\n") {
+		return
+	}
+
+	ticker := time.NewTicker(sseKeepAlive)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case <-client.Done():
+			return
+		case m := <-client.Messages():
+			if !sseWrite(w, rc, sseFrame(m)) {
+				return
+			}
+			client.Delivered()
+		case <-ticker.C:
+			if !sseWrite(w, rc, ": ping\n\n") {
+				return
+			}
+		}
+	}
+}
+
+// sseFrame แปลงข้อความของ hub เป็น event (id = seq ของห้อง ใช้กับ Last-Event-ID)
+func sseFrame(m ws.Outbound) string {
+	var b strings.Builder
+	if m.Seq > 0 {
+		fmt.Fprintf(&b, "id: %d\n", m.Seq)
+	}
+	for _, line := range strings.Split(string(m.Data), "\n") {
+		b.WriteString("data: ")
+		b.WriteString(line)
+		b.WriteString("\n")
+	}
+	b.WriteString("\n")
+	return b.String()
+}
+
+// sseWrite เขียน + flush พร้อม deadline ต่อครั้ง (WriteTimeout ของ server ใช้กับ stream ยาวไม่ได้)
+func sseWrite(w gin.ResponseWriter, rc *http.ResponseController, s string) bool {
+	_ = rc.SetWriteDeadline(time.Now().Add(sseWriteWait))
+	if _, err := w.WriteString(s); err != nil {
+		return false
+	}
+	w.Flush()
+	return true
+}
@@ -0,0 +1,50 @@
+package anpr
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+)
+
+// ---------- Minimum confidence ----------
+//
+// ป้ายที่กล้องมั่นใจต่ำกว่าเกณฑ์ถือว่าอ่านไม่ออก (Plate = "unknown") — ไม่ถาม Cloud / ไม่เปิดไม้กั้นด้วยป้ายที่อาจผิด
+// ป้ายที่อ่านได้เก็บไว้ใน RawPlate และ ev.LowConfidence = true
+// กล้องที่ไม่ส่ง confidence มา (0) ไม่ถูกตัด
+//
+// ENV:
+//   ANPR_MIN_CONFIDENCE=0                                          ค่าเริ่มต้นทุกประตู (0-100, 0 = ปิด)
+//   ANPR_MIN_CONFIDENCE_<ENT|EXT>_<GATE|RESE|ZONE>_<NN>=80         ทับรายประตู เช่น ANPR_MIN_CONFIDENCE_EXT_GATE_01
+
+func minConfidence(route Route, gateNo string) float64 {
+	for _, key := range []string{
+		fmt.Sprintf("ANPR_MIN_CONFIDENCE_%s_%s_%02s", route.Direction, route.Location, gateNo),
+		"ANPR_MIN_CONFIDENCE",
+	} {
+		v := os.Getenv(key)
+		if v == "" {
+			continue
+		}
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			return f
+		}
+		log.Printf("[anpr] invalid %s=%q", key, v)
+	}
+	return 0
+}
+
+// checkConfidence เปลี่ยนป้ายเป็น unknown ถ้า confidence ต่ำกว่าเกณฑ์ของประตู
+func checkConfidence(route Route, ev *PlateEvent) {
+	if ev.Unknown() || ev.Meta.Confidence <= 0 {
+		return
+	}
+	threshold := minConfidence(route, ev.GateNo)
+	if threshold <= 0 || ev.Meta.Confidence >= threshold {
+		return
+	}
+	log.Printf("[anpr] %s gate=%s plate=%s confidence %.0f below %.0f — treated as unknown",
+		route.Name, ev.GateNo, ev.Plate, ev.Meta.Confidence, threshold)
+	ev.LowConfidence = true
+	ev.Plate, ev.Province, ev.Candidates = "unknown", "", nil
+}
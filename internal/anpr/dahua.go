@@ -0,0 +1,173 @@
+package anpr
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"GO_LANG_WORKSPACE/internal/events"
+)
+
+// ---------- Dahua ITC (traffic snap upload, JSON / multipart) ----------
+//
+// ตัวอย่าง JSON:
+//   {"Picture":{"Plate":{"PlateNumber":"กข1234","PlateColor":"White","Confidence":92,"BoundingBox":[120,340,260,390]},
+//     "SnapInfo":{"DeviceID":"ITC-01","SnapTime":"2026-10-18 10:00:00","Direction":"Approach"},
+//     "Vehicle":{"VehicleType":"SaloonCar","VehicleColor":"Black","VehicleSign":"Toyota"},
+//     "CutoutPic":{"Content":"<base64>"},"NormalPic":{"Content":"<base64>"}}}
+//
+// multipart: part JSON ตามด้านบน + รูปเป็นไฟล์แยก (ชื่อมี plate/cutout = รูปป้าย, jpg อื่น = รูปรถ)
+
+type dahuaPic struct {
+	Content string `json:"Content"` // base64 (ว่างเมื่อส่งรูปเป็นไฟล์แยก)
+	PicName string `json:"PicName"`
+}
+
+type dahuaEvent struct {
+	Picture struct {
+		Plate struct {
+			PlateNumber string    `json:"PlateNumber"`
+			PlateColor  string    `json:"PlateColor"`
+			PlateType   string    `json:"PlateType"`
+			Country     string    `json:"Country"`
+			Confidence  float64   `json:"Confidence"`
+			BoundingBox []float64 `json:"BoundingBox"` // [left, top, right, bottom]
+		} `json:"Plate"`
+		SnapInfo struct {
+			DeviceID  string `json:"DeviceID"`
+			SnapTime  string `json:"SnapTime"`
+			IPAddress string `json:"IPAddress"`
+			UUID      string `json:"UUID"`
+			Direction string `json:"Direction"`
+		} `json:"SnapInfo"`
+		Vehicle struct {
+			VehicleType  string `json:"VehicleType"`
+			VehicleColor string `json:"VehicleColor"`
+			VehicleSign  string `json:"VehicleSign"` // ยี่ห้อ
+			VehicleModel string `json:"VehicleSeries"`
+		} `json:"Vehicle"`
+		CutoutPic  dahuaPic `json:"CutoutPic"`
+		NormalPic  dahuaPic `json:"NormalPic"`
+		VehiclePic dahuaPic `json:"VehiclePic"`
+	} `json:"Picture"`
+}
+
+// ป้ายที่ Dahua ส่งมาเมื่ออ่านไม่ออก → "unknown" แบบเดียวกับ Hikvision
+var dahuaNoPlate = map[string]bool{"": true, "unknown": true, "无车牌": true, "noplate": true}
+
+// finishDahua แปลง JSON ของ Dahua (+ รูปจาก multipart ถ้ามี) เป็น PlateEvent
+func finishDahua(ev *PlateEvent, r *http.Request, body []byte, parts []part) (*PlateEvent, error) {
+	ev.Source = "dahua"
+	ev.Raw = body
+
+	var d dahuaEvent
+	if err := json.Unmarshal(body, &d); err != nil {
+		return nil, Reject(http.StatusOK, "Failed to parse JSON")
+	}
+	p := d.Picture
+
+	ev.Plate = strings.TrimSpace(p.Plate.PlateNumber)
+	if dahuaNoPlate[strings.ToLower(ev.Plate)] {
+		ev.Plate = "unknown"
+	}
+	ev.DateTime = dahuaTime(p.SnapInfo.SnapTime)
+	ev.CameraIP = strings.TrimSpace(p.SnapInfo.IPAddress)
+	if ev.CameraIP == "" {
+		ev.CameraIP = remoteIP(r)
+	}
+	ev.UUID = strings.TrimSpace(p.SnapInfo.UUID)
+	if ev.UUID == "" {
+		ev.UUID = dahuaEventID(p.SnapInfo.DeviceID, ev.CameraIP, p.SnapInfo.SnapTime, p.Plate.PlateNumber)
+	}
+	ev.VehicleType = dahuaVehicleType(p.Vehicle.VehicleType)
+	ev.Meta = events.PlateMeta{
+		Confidence:   p.Plate.Confidence,
+		PlateColor:   known(p.Plate.PlateColor),
+		PlateType:    known(p.Plate.PlateType),
+		Country:      known(p.Plate.Country),
+		Direction:    known(p.SnapInfo.Direction),
+		VehicleColor: known(p.Vehicle.VehicleColor),
+		VehicleBrand: known(p.Vehicle.VehicleSign),
+		VehicleModel: known(p.Vehicle.VehicleModel),
+	}
+	if bb := p.Plate.BoundingBox; len(bb) == 4 && bb[2] > bb[0] && bb[3] > bb[1] {
+		ev.Meta.PlateRect = &events.Rect{X: bb[0], Y: bb[1], Width: bb[2] - bb[0], Height: bb[3] - bb[1]}
+	}
+
+	ev.PlateImage = decodePic(p.CutoutPic)
+	ev.SceneImage = decodePic(p.NormalPic)
+	if ev.SceneImage == nil {
+		ev.SceneImage = decodePic(p.VehiclePic)
+	}
+	for _, pt := range parts {
+		if !isImagePart(pt) {
+			continue
+		}
+		name := strings.ToLower(pt.name + " " + pt.fileName)
+		switch {
+		case strings.Contains(name, "plate") || strings.Contains(name, "cutout"):
+			if ev.PlateImage == nil {
+				ev.PlateImage = pt.data
+			}
+		default:
+			if ev.SceneImage == nil {
+				ev.SceneImage = pt.data
+			}
+		}
+	}
+	ev.Mark("Parse JSON")
+	return ev, nil
+}
+
+// dahuaEventID Dahua ไม่มี UUID ของ event — สร้างจากฟิลด์ของกล้องเอง (อุปกรณ์ + SnapTime + ป้าย)
+// กล้องส่งซ้ำ (retransmit) ได้ id เดิม → dedup จับได้แม้ป้ายเป็น unknown; ไม่มี SnapTime ใช้ id สุ่ม
+func dahuaEventID(deviceID, ip, snapTime, plateNumber string) string {
+	snapTime = strings.TrimSpace(snapTime)
+	if snapTime == "" {
+		return uuid.NewString()
+	}
+	device := strings.TrimSpace(deviceID)
+	if device == "" {
+		device = ip
+	}
+	return uuid.NewSHA1(uuid.NameSpaceOID, []byte("dahua|"+device+"|"+snapTime+"|"+strings.TrimSpace(plateNumber))).String()
+}
+
+func decodePic(p dahuaPic) []byte {
+	if p.Content == "" {
+		return nil
+	}
+	b, err := base64.StdEncoding.DecodeString(p.Content)
+	if err != nil || len(b) == 0 {
+		return nil
+	}
+	return b
+}
+
+// dahuaTime "2026-10-18 10:00:00" (เวลาท้องถิ่นของกล้อง) → RFC3339 แบบ dateTime ของ Hikvision
+func dahuaTime(s string) string {
+	s = strings.TrimSpace(s)
+	if t, err := time.ParseInLocation("2006-01-02 15:04:05", s, time.Local); err == nil {
+		return t.Format(time.RFC3339)
+	}
+	return s
+}
+
+// dahuaVehicleType แปลงชนิดรถของ Dahua เป็นคำของ Hikvision (ที่ utils.VehicleType รู้จัก)
+func dahuaVehicleType(s string) string {
+	t := strings.ToLower(strings.TrimSpace(s))
+	switch {
+	case strings.Contains(t, "motor") && !strings.HasPrefix(t, "non"):
+		return "motorcycle"
+	case strings.Contains(t, "truck"):
+		return "truck"
+	case t == "":
+		return ""
+	default:
+		return "vehicle"
+	}
+}
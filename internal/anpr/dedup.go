@@ -0,0 +1,119 @@
+package anpr
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"GO_LANG_WORKSPACE/internal/events"
+	"GO_LANG_WORKSPACE/internal/utils"
+)
+
+// ---------- De-dup ----------
+//
+// กล้องมักส่งรถคันเดียวซ้ำ 2–3 ครั้ง → ทิ้งครั้งที่ซ้ำก่อนถึง Decider (ไม่ถาม Cloud / ไม่สั่งไม้กั้นซ้ำ)
+// ซ้ำ = UUID ของกล้องเดิม หรือป้ายเดิมที่ประตู+ทิศเดียวกันภายใน TTL (ป้าย unknown ดูแค่ UUID)
+// ป้ายนับซ้ำเฉพาะเมื่อครั้งก่อนเปิดไม้กั้นได้ — ถูกปฏิเสธ/error แล้วรถยังรออยู่ ต้องถามใหม่ได้ (ดู releasePlate)
+//
+// ENV:
+//   DEDUP_TTL=30s                      ค่าเริ่มต้นทุกประตู (0 = ปิด)
+//   DEDUP_TTL_<ENT|EXT>_<GATE|RESE|ZONE>_<NN>=10s   ทับรายประตู เช่น DEDUP_TTL_EXT_GATE_01
+//   DEDUP_BROADCAST=false              true = ส่ง event plate.duplicate เข้าห้องของประตูด้วย
+
+// ErrDuplicate Decider ไม่ถูกเรียกเพราะเป็น event ซ้ำ (ตอบกล้องเหมือนสำเร็จ)
+var ErrDuplicate = errors.New("duplicate plate event")
+
+var (
+	dedupOnce sync.Once
+	deduper   *utils.Deduper
+	publisher *events.Publisher
+)
+
+// SetBroadcaster ปลายทางของ event plate.duplicate (ws.Hub)
+func SetBroadcaster(out events.Broadcaster) {
+	publisher = events.NewPublisher(out)
+}
+
+func dedupTTL(route Route, gateNo string) time.Duration {
+	key := fmt.Sprintf("DEDUP_TTL_%s_%s_%02s", route.Direction, route.Location, gateNo)
+	if v := os.Getenv(key); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			return d
+		}
+		log.Printf("[anpr] invalid %s=%q", key, v)
+	}
+	if v := os.Getenv("DEDUP_TTL"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			return d
+		}
+		log.Printf("[anpr] invalid DEDUP_TTL=%q", v)
+	}
+	return 30 * time.Second
+}
+
+// duplicate true ถ้า ev ซ้ำกับที่เพิ่งเห็นที่ประตูนี้ (และ log/broadcast ให้แล้ว)
+func duplicate(route Route, ev *PlateEvent) bool {
+	ttl := dedupTTL(route, ev.GateNo)
+	if ttl <= 0 {
+		return false
+	}
+	dedupOnce.Do(func() { deduper = utils.NewDeduper(30 * time.Second) })
+
+	scope := strings.Join([]string{route.Name, ev.Zoning, ev.GateNo}, "|")
+	var first time.Time
+	var dup bool
+	reason := "uuid"
+	if ev.UUID != "" {
+		first, dup = deduper.Seen(scope+"|uuid|"+ev.UUID, ttl)
+	}
+	if !ev.Unknown() {
+		// บันทึกป้ายเสมอ (แม้ UUID ซ้ำแล้ว) เพื่อให้ครั้งถัดไปที่ UUID ใหม่แต่ป้ายเดิมถูกจับได้
+		key := scope + "|plate|" + ev.Plate
+		if f, d := deduper.Seen(key, ttl); d && !dup {
+			first, dup, reason = f, true, "plate"
+		} else if !d && !dup {
+			ev.plateKey = key
+		}
+	}
+	if !dup {
+		return false
+	}
+
+	log.Printf("[anpr] duplicate %s gate=%s plate=%s uuid=%s by %s (first seen %s ago)",
+		route.Name, ev.GateNo, ev.Plate, ev.UUID, reason, time.Since(first).Round(time.Millisecond))
+	if publisher != nil && route.Room != nil && getenvBool("DEDUP_BROADCAST") {
+		dupEv := events.PlateDuplicate{
+			Vehicle:   events.Vehicle{LicensePlate: ev.Plate, UUID: ev.UUID},
+			Reason:    reason,
+			FirstSeen: first.Format(time.RFC3339),
+		}
+		legacy := map[string]any{
+			"type":          "duplicate",
+			"license_plate": ev.Plate,
+			"uuid":          ev.UUID,
+			"reason":        reason,
+			"first_seen":    dupEv.FirstSeen,
+		}
+		publisher.Publish(events.New(events.TypePlateDuplicate, route.Room(ev), ev.GateNo, route.Direction, ev.RequestID, dupEv), legacy)
+	}
+	return true
+}
+
+// releasePlate คืน key ป้ายที่ event นี้จองไว้ถ้าตัดสินแล้วไม้กั้นไม่เปิด (ถูกปฏิเสธ / error / ปิดตามตาราง)
+// UUID ยังจำไว้ตามเดิม — กล้องส่ง event เดิมซ้ำก็ยังถูกทิ้ง
+func releasePlate(ev *PlateEvent, err error) {
+	if ev.plateKey == "" || (err == nil && ev.barrierOpened()) {
+		return
+	}
+	deduper.Forget(ev.plateKey)
+	ev.plateKey = ""
+}
+
+func getenvBool(k string) bool {
+	v := strings.ToLower(os.Getenv(k))
+	return v == "1" || v == "true" || v == "yes"
+}
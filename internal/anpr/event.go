@@ -0,0 +1,119 @@
+package anpr
+
+import (
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"GO_LANG_WORKSPACE/internal/events"
+	"GO_LANG_WORKSPACE/internal/journal"
+	"GO_LANG_WORKSPACE/internal/plate"
+)
+
+// ---------- ANPR ingestion ----------
+//
+// ทุก endpoint ที่กล้อง push ป้ายทะเบียนเข้ามา (order, reserve, zoning) ใช้ขั้นตอนเดียวกัน:
+//   1. parse request ของกล้อง → PlateEvent (ป้าย + รูป + metadata)
+//   2. ส่งให้ Decider ของ route นั้น (ถาม Cloud, เปิดไม้กั้น, LED, broadcast)
+//   3. log เวลาแต่ละขั้น + ตอบกล้อง
+// แก้ parser ที่นี่ที่เดียว มีผลกับทุกประตู
+
+// PlateEvent ป้ายทะเบียนหนึ่งครั้งที่กล้องส่งเข้ามา
+type PlateEvent struct {
+	Source      string   // hikvision | dahua
+	Plate       string   // ป้ายแบบ canonical (ดู internal/plate) — PLATE_NORMALIZE=false = ตามที่กล้องอ่าน
+	RawPlate    string   // ป้ายตามที่กล้องอ่าน (ยังอยู่แม้ Plate ถูกเปลี่ยนเป็น unknown เพราะ confidence ต่ำ)
+	Province    string   // จังหวัดที่อ่านได้ต่อท้ายป้าย (ถ้ามี)
+	Candidates  []string // ป้ายใกล้เคียงที่ OCR อาจอ่านสลับ ไว้ลองซ้ำเมื่อหาไม่เจอ
+	UUID        string
+	DateTime    string // เวลาจากกล้อง (ใช้เป็น time_in)
+	CameraIP    string
+	VehicleType string           // ค่าดิบจากกล้อง (car, truck, motorcycle...) — แปลงด้วย utils.VehicleType
+	Meta        events.PlateMeta // confidence, สีป้าย, ประเทศ/จังหวัด, ทิศทาง, สี/ยี่ห้อรถ, ตำแหน่งป้าย
+	PlateImage  []byte           // Hikvision licensePlatePicture.jpg | Dahua CutoutPic
+	SceneImage  []byte           // Hikvision detectedImage.jpg / pedestrianDetectionPicture.jpg | Dahua NormalPic
+	Raw         []byte           // XML/JSON ดิบจากกล้อง
+
+	// เติมโดย pipeline ตาม route ที่รับเข้ามา
+	LowConfidence bool // ป้ายถูกเปลี่ยนเป็น unknown เพราะ confidence ต่ำกว่า ANPR_MIN_CONFIDENCE
+	Route         string
+	GateNo        string
+	Zoning        string
+	Query         url.Values
+	RequestID     string
+	ReceivedAt    time.Time
+
+	lastMark time.Time
+	timings  []timing
+	record   journal.Entry // Cloud/ไม้กั้น/LED ที่ Decider บันทึกไว้ (ดู journal.go)
+	plateKey string        // key ป้ายใน deduper ที่ event นี้จองไว้ (ดู releasePlate)
+}
+
+type timing struct {
+	step string
+	d    time.Duration
+}
+
+func newEvent() *PlateEvent {
+	now := time.Now()
+	return &PlateEvent{ReceivedAt: now, lastMark: now}
+}
+
+// Unknown true ถ้ากล้องอ่านป้ายไม่ออก
+func (e *PlateEvent) Unknown() bool {
+	return strings.EqualFold(e.Plate, "unknown")
+}
+
+// normalize แปลงป้ายเป็น canonical + candidates (ป้าย unknown ไม่แตะ)
+func (e *PlateEvent) normalize() {
+	e.RawPlate = e.Plate
+	if !plate.Enabled() || e.Unknown() {
+		return
+	}
+	p := plate.Normalize(e.Plate)
+	if p.Canonical == "" {
+		return
+	}
+	if p.Canonical != e.Plate {
+		log.Printf("[anpr] plate %q normalized to %q", e.Plate, p.Canonical)
+	}
+	e.Plate, e.Province, e.Candidates = p.Canonical, p.Province, p.Candidates
+}
+
+// Metadata metadata ของการอ่านป้าย (nil ถ้ากล้องไม่ได้ส่งอะไรมา) — ใส่ใน payload ของ Cloud/broadcast
+func (e *PlateEvent) Metadata() *events.PlateMeta {
+	if e.Meta == (events.PlateMeta{}) {
+		return nil
+	}
+	m := e.Meta
+	return &m
+}
+
+// Image รูปป้าย — ไม่มีก็ใช้รูปรถแทน
+func (e *PlateEvent) Image() []byte {
+	if e.PlateImage != nil {
+		return e.PlateImage
+	}
+	return e.SceneImage
+}
+
+// Mark บันทึกเวลาของขั้นที่เพิ่งทำเสร็จ (นับจาก Mark ครั้งก่อน)
+func (e *PlateEvent) Mark(step string) {
+	now := time.Now()
+	e.timings = append(e.timings, timing{step: step, d: now.Sub(e.lastMark)})
+	e.lastMark = now
+}
+
+// logTimings log เวลาแต่ละขั้นในรูปแบบเดิมของ order/reserve/zoning
+func (e *PlateEvent) logTimings(label string) {
+	gate := e.GateNo
+	if e.Zoning != "" {
+		gate = e.Zoning + ":" + gate
+	}
+	log.Printf("[%s %s: LICENSE PLATE: %s]", label, gate, e.Plate)
+	for _, t := range e.timings {
+		log.Printf(" - %-17s %.2fs", t.step+":", t.d.Seconds())
+	}
+	log.Printf(" - %-17s %.2fs", "Total Time:", time.Since(e.ReceivedAt).Seconds())
+}
@@ -0,0 +1,143 @@
+package anpr
+
+import (
+	"encoding/xml"
+	"net/http"
+	"strings"
+
+	"GO_LANG_WORKSPACE/internal/events"
+)
+
+// ---------- Hikvision (ISAPI EventNotificationAlert, multipart) ----------
+
+type eventXML struct {
+	XMLName xml.Name `xml:"http://www.isapi.org/ver20/XMLSchema EventNotificationAlert"`
+	eventBody
+}
+
+// แบบไม่มี namespace (fallback)
+type eventXMLNoNS struct {
+	XMLName xml.Name `xml:"EventNotificationAlert"`
+	eventBody
+}
+
+type eventBody struct {
+	IPAddress   string  `xml:"ipAddress"`
+	DateTime    string  `xml:"dateTime"`
+	UUID        string  `xml:"UUID"`
+	ANPR        anprXML `xml:"ANPR"`
+	VehicleInfo struct {
+		Color            string `xml:"color"`
+		VehicleLogoRecog string `xml:"vehicleLogoRecog"`
+		VehicleModel     string `xml:"vehileModel"` // สะกดตาม ISAPI
+	} `xml:"vehicleInfo"`
+}
+
+type anprXML struct {
+	LicensePlate    string  `xml:"licensePlate"`
+	VehicleType     string  `xml:"vehicleType"`
+	ConfidenceLevel float64 `xml:"confidenceLevel"`
+	PlateColor      string  `xml:"plateColor"`
+	PlateType       string  `xml:"plateType"`
+	Country         string  `xml:"country"`
+	Region          string  `xml:"region"`
+	Province        string  `xml:"province"`
+	Direction       string  `xml:"direction"`
+	PictureInfo     []struct {
+		FileName  string `xml:"fileName"`
+		PlateRect *struct {
+			X      float64 `xml:"X"`
+			Y      float64 `xml:"Y"`
+			Width  float64 `xml:"width"`
+			Height float64 `xml:"height"`
+		} `xml:"plateRect"`
+	} `xml:"pictureInfoList>pictureInfo"`
+}
+
+// finishHikvision แยกไฟล์ตามชื่อ: *.xml, licensePlatePicture.jpg, detectedImage.jpg/pedestrianDetectionPicture.jpg
+func finishHikvision(ev *PlateEvent, parts []part) (*PlateEvent, error) {
+	ev.Source = "hikvision"
+	for _, p := range parts {
+		switch fn := p.fileName; {
+		case strings.HasSuffix(strings.ToLower(fn), ".xml"):
+			ev.Raw = p.data
+		case fn == "licensePlatePicture.jpg":
+			ev.PlateImage = p.data
+		case fn == "detectedImage.jpg" || fn == "pedestrianDetectionPicture.jpg":
+			ev.SceneImage = p.data
+		default:
+			// ไฟล์อื่นไม่รู้จัก — ทิ้ง
+		}
+	}
+	if len(ev.Raw) == 0 {
+		return nil, Reject(http.StatusOK, "Missing XML file")
+	}
+
+	if !parseEventXML(ev.Raw, ev) {
+		return nil, Reject(http.StatusOK, "Failed to parse XML")
+	}
+	ev.Mark("Parse XML")
+	return ev, nil
+}
+
+// parseEventXML ลองแบบมี namespace ก่อน แล้วค่อย fallback no-NS
+func parseEventXML(b []byte, ev *PlateEvent) bool {
+	var x eventXML
+	if err := xml.Unmarshal(b, &x); err == nil && strings.TrimSpace(x.ANPR.LicensePlate) != "" {
+		x.eventBody.fill(ev)
+		return true
+	}
+
+	var x2 eventXMLNoNS
+	if err := xml.Unmarshal(b, &x2); err == nil && strings.TrimSpace(x2.ANPR.LicensePlate) != "" {
+		x2.eventBody.fill(ev)
+		return true
+	}
+	return false
+}
+
+func (x *eventBody) fill(ev *PlateEvent) {
+	ev.Plate = strings.TrimSpace(x.ANPR.LicensePlate)
+	ev.UUID = strings.TrimSpace(x.UUID)
+	ev.DateTime = strings.TrimSpace(x.DateTime)
+	ev.CameraIP = strings.TrimSpace(x.IPAddress)
+	ev.VehicleType = strings.TrimSpace(x.ANPR.VehicleType)
+
+	a := x.ANPR
+	ev.Meta = events.PlateMeta{
+		Confidence:   a.ConfidenceLevel,
+		PlateColor:   known(a.PlateColor),
+		PlateType:    known(a.PlateType),
+		Country:      known(a.Country),
+		Region:       known(firstNonEmpty(a.Province, a.Region)),
+		Direction:    known(a.Direction),
+		VehicleColor: known(x.VehicleInfo.Color),
+		VehicleBrand: known(x.VehicleInfo.VehicleLogoRecog),
+		VehicleModel: known(x.VehicleInfo.VehicleModel),
+	}
+	for _, p := range a.PictureInfo {
+		if p.PlateRect != nil && (p.PlateRect.Width > 0 || p.PlateRect.Height > 0) {
+			r := events.Rect(*p.PlateRect)
+			ev.Meta.PlateRect = &r
+			break
+		}
+	}
+}
+
+// known ค่า "unknown"/"0" ของกล้องถือว่าไม่มี
+func known(s string) string {
+	s = strings.TrimSpace(s)
+	if strings.EqualFold(s, "unknown") || s == "0" {
+		return ""
+	}
+	return s
+}
+
+func firstNonEmpty(ss ...string) string {
+	for _, s := range ss {
+		if strings.TrimSpace(s) != "" {
+			return s
+		}
+	}
+	return ""
+}
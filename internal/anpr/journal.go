@@ -0,0 +1,97 @@
+package anpr
+
+import (
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"GO_LANG_WORKSPACE/internal/journal"
+)
+
+// ---------- Journal ----------
+//
+// Decider บันทึกสิ่งที่ทำกับป้ายผ่าน RecordCloud / RecordBarrier / RecordLED
+// แล้ว pipeline เขียนรวมเป็น journal.Entry เดียวเมื่อจบ (รวม event ซ้ำที่ถูกทิ้งด้วย)
+
+// RecordCloud บันทึก request/response ของ Cloud (status 0 = ไม่รู้)
+func (e *PlateEvent) RecordCloud(method, url string, req, res any, status int, err error, started time.Time) {
+	call := journal.CloudCall{
+		Method:   method,
+		URL:      url,
+		Request:  journal.Raw(req),
+		Status:   status,
+		Response: journal.Raw(res),
+		Ms:       time.Since(started).Milliseconds(),
+	}
+	if err != nil {
+		call.Error = err.Error()
+	}
+	e.record.Cloud = append(e.record.Cloud, call)
+}
+
+// RecordBarrier บันทึกผลสั่งไม้กั้น
+func (e *PlateEvent) RecordBarrier(action string, err error) {
+	a := journal.BarrierAction{Action: action, OK: err == nil}
+	if err != nil {
+		a.Error = err.Error()
+	}
+	e.record.Barrier = append(e.record.Barrier, a)
+}
+
+// barrierOpened true ถ้า Decider สั่งเปิดไม้กั้นสำเร็จ
+func (e *PlateEvent) barrierOpened() bool {
+	for _, a := range e.record.Barrier {
+		if a.OK && strings.HasPrefix(a.Action, "open") {
+			return true
+		}
+	}
+	return false
+}
+
+// RecordLED บันทึกข้อความที่ส่งขึ้น LED
+func (e *PlateEvent) RecordLED(host, text string, err error) {
+	o := journal.LEDOutput{Host: host, Text: text, OK: err == nil}
+	if err != nil {
+		o.Error = err.Error()
+	}
+	e.record.LED = append(e.record.LED, o)
+}
+
+// writeJournal เขียน entry ของ event ที่จบแล้ว (err = ผลของ Decider หรือ ErrDuplicate)
+func writeJournal(route Route, ev *PlateEvent, err error) {
+	store := journal.Default()
+	if store == nil {
+		return
+	}
+	entry := ev.record
+	entry.Time = ev.ReceivedAt
+	entry.Route = route.Name
+	entry.Direction = route.Direction
+	entry.Gate = ev.GateNo
+	entry.Zoning = ev.Zoning
+	entry.Plate = ev.Plate
+	if ev.RawPlate != ev.Plate {
+		entry.RawPlate = ev.RawPlate
+	}
+	entry.UUID = ev.UUID
+	entry.Source = ev.Source
+	entry.CameraIP = ev.CameraIP
+	entry.RequestID = ev.RequestID
+	entry.ANPR = ev.Metadata()
+	entry.Outcome = "ok"
+	switch {
+	case errors.Is(err, ErrDuplicate):
+		entry.Outcome = "duplicate"
+	case err != nil:
+		entry.Outcome, entry.Error = "error", err.Error()
+	}
+	for _, t := range ev.timings {
+		entry.Timings = append(entry.Timings, journal.Timing{Step: t.step, Ms: t.d.Milliseconds()})
+	}
+	entry.TotalMs = time.Since(ev.ReceivedAt).Milliseconds()
+
+	if err := store.Append(entry); err != nil {
+		log.Printf("[journal] %s gate=%s plate=%s: %v", route.Name, ev.GateNo, ev.Plate, err)
+	}
+}
@@ -0,0 +1,131 @@
+package anpr
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"strings"
+)
+
+const (
+	maxBody  = int64(16 << 20) // 16MB รวมทั้ง multipart — กันกล้องส่งรูปบวม/ผิดพลาด
+	maxParts = 10              // กันลูปไม่รู้จบจาก input แปลก
+)
+
+// part ไฟล์/field หนึ่งชิ้นใน multipart
+type part struct {
+	name        string // form name
+	fileName    string
+	contentType string
+	data        []byte
+}
+
+// Parse อ่าน request จากกล้องแล้วแยกยี่ห้อเอง:
+//   - multipart ที่มีไฟล์ .xml                 → Hikvision (ISAPI EventNotificationAlert)
+//   - application/json หรือ multipart ที่มี JSON → Dahua ITC (Picture.Plate.PlateNumber)
+//
+// error ที่คืนเป็น *Error เสมอ (status/ข้อความเดิมที่กล้องเคยได้)
+func Parse(w http.ResponseWriter, r *http.Request) (*PlateEvent, error) {
+	ev := newEvent()
+
+	mediaType, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, Reject(http.StatusOK, "Invalid request")
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxBody)
+	defer r.Body.Close()
+
+	if mediaType == "application/json" {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			return nil, Reject(http.StatusOK, "Invalid request")
+		}
+		ev.Mark("Read Body")
+		return finishDahua(ev, r, body, nil)
+	}
+	if !strings.HasPrefix(mediaType, "multipart/") {
+		return nil, Reject(http.StatusOK, "Invalid request")
+	}
+
+	mr := multipart.NewReader(r.Body, params["boundary"])
+	ev.Mark("Parse Multipart")
+
+	parts, err := readParts(mr)
+	if err != nil {
+		return nil, err
+	}
+	ev.Mark("Split Files")
+
+	for _, p := range parts {
+		if strings.HasSuffix(strings.ToLower(p.fileName), ".xml") {
+			return finishHikvision(ev, parts)
+		}
+	}
+	for _, p := range parts {
+		if isJSONPart(p) {
+			return finishDahua(ev, r, p.data, parts)
+		}
+	}
+	return nil, Reject(http.StatusOK, "Missing XML file")
+}
+
+// readParts อ่านทุก part เข้าหน่วยความจำ (form field ที่ไม่ใช่ JSON ทิ้ง)
+func readParts(mr *multipart.Reader) ([]part, error) {
+	var parts []part
+	n := 0
+	for {
+		p, err := mr.NextPart()
+		if err == io.EOF {
+			return parts, nil
+		}
+		if err != nil {
+			// เจอ error ระหว่างอ่าน (รวม timeout) → จบรีเควสต์ทันที
+			if ne, ok := err.(interface{ Timeout() bool }); ok && ne.Timeout() {
+				return nil, Reject(http.StatusRequestTimeout, "multipart read timeout")
+			}
+			log.Println("[anpr] multipart error:", err)
+			return nil, Reject(http.StatusOK, "invalid multipart")
+		}
+
+		n++
+		if n > maxParts {
+			_ = p.Close()
+			return nil, Reject(http.StatusOK, "too many parts")
+		}
+
+		buf, _ := io.ReadAll(p)
+		_ = p.Close()
+
+		pt := part{name: p.FormName(), fileName: p.FileName(), contentType: p.Header.Get("Content-Type"), data: buf}
+		if pt.fileName == "" && !isJSONPart(pt) {
+			// form field (ไม่ใช่ไฟล์) — ทิ้ง
+			continue
+		}
+		parts = append(parts, pt)
+	}
+}
+
+func isJSONPart(p part) bool {
+	if strings.HasPrefix(p.contentType, "application/json") || strings.HasSuffix(strings.ToLower(p.fileName), ".json") {
+		return true
+	}
+	return bytes.HasPrefix(bytes.TrimSpace(p.data), []byte("{"))
+}
+
+func isImagePart(p part) bool {
+	fn := strings.ToLower(p.fileName)
+	return strings.HasPrefix(p.contentType, "image/") || strings.HasSuffix(fn, ".jpg") || strings.HasSuffix(fn, ".jpeg")
+}
+
+// remoteIP IP ของกล้องจาก connection (ใช้เมื่อ payload ไม่บอก)
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
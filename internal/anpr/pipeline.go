@@ -0,0 +1,140 @@
+package anpr
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+
+	"GO_LANG_WORKSPACE/internal/capture"
+)
+
+// Decider ขั้นตัดสินใจของแต่ละ route (ถาม Cloud, เปิดไม้กั้น, LED, broadcast)
+// ไม่ได้รับ gin.Context — ใช้ได้ทั้งกับ request สดและ event ที่มาจากทางอื่น
+type Decider func(ctx context.Context, ev *PlateEvent) error
+
+// Route ประตูหนึ่งแบบที่รับป้ายจากกล้อง
+type Route struct {
+	Name      string // gate_in | gate_out | reserve_in | reserve_out | zoning_entrance | zoning_exit
+	Label     string // หัว log เวลา เช่น "GATE IN"
+	Direction string // ENT | EXT
+	Location  string // GATE | RESE | ZONE
+	Decide    Decider
+	Room      func(ev *PlateEvent) string // ห้อง ws ของประตู (ใช้ส่ง event plate.duplicate)
+}
+
+// Error ผลตอบกล้องเมื่อทำต่อไม่ได้ (กล้องส่วนใหญ่ต้องได้ 200 ไม่งั้นส่งซ้ำ)
+type Error struct {
+	Status  int
+	Message string
+}
+
+func (e *Error) Error() string { return e.Message }
+
+// Reject สร้าง error ที่ตอบกล้องด้วย status/ข้อความนี้
+func Reject(status int, message string) error {
+	return &Error{Status: status, Message: message}
+}
+
+var (
+	mu     sync.RWMutex
+	routes = map[string]Route{}
+)
+
+// Register ลงทะเบียน route (ชื่อซ้ำ = แทนที่ของเดิม)
+func Register(rs ...Route) {
+	mu.Lock()
+	defer mu.Unlock()
+	for _, r := range rs {
+		routes[r.Name] = r
+	}
+}
+
+// Lookup หา route ตามชื่อ
+func Lookup(name string) (Route, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	r, ok := routes[name]
+	return r, ok
+}
+
+// Handler gin handler สำหรับกล้อง (Hikvision/Dahua) ของ route ที่ลงทะเบียนไว้
+//
+//	?gate_no=1 และ :zoning_code (เฉพาะ zoning) อ่านจาก request
+func Handler(name string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		route, ok := Lookup(name)
+		if !ok {
+			log.Printf("[anpr] route %q not registered", name)
+			c.String(http.StatusNotFound, "unknown route")
+			return
+		}
+		capture.Save(c.Request, name)
+		ev, err := Parse(c.Writer, c.Request)
+		if err != nil {
+			respond(c, err)
+			return
+		}
+		Bind(c, ev)
+		if asyncEnabled() {
+			// ANPR_ASYNC: ตอบกล้องทันทีที่ลง spool แล้ว — worker ของประตูทำ Decider ต่อ
+			respond(c, Enqueue(route, ev))
+			return
+		}
+		respond(c, Run(c.Request.Context(), route, ev))
+	}
+}
+
+// Bind เติมข้อมูลประตูจาก request (gate_no, zoning_code, query, request id)
+func Bind(c *gin.Context, ev *PlateEvent) {
+	ev.GateNo = c.Query("gate_no")
+	ev.Zoning = c.Param("zoning_code")
+	ev.Query = c.Request.URL.Query()
+	ev.RequestID = c.GetString("request_id")
+}
+
+// Run ส่ง event ให้ Decider ของ route แล้ว log เวลา — event ซ้ำคืน ErrDuplicate โดยไม่เรียก Decider
+func Run(ctx context.Context, route Route, ev *PlateEvent) error {
+	if err := prepare(route, ev); err != nil {
+		return err
+	}
+	return decide(ctx, route, ev)
+}
+
+// prepare ขั้นที่ไม่ต้องรอใคร: normalize ป้าย, confidence ขั้นต่ำ, de-dup
+func prepare(route Route, ev *PlateEvent) error {
+	ev.Route = route.Name
+	ev.normalize()
+	checkConfidence(route, ev)
+	if duplicate(route, ev) {
+		writeJournal(route, ev, ErrDuplicate)
+		return ErrDuplicate
+	}
+	ev.Mark("De-dup")
+	return nil
+}
+
+func decide(ctx context.Context, route Route, ev *PlateEvent) error {
+	err := route.Decide(ctx, ev)
+	releasePlate(ev, err)
+	ev.logTimings(route.Label)
+	writeJournal(route, ev, err)
+	return err
+}
+
+func respond(c *gin.Context, err error) {
+	if err == nil || errors.Is(err, ErrDuplicate) {
+		c.String(http.StatusOK, "File(s) uploaded successfully")
+		return
+	}
+	var e *Error
+	if errors.As(err, &e) {
+		c.String(e.Status, e.Message)
+		return
+	}
+	log.Printf("[anpr] %s: %v", c.FullPath(), err)
+	c.String(http.StatusInternalServerError, "internal error")
+}
@@ -0,0 +1,334 @@
+package anpr
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"GO_LANG_WORKSPACE/internal/events"
+)
+
+// ---------- Async gate processing ----------
+//
+// กล้อง Hikvision ส่ง event ซ้ำเมื่อตอบช้า → ANPR_ASYNC=true ตอบกล้องทันทีหลัง parse + de-dup + เขียนลง spool
+// แล้วให้ worker ของแต่ละประตูทำ Decider ตามลำดับที่รับเข้ามา (ประตูที่ Cloud/กล้องช้าไม่ถ่วงประตูอื่น)
+// event ที่ค้างใน spool ตอน restart ถูกทำต่อใน StartWorkers (เก่าเกิน ANPR_SPOOL_MAX_AGE ทิ้ง — รถไปแล้ว)
+//
+// ENV:
+//   ANPR_ASYNC=false               true = ตอบกล้องก่อน แล้วค่อยถาม Cloud / เปิดไม้กั้น
+//   ANPR_SPOOL_DIR=./spool/anpr
+//   ANPR_QUEUE_SIZE=64             คิวต่อประตู (เต็ม = ทำใน request เลยแบบเดิม)
+//   ANPR_SPOOL_MAX_AGE=2m
+
+// spoolVersion รูปแบบไฟล์ใน spool — เปลี่ยน field ของ spoolRecord แบบไม่เข้ากันเมื่อไรให้เพิ่มเลขนี้
+// (event ที่ค้างจากเวอร์ชันก่อน upgrade ต้องอ่านได้ หรือถูกทิ้งพร้อม log ไม่ใช่ decode ผิดเงียบ ๆ)
+const spoolVersion = 1
+
+// spoolRecord รูปแบบบนดิสก์ของ event ใน spool — แยกจาก PlateEvent เพื่อให้เปลี่ยนชื่อ field ในโค้ดได้โดยไฟล์เดิมยังอ่านได้
+type spoolRecord struct {
+	Version       int              `json:"v"`
+	Route         string           `json:"route"`
+	Source        string           `json:"source"`
+	Plate         string           `json:"plate"`
+	RawPlate      string           `json:"raw_plate,omitempty"`
+	Province      string           `json:"province,omitempty"`
+	Candidates    []string         `json:"candidates,omitempty"`
+	UUID          string           `json:"uuid,omitempty"`
+	DateTime      string           `json:"date_time,omitempty"`
+	CameraIP      string           `json:"camera_ip,omitempty"`
+	VehicleType   string           `json:"vehicle_type,omitempty"`
+	Meta          events.PlateMeta `json:"meta"`
+	PlateImage    []byte           `json:"plate_image,omitempty"` // base64
+	SceneImage    []byte           `json:"scene_image,omitempty"` // base64
+	Raw           []byte           `json:"raw,omitempty"`         // base64
+	LowConfidence bool             `json:"low_confidence,omitempty"`
+	GateNo        string           `json:"gate_no"`
+	Zoning        string           `json:"zoning,omitempty"`
+	Query         url.Values       `json:"query,omitempty"`
+	RequestID     string           `json:"request_id,omitempty"`
+	ReceivedAt    time.Time        `json:"received_at"`
+
+	Event *PlateEvent `json:"event,omitempty"` // รูปแบบก่อนมี version (v0) — อ่านอย่างเดียว
+}
+
+func newSpoolRecord(route Route, ev *PlateEvent) spoolRecord {
+	return spoolRecord{
+		Version:       spoolVersion,
+		Route:         route.Name,
+		Source:        ev.Source,
+		Plate:         ev.Plate,
+		RawPlate:      ev.RawPlate,
+		Province:      ev.Province,
+		Candidates:    ev.Candidates,
+		UUID:          ev.UUID,
+		DateTime:      ev.DateTime,
+		CameraIP:      ev.CameraIP,
+		VehicleType:   ev.VehicleType,
+		Meta:          ev.Meta,
+		PlateImage:    ev.PlateImage,
+		SceneImage:    ev.SceneImage,
+		Raw:           ev.Raw,
+		LowConfidence: ev.LowConfidence,
+		GateNo:        ev.GateNo,
+		Zoning:        ev.Zoning,
+		Query:         ev.Query,
+		RequestID:     ev.RequestID,
+		ReceivedAt:    ev.ReceivedAt,
+	}
+}
+
+// event แปลงกลับเป็น PlateEvent
+func (r spoolRecord) event() (*PlateEvent, error) {
+	switch r.Version {
+	case 0:
+		if r.Event == nil {
+			return nil, errors.New("invalid spool entry: no event")
+		}
+		return r.Event, nil
+	case spoolVersion:
+	default:
+		return nil, fmt.Errorf("unsupported spool version %d", r.Version)
+	}
+	return &PlateEvent{
+		Source:        r.Source,
+		Plate:         r.Plate,
+		RawPlate:      r.RawPlate,
+		Province:      r.Province,
+		Candidates:    r.Candidates,
+		UUID:          r.UUID,
+		DateTime:      r.DateTime,
+		CameraIP:      r.CameraIP,
+		VehicleType:   r.VehicleType,
+		Meta:          r.Meta,
+		PlateImage:    r.PlateImage,
+		SceneImage:    r.SceneImage,
+		Raw:           r.Raw,
+		LowConfidence: r.LowConfidence,
+		Route:         r.Route,
+		GateNo:        r.GateNo,
+		Zoning:        r.Zoning,
+		Query:         r.Query,
+		RequestID:     r.RequestID,
+		ReceivedAt:    r.ReceivedAt,
+	}, nil
+}
+
+type job struct {
+	route Route
+	ev    *PlateEvent
+	file  string
+}
+
+var (
+	workersMu  sync.Mutex
+	workers    = map[string]chan job{}
+	workersCtx = context.Background()
+	spoolSeq   atomic.Uint64
+)
+
+func asyncEnabled() bool { return getenvBool("ANPR_ASYNC") }
+
+func spoolDir() string {
+	if v := os.Getenv("ANPR_SPOOL_DIR"); v != "" {
+		return v
+	}
+	return filepath.Join("spool", "anpr")
+}
+
+func queueSize() int {
+	if n, err := strconv.Atoi(os.Getenv("ANPR_QUEUE_SIZE")); err == nil && n > 0 {
+		return n
+	}
+	return 64
+}
+
+func spoolMaxAge() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("ANPR_SPOOL_MAX_AGE")); err == nil && d > 0 {
+		return d
+	}
+	return 2 * time.Minute
+}
+
+// StartWorkers ทำ event ที่ค้างใน spool จากรอบก่อน แล้วให้ worker หยุดรับงานใหม่เมื่อ ctx ถูกยกเลิก
+// (งานที่ยังไม่ได้ทำอยู่ใน spool รอรอบหน้า) — เรียกหลัง Register ครบทุก route
+func StartWorkers(ctx context.Context) {
+	workersMu.Lock()
+	workersCtx = ctx
+	workersMu.Unlock()
+
+	if !asyncEnabled() {
+		return
+	}
+	dir := spoolDir()
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		log.Printf("[anpr] spool dir %s: %v", dir, err)
+		return
+	}
+	names, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	sort.Strings(names) // ชื่อไฟล์ขึ้นต้นด้วยเวลารับ → ลำดับเดิม
+	recovered, dropped := 0, 0
+	for _, name := range names {
+		route, ev, err := readSpool(name)
+		switch {
+		case err != nil:
+			log.Printf("[anpr] spool %s: %v — removed", filepath.Base(name), err)
+			os.Remove(name)
+			dropped++
+		case time.Since(ev.ReceivedAt) > spoolMaxAge():
+			log.Printf("[anpr] spool %s: %s gate=%s plate=%s too old (%s) — removed",
+				filepath.Base(name), route.Name, ev.GateNo, ev.Plate, time.Since(ev.ReceivedAt).Round(time.Second))
+			os.Remove(name)
+			dropped++
+		default:
+			j := job{route: route, ev: ev, file: name}
+			if !push(j) {
+				// คิวเต็มตั้งแต่ตอน start — ทำเลยเหมือน Enqueue (รอรอบหน้าอาจเกิน ANPR_SPOOL_MAX_AGE แล้วหาย)
+				log.Printf("[anpr] queue %s full, processing %s inline", gateKey(route.Name, ev), filepath.Base(name))
+				process(j)
+			}
+			recovered++
+		}
+	}
+	if recovered+dropped > 0 {
+		log.Printf("[anpr] spool: recovered %d, dropped %d", recovered, dropped)
+	}
+}
+
+// Enqueue prepare → เขียน spool → เข้าคิวของประตู (ไม่รอ Decider)
+// เขียน spool ไม่ได้หรือคิวเต็ม → ทำ Decider ใน request นี้เลย (ช้าแต่ไม่หาย)
+func Enqueue(route Route, ev *PlateEvent) error {
+	if err := prepare(route, ev); err != nil {
+		return err
+	}
+	file, err := writeSpool(route, ev)
+	if err != nil {
+		log.Printf("[anpr] spool write failed, processing inline: %v", err)
+		return decide(context.Background(), route, ev)
+	}
+	ev.Mark("Spool")
+	if !push(job{route: route, ev: ev, file: file}) {
+		log.Printf("[anpr] queue %s full, processing inline", gateKey(route.Name, ev))
+		defer os.Remove(file)
+		return decide(context.Background(), route, ev)
+	}
+	return nil
+}
+
+func gateKey(route string, ev *PlateEvent) string {
+	return strings.Join([]string{route, ev.Zoning, ev.GateNo}, "|")
+}
+
+// push ใส่งานเข้าคิวของประตู (สร้าง worker ครั้งแรก) — false ถ้าคิวเต็ม
+func push(j job) bool {
+	key := gateKey(j.route.Name, j.ev)
+	workersMu.Lock()
+	q, ok := workers[key]
+	if !ok {
+		q = make(chan job, queueSize())
+		workers[key] = q
+		go work(workersCtx, key, q)
+	}
+	workersMu.Unlock()
+
+	select {
+	case q <- j:
+		return true
+	default:
+		return false
+	}
+}
+
+// work ทำงานของประตูเดียวทีละ event ตามลำดับ
+func work(ctx context.Context, key string, q chan job) {
+	for {
+		select {
+		case <-ctx.Done():
+			if n := len(q); n > 0 {
+				log.Printf("[anpr] worker %s stopped, %d event(s) left in spool", key, n)
+			}
+			return
+		case j := <-q:
+			process(j)
+		}
+	}
+}
+
+func process(j job) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("[anpr] %s gate=%s plate=%s panic: %v", j.route.Name, j.ev.GateNo, j.ev.Plate, r)
+		}
+		// ลบแม้ panic — ไม่งั้น event เดิมพังซ้ำทุกครั้งที่ start
+		if err := os.Remove(j.file); err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Printf("[anpr] spool remove %s: %v", j.file, err)
+		}
+	}()
+	j.ev.Mark("Queue")
+	if err := decide(context.Background(), j.route, j.ev); err != nil {
+		log.Printf("[anpr] %s gate=%s plate=%s: %v", j.route.Name, j.ev.GateNo, j.ev.Plate, err)
+	}
+}
+
+// writeSpool เขียน event ลงดิสก์แบบ atomic (tmp → fsync → rename)
+func writeSpool(route Route, ev *PlateEvent) (string, error) {
+	dir := spoolDir()
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	b, err := json.Marshal(newSpoolRecord(route, ev))
+	if err != nil {
+		return "", err
+	}
+	name := filepath.Join(dir, fmt.Sprintf("%020d-%06d.json", ev.ReceivedAt.UnixNano(), spoolSeq.Add(1)%1e6))
+	tmp := name + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return "", err
+	}
+	if _, err = f.Write(b); err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, name)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return "", err
+	}
+	return name, nil
+}
+
+func readSpool(name string) (Route, *PlateEvent, error) {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return Route{}, nil, err
+	}
+	var rec spoolRecord
+	if err := json.Unmarshal(b, &rec); err != nil {
+		return Route{}, nil, fmt.Errorf("invalid spool entry: %v", err)
+	}
+	ev, err := rec.event()
+	if err != nil {
+		return Route{}, nil, err
+	}
+	route, ok := Lookup(rec.Route)
+	if !ok {
+		return Route{}, nil, fmt.Errorf("route %q not registered", rec.Route)
+	}
+	ev.lastMark = time.Now()
+	return route, ev, nil
+}
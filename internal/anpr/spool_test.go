@@ -0,0 +1,114 @@
+package anpr
+
+import (
+	"encoding/json"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"GO_LANG_WORKSPACE/internal/events"
+)
+
+func TestSpoolRecordRoundTrip(t *testing.T) {
+	received := time.Date(2026, 10, 12, 8, 30, 0, 0, time.UTC)
+	full := &PlateEvent{
+		Source:        "hikvision",
+		Plate:         "กข1234",
+		RawPlate:      "กข 1234 กทม",
+		Province:      "กรุงเทพมหานคร",
+		Candidates:    []string{"กช1234"},
+		UUID:          "u-1",
+		DateTime:      "2026-10-12T08:30:00+07:00",
+		CameraIP:      "10.10.22.31",
+		VehicleType:   "car",
+		Meta:          events.PlateMeta{Confidence: 92, PlateColor: "white", PlateRect: &events.Rect{X: 0.1, Y: 0.2}},
+		PlateImage:    []byte{0xff, 0xd8, 0x01},
+		SceneImage:    []byte{0xff, 0xd8, 0x02},
+		Raw:           []byte("<EventNotificationAlert/>"),
+		LowConfidence: true,
+		Route:         "gate_out",
+		GateNo:        "1",
+		Zoning:        "ZN01",
+		Query:         url.Values{"gate_no": {"1"}},
+		RequestID:     "req-1",
+		ReceivedAt:    received,
+	}
+
+	tests := []struct {
+		name string
+		data func(t *testing.T) []byte // ไฟล์ใน spool
+		want *PlateEvent
+	}{
+		{
+			name: "v1 full event",
+			data: func(t *testing.T) []byte {
+				b, err := json.Marshal(newSpoolRecord(Route{Name: "gate_out"}, full))
+				if err != nil {
+					t.Fatal(err)
+				}
+				return b
+			},
+			want: full,
+		},
+		{
+			name: "v1 minimal event",
+			data: func(t *testing.T) []byte {
+				b, _ := json.Marshal(newSpoolRecord(Route{Name: "reserve_in"}, &PlateEvent{Plate: "unknown", GateNo: "2", ReceivedAt: received}))
+				return b
+			},
+			want: &PlateEvent{Plate: "unknown", Route: "reserve_in", GateNo: "2", ReceivedAt: received},
+		},
+		{
+			// ก่อนมี version: PlateEvent ทั้งก้อนใต้ "event" ด้วยชื่อ field ของ Go
+			name: "v0 legacy event",
+			data: func(t *testing.T) []byte {
+				return []byte(`{"route":"gate_out","event":{"Source":"dahua","Plate":"กข1234","UUID":"u-0",` +
+					`"PlateImage":"/9gB","Meta":{"confidence":80},"GateNo":"1","ReceivedAt":"2026-10-12T08:30:00Z"}}`)
+			},
+			want: &PlateEvent{Source: "dahua", Plate: "กข1234", UUID: "u-0", PlateImage: []byte{0xff, 0xd8, 0x01},
+				Meta: events.PlateMeta{Confidence: 80}, GateNo: "1", ReceivedAt: received},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var rec spoolRecord
+			if err := json.Unmarshal(tt.data(t), &rec); err != nil {
+				t.Fatalf("unmarshal: %v", err)
+			}
+			got, err := rec.event()
+			if err != nil {
+				t.Fatalf("event(): %v", err)
+			}
+			if !got.ReceivedAt.Equal(tt.want.ReceivedAt) {
+				t.Errorf("ReceivedAt = %s, want %s", got.ReceivedAt, tt.want.ReceivedAt)
+			}
+			g, w := *got, *tt.want
+			g.ReceivedAt, w.ReceivedAt = time.Time{}, time.Time{}
+			if !reflect.DeepEqual(g, w) {
+				t.Errorf("event() =\n%+v\nwant\n%+v", g, w)
+			}
+		})
+	}
+}
+
+func TestSpoolRecordVersion(t *testing.T) {
+	b, _ := json.Marshal(newSpoolRecord(Route{Name: "gate_in"}, &PlateEvent{Plate: "กข1234"}))
+	if !strings.Contains(string(b), `"v":1`) {
+		t.Errorf("spool record %s: want \"v\":%d", b, spoolVersion)
+	}
+
+	for _, data := range []string{
+		`{"route":"gate_in"}`,                        // v0 ไม่มี event
+		`{"v":2,"route":"gate_in","plate":"กข1234"}`, // เวอร์ชันใหม่กว่าที่รู้จัก
+	} {
+		var rec spoolRecord
+		if err := json.Unmarshal([]byte(data), &rec); err != nil {
+			t.Fatalf("unmarshal %s: %v", data, err)
+		}
+		if _, err := rec.event(); err == nil {
+			t.Errorf("event() of %s: want error", data)
+		}
+	}
+}
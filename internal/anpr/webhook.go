@@ -0,0 +1,296 @@
+package anpr
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// ---------- Generic JSON webhook (software LPR engines) ----------
+//
+//   POST /api/v3/anpr/:gate_type/:gate_no
+//   gate_type = gate-in | gate-out | reserve-in | reserve-out | zoning-entrance | zoning-exit
+//
+// ต่างจาก endpoint ของกล้อง: ตอบเป็น JSON พร้อม status code จริง (400 ข้อมูลผิด, 404 ไม่รู้จักประตู ...)
+//
+// ENV:
+//   ANPR_WEBHOOK_TOKEN=...                      จำเป็น (header X-Webhook-Token หรือ Authorization: Bearer) ไม่ตั้ง = ปิด webhook
+//   ANPR_WEBHOOK_IMAGE_HOSTS=10.10.22.50:8080   host ที่ยอมให้ดึงรูปจาก url (คั่นด้วย ,) ไม่ตั้ง = รับ base64 อย่างเดียว
+
+const (
+	maxWebhookBody  = int64(16 << 20)
+	maxImageFetch   = int64(8 << 20)
+	imageFetchLimit = 5 * time.Second
+)
+
+// WebhookImage รูปแบบ base64 หรือ URL (อย่างใดอย่างหนึ่ง)
+type WebhookImage struct {
+	Base64 string `json:"base64,omitempty"`
+	URL    string `json:"url,omitempty"`
+}
+
+// WebhookEvent body ของ webhook
+type WebhookEvent struct {
+	Plate       string        `json:"plate"`                  // จำเป็น ("unknown" = อ่านไม่ออก)
+	Confidence  *float64      `json:"confidence,omitempty"`   // 0-1 หรือ 0-100
+	Timestamp   string        `json:"timestamp,omitempty"`    // RFC3339 (ไม่ส่ง = เวลาที่รับ)
+	VehicleType string        `json:"vehicle_type,omitempty"` // car | truck | motorcycle
+	EventID     string        `json:"event_id,omitempty"`     // ใช้เป็น uuid (ไม่ส่ง = สร้างให้)
+	CameraIP    string        `json:"camera_ip,omitempty"`
+	ZoningCode  string        `json:"zoning_code,omitempty"` // จำเป็นสำหรับ zoning-*
+	NextZone    string        `json:"next_zone,omitempty"`   // zoning-exit
+	PlateImage  *WebhookImage `json:"plate_image,omitempty"`
+	SceneImage  *WebhookImage `json:"scene_image,omitempty"`
+}
+
+// FieldError ข้อผิดพลาดของ field หนึ่ง
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+var vehicleTypes = map[string]bool{"car": true, "vehicle": true, "truck": true, "motorcycle": true}
+
+// Webhook godoc
+// @Summary      รับป้ายทะเบียนจาก LPR engine (JSON)
+// @Description  ส่งเข้า flow เดียวกับกล้อง Hikvision/Dahua ของประตูนั้น — รูปส่งเป็น base64 หรือ URL
+// @Tags         anpr
+// @Accept       json
+// @Produce      json
+// @Param        X-Webhook-Token  header    string        true  "ANPR_WEBHOOK_TOKEN"
+// @Param        gate_type        path      string        true  "gate-in | gate-out | reserve-in | reserve-out | zoning-entrance | zoning-exit"
+// @Param        gate_no          path      string        true  "หมายเลขประตู"
+// @Param        body             body      WebhookEvent  true  "plate event"
+// @Success      200              {object}  map[string]interface{}
+// @Failure      400              {object}  map[string]interface{}  "validation failed"
+// @Failure      401              {object}  map[string]interface{}  "invalid webhook token"
+// @Failure      404              {object}  map[string]interface{}  "unknown gate type"
+// @Router       /api/v3/anpr/{gate_type}/{gate_no} [post]
+func Webhook(c *gin.Context) {
+	gateType := c.Param("gate_type")
+	route, ok := Lookup(strings.ReplaceAll(gateType, "-", "_"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"status": false, "message": "unknown gate type: " + gateType})
+		return
+	}
+
+	var in WebhookEvent
+	dec := json.NewDecoder(http.MaxBytesReader(c.Writer, c.Request.Body, maxWebhookBody))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&in); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": false, "message": "invalid JSON: " + err.Error()})
+		return
+	}
+
+	if errs := in.validate(route, c.Param("gate_no")); len(errs) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"status": false, "message": "validation failed", "errors": errs})
+		return
+	}
+
+	ev, errs := in.toEvent(c.Request.Context(), c.ClientIP())
+	if len(errs) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"status": false, "message": "image fetch failed", "errors": errs})
+		return
+	}
+	ev.GateNo = c.Param("gate_no")
+	ev.Zoning = in.ZoningCode
+	ev.Query = url.Values{}
+	if in.NextZone != "" {
+		ev.Query.Set("next_zone", in.NextZone)
+	}
+	ev.RequestID = c.GetString("request_id")
+
+	err := Run(c.Request.Context(), route, ev)
+	if errors.Is(err, ErrDuplicate) {
+		c.JSON(http.StatusOK, gin.H{
+			"status":  true,
+			"message": "duplicate ignored",
+			"data":    gin.H{"route": route.Name, "uuid": ev.UUID, "plate": ev.Plate, "duplicate": true},
+		})
+		return
+	}
+	if err != nil {
+		status, msg := http.StatusInternalServerError, err.Error()
+		var e *Error
+		if errors.As(err, &e) {
+			status, msg = e.Status, e.Message
+			if status == http.StatusOK {
+				status = http.StatusUnprocessableEntity
+			}
+		}
+		c.JSON(status, gin.H{"status": false, "message": msg})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"status":  true,
+		"message": "accepted",
+		"data":    gin.H{"route": route.Name, "uuid": ev.UUID, "plate": ev.Plate},
+	})
+}
+
+func (in *WebhookEvent) validate(route Route, gateNo string) []FieldError {
+	var errs []FieldError
+	add := func(field, msg string) { errs = append(errs, FieldError{Field: field, Message: msg}) }
+
+	if strings.TrimSpace(gateNo) == "" {
+		add("gate_no", "required")
+	} else if _, err := strconv.Atoi(gateNo); err != nil {
+		add("gate_no", "must be a number")
+	}
+	if strings.TrimSpace(in.Plate) == "" {
+		add("plate", "required")
+	} else if len(in.Plate) > 32 {
+		add("plate", "too long (max 32 bytes)")
+	}
+	if in.Confidence != nil && (*in.Confidence < 0 || *in.Confidence > 100) {
+		add("confidence", "must be between 0 and 1 (or 0 and 100)")
+	}
+	if in.Timestamp != "" {
+		if _, err := time.Parse(time.RFC3339, in.Timestamp); err != nil {
+			add("timestamp", "must be RFC3339")
+		}
+	}
+	if in.VehicleType != "" && !vehicleTypes[strings.ToLower(in.VehicleType)] {
+		add("vehicle_type", "must be one of car, truck, motorcycle")
+	}
+	if route.Location == "ZONE" && strings.TrimSpace(in.ZoningCode) == "" {
+		add("zoning_code", "required for zoning gates")
+	}
+	if route.Location == "ZONE" && route.Direction == "EXT" && strings.TrimSpace(in.NextZone) == "" {
+		add("next_zone", "required for zoning-exit")
+	}
+	for _, f := range []struct {
+		field string
+		img   *WebhookImage
+	}{{"plate_image", in.PlateImage}, {"scene_image", in.SceneImage}} {
+		field, img := f.field, f.img
+		if img == nil {
+			continue
+		}
+		switch {
+		case img.Base64 != "" && img.URL != "":
+			add(field, "set either base64 or url, not both")
+		case img.Base64 != "":
+			if _, err := base64.StdEncoding.DecodeString(img.Base64); err != nil {
+				add(field+".base64", "invalid base64")
+			}
+		case img.URL != "":
+			u, err := url.Parse(img.URL)
+			switch {
+			case err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "":
+				add(field+".url", "must be an http(s) URL")
+			case !imageHostAllowed(u):
+				add(field+".url", "host not in ANPR_WEBHOOK_IMAGE_HOSTS (send base64 instead)")
+			}
+		default:
+			add(field, "base64 or url required")
+		}
+	}
+	return errs
+}
+
+// toEvent แปลงเป็น PlateEvent (ดึงรูปจาก URL ถ้าส่งมาแบบ URL)
+func (in *WebhookEvent) toEvent(ctx context.Context, clientIP string) (*PlateEvent, []FieldError) {
+	ev := newEvent()
+	ev.Source = "webhook"
+	ev.Plate = strings.TrimSpace(in.Plate)
+	ev.UUID = in.EventID
+	if ev.UUID == "" {
+		ev.UUID = uuid.NewString()
+	}
+	ev.DateTime = in.Timestamp
+	if ev.DateTime == "" {
+		ev.DateTime = ev.ReceivedAt.Format(time.RFC3339)
+	}
+	ev.CameraIP = in.CameraIP
+	if ev.CameraIP == "" {
+		ev.CameraIP = clientIP
+	}
+	ev.VehicleType = strings.ToLower(in.VehicleType)
+	if in.Confidence != nil {
+		ev.Meta.Confidence = *in.Confidence
+		if ev.Meta.Confidence <= 1 {
+			ev.Meta.Confidence *= 100
+		}
+	}
+	ev.Raw, _ = json.Marshal(in)
+
+	var errs []FieldError
+	var err error
+	if ev.PlateImage, err = loadImage(ctx, in.PlateImage); err != nil {
+		errs = append(errs, FieldError{Field: "plate_image.url", Message: err.Error()})
+	}
+	if ev.SceneImage, err = loadImage(ctx, in.SceneImage); err != nil {
+		errs = append(errs, FieldError{Field: "scene_image.url", Message: err.Error()})
+	}
+	ev.Mark("Parse JSON")
+	return ev, errs
+}
+
+// imageClient ไม่ตาม redirect ไป host ที่ไม่ได้อนุญาต
+var imageClient = &http.Client{
+	Timeout: imageFetchLimit,
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		if len(via) >= 3 || !imageHostAllowed(req.URL) {
+			return fmt.Errorf("redirect to %s not allowed", req.URL.Host)
+		}
+		return nil
+	},
+}
+
+// imageHostAllowed host (หรือ host:port) อยู่ใน ANPR_WEBHOOK_IMAGE_HOSTS — กัน webhook ถูกใช้ยิง GET ไปเครื่องอื่นใน LAN
+func imageHostAllowed(u *url.URL) bool {
+	for _, h := range strings.Split(os.Getenv("ANPR_WEBHOOK_IMAGE_HOSTS"), ",") {
+		h = strings.ToLower(strings.TrimSpace(h))
+		if h != "" && (h == strings.ToLower(u.Host) || h == strings.ToLower(u.Hostname())) {
+			return true
+		}
+	}
+	return false
+}
+
+func loadImage(ctx context.Context, img *WebhookImage) ([]byte, error) {
+	if img == nil {
+		return nil, nil
+	}
+	if img.Base64 != "" {
+		return base64.StdEncoding.DecodeString(img.Base64)
+	}
+	if u, err := url.Parse(img.URL); err != nil || !imageHostAllowed(u) {
+		return nil, errors.New("host not allowed")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, img.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := imageClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET returned %d", resp.StatusCode)
+	}
+	var buf bytes.Buffer
+	n, err := io.Copy(&buf, io.LimitReader(resp.Body, maxImageFetch+1))
+	if err != nil {
+		return nil, err
+	}
+	if n > maxImageFetch {
+		return nil, fmt.Errorf("image larger than %dMB", maxImageFetch>>20)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,294 @@
+package barrier_v2
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"GO_LANG_WORKSPACE/internal/config"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// ---------- POST commands (idempotent) ----------
+//
+// GET /gate/open-barrier/... ถูก link prefetcher / retry ยิงซ้ำได้ → มี POST คู่กันที่:
+//   - รับ header Idempotency-Key: key เดิมภายใน BARRIER_IDEMPOTENCY_WINDOW_MS → ตอบผลเดิม ไม่สั่ง modbus ซ้ำ
+//   - รับ body {"reason": "..."} เก็บลง log
+//   - ตอบ command_id + result ทุกครั้ง
+//
+// BARRIER_GET_MODE ใช้กับ GET เดิม: allow | warn (default, ใส่ header Deprecation) | reject (405)
+
+func getIdempotencyWindow() time.Duration {
+	return time.Duration(getenvInt("BARRIER_IDEMPOTENCY_WINDOW_MS", 60000)) * time.Millisecond
+}
+func getGETMode() string {
+	return strings.ToLower(getenv("BARRIER_GET_MODE", "warn"))
+}
+
+type CommandRequest struct {
+	Reason string `json:"reason"`
+	Force  bool   `json:"force"`
+}
+
+type CommandResult struct {
+	CommandID string    `json:"command_id"`
+	Action    string    `json:"action"` // open | close
+	Location  string    `json:"location"`
+	Direction string    `json:"direction"`
+	Gate      string    `json:"gate"`
+	Reason    string    `json:"reason"`
+	Result    string    `json:"result"` // opened | closed | failed | rejected
+	At        time.Time `json:"at"`
+	Replayed  bool      `json:"replayed"`
+
+	httpStatus int
+	message    string
+}
+
+type idemEntry struct {
+	done chan struct{} // ปิดเมื่อคำสั่งแรกทำเสร็จ (retry ที่มาระหว่างนั้นรอผลเดียวกัน)
+	res  CommandResult
+	exp  time.Time
+}
+
+var (
+	idemMu    sync.Mutex
+	idemCache = map[string]*idemEntry{}
+)
+
+// claimIdempotency คืน entry เดิมถ้า key ยังไม่หมดอายุ (owner=false) หรือจองใหม่ (owner=true)
+func claimIdempotency(key string) (*idemEntry, bool) {
+	idemMu.Lock()
+	defer idemMu.Unlock()
+
+	now := time.Now()
+	for k, e := range idemCache {
+		if !e.exp.IsZero() && e.exp.Before(now) {
+			delete(idemCache, k)
+		}
+	}
+	if e, ok := idemCache[key]; ok {
+		return e, false
+	}
+	e := &idemEntry{done: make(chan struct{})}
+	idemCache[key] = e
+	return e, true
+}
+
+// finishIdempotency ส่งผลให้ retry ที่รออยู่ — เก็บไว้ทั้ง window เฉพาะผลที่จบแล้ว (2xx/4xx)
+// 5xx (modbus error) ลบ key ทิ้ง ให้ retry ด้วย key เดิมสั่งไม้กั้นใหม่ได้
+func finishIdempotency(key string, e *idemEntry, res CommandResult) {
+	idemMu.Lock()
+	e.res = res
+	e.exp = time.Now().Add(getIdempotencyWindow())
+	if res.httpStatus >= http.StatusInternalServerError && idemCache[key] == e {
+		delete(idemCache, key)
+	}
+	idemMu.Unlock()
+	close(e.done)
+}
+
+// coilFor coil ตาม action + location ให้ตรงกับ GET เดิม: ZONE ใช้ coil 1 ทั้งเปิด/ปิด, GATE/RESE ปิด = coil 4
+func coilFor(action, location string) int {
+	if action == "close" && location != "ZONE" {
+		return 4 // coil 4 = CLOSE
+	}
+	return 1 // coil 1 = OPEN (zone: toggle)
+}
+
+// command สร้าง handler POST สำหรับ action/location ที่กำหนด
+func command(action, location string) gin.HandlerFunc {
+	coil := coilFor(action, location)
+	return func(c *gin.Context) {
+		direction := c.Param("direction")
+		gate := c.Param("gate")
+
+		var in CommandRequest
+		if err := c.ShouldBindJSON(&in); err != nil && !errors.Is(err, io.EOF) { // body ว่างได้
+			c.JSON(http.StatusBadRequest, gin.H{"status": false, "message": err.Error()})
+			return
+		}
+
+		key := strings.TrimSpace(c.GetHeader("Idempotency-Key"))
+		if key == "" {
+			res := execCommand(action, location, direction, gate, coil, in)
+			respondCommand(c, res)
+			return
+		}
+
+		target := strings.Join([]string{action, location, direction, gate}, "|")
+		e, owner := claimIdempotency(target + "|" + key)
+		if !owner {
+			<-e.done
+			res := e.res
+			res.Replayed = true
+			log.Printf("[barrier-cmd] replay id=%s key=%s", res.CommandID, key)
+			c.Header("Idempotency-Replayed", "true")
+			respondCommand(c, res)
+			return
+		}
+
+		// defer: execCommand panic (gin.Recovery) ก็ยังปล่อย retry ที่รออยู่ — ได้ผล failed แทน
+		res := CommandResult{Action: action, Location: location, Direction: direction, Gate: gate, Reason: in.Reason,
+			Result: "failed", At: time.Now(), httpStatus: http.StatusInternalServerError, message: "command aborted"}
+		defer func() { finishIdempotency(target+"|"+key, e, res) }()
+		res = execCommand(action, location, direction, gate, coil, in)
+		respondCommand(c, res)
+	}
+}
+
+// Execute สั่งไม้กั้นจาก package อื่น (เช่นคำสั่งจาก kiosk ผ่าน WebSocket) — log + command_id แบบเดียวกับ POST
+// location: GATE | ZONE | RESE
+func Execute(action, location, direction, gate, reason string) (CommandResult, error) {
+	res := execCommand(action, location, direction, gate, coilFor(action, location), CommandRequest{Reason: reason})
+	if res.httpStatus != http.StatusOK {
+		return res, errors.New(res.message)
+	}
+	return res, nil
+}
+
+func execCommand(action, location, direction, gate string, coil int, in CommandRequest) CommandResult {
+	res := CommandResult{
+		CommandID: uuid.NewString(),
+		Action:    action,
+		Location:  location,
+		Direction: direction,
+		Gate:      gate,
+		Reason:    in.Reason,
+		Result:    "rejected",
+		At:        time.Now(),
+	}
+	defer func() {
+		log.Printf("[barrier-cmd] id=%s %s %s %s %s result=%s reason=%q",
+			res.CommandID, action, location, direction, gate, res.Result, res.Reason)
+	}()
+
+	switch {
+	case !reDirection.MatchString(direction):
+		res.httpStatus, res.message = http.StatusBadRequest, "invalid direction (ENT|EXT)"
+		return res
+	case !reGate.MatchString(gate):
+		res.httpStatus, res.message = http.StatusBadRequest, "invalid gate number"
+		return res
+	}
+
+	ip := getDeviceIP(direction, gate, location)
+	if ip == "" {
+		res.httpStatus, res.message = http.StatusNotFound, "IP not found for this gate"
+		return res
+	}
+	if action == "open" && !in.Force && currentMode(direction, location, gate) == config.ModeClosed {
+		res.httpStatus, res.message = http.StatusConflict, ErrGateClosed.Error()
+		return res
+	}
+
+	if err := toggleCoil(ip, coil); err != nil {
+		res.Result = "failed"
+		res.httpStatus, res.message = http.StatusInternalServerError, err.Error()
+		return res
+	}
+
+	res.Result = "opened"
+	if action == "close" {
+		res.Result = "closed"
+	}
+	res.httpStatus, res.message = http.StatusOK, res.Result
+	return res
+}
+
+func respondCommand(c *gin.Context, res CommandResult) {
+	c.JSON(res.httpStatus, gin.H{
+		"status":  res.httpStatus == http.StatusOK,
+		"message": res.message,
+		"data":    res,
+	})
+}
+
+// DeprecatedGET ครอบ GET เดิมตาม BARRIER_GET_MODE
+func DeprecatedGET() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		switch getGETMode() {
+		case "allow":
+		case "reject":
+			log.Printf("[barrier] rejected deprecated GET %s from %s", c.Request.URL.Path, c.ClientIP())
+			c.Header("Allow", http.MethodPost)
+			c.AbortWithStatusJSON(http.StatusMethodNotAllowed, gin.H{
+				"status":  false,
+				"message": "GET is disabled for barrier commands, use POST with Idempotency-Key",
+			})
+			return
+		default:
+			log.Printf("[barrier] deprecated GET %s from %s", c.Request.URL.Path, c.ClientIP())
+			c.Header("Deprecation", "true")
+			c.Header("Link", "<"+c.Request.URL.Path+">; rel=\"successor-version\"")
+		}
+		c.Next()
+	}
+}
+
+// OpenBarrierCommand godoc
+// @Summary      เปิดไม้กั้น (POST, idempotent)
+// @Description  เหมือน GET open-barrier แต่รับ Idempotency-Key — retry ด้วย key เดิมภายในช่วงเวลาจะได้ผลเดิมโดยไม่สั่งไม้กั้นซ้ำ
+// @Tags         barrier
+// @Accept       json
+// @Produce      json
+// @Param        direction        path      string          true   "ทิศทาง"  Enums(ENT,EXT)
+// @Param        gate             path      string          true   "หมายเลขประตู"
+// @Param        Idempotency-Key  header    string          false  "key สำหรับกันคำสั่งซ้ำ"
+// @Param        body             body      CommandRequest  false  "เหตุผล"
+// @Success      200              {object}  map[string]interface{}  "opened"
+// @Failure      400              {object}  map[string]interface{}  "invalid direction/gate"
+// @Failure      404              {object}  map[string]interface{}  "IP not found for this gate"
+// @Failure      409              {object}  map[string]interface{}  "gate closed by schedule"
+// @Failure      500              {object}  map[string]interface{}  "modbus error"
+// @Router       /api/v2-202402/gate/open-barrier/{direction}/{gate} [post]
+func OpenBarrierCommand(c *gin.Context) { command("open", "GATE")(c) }
+
+// CloseBarrierCommand godoc
+// @Summary      ปิดไม้กั้น (POST, idempotent)
+// @Description  เหมือน GET close-barrier แต่รับ Idempotency-Key
+// @Tags         barrier
+// @Accept       json
+// @Produce      json
+// @Param        direction        path      string          true   "ทิศทาง"  Enums(ENT,EXT)
+// @Param        gate             path      string          true   "หมายเลขประตู"
+// @Param        Idempotency-Key  header    string          false  "key สำหรับกันคำสั่งซ้ำ"
+// @Param        body             body      CommandRequest  false  "เหตุผล"
+// @Success      200              {object}  map[string]interface{}  "closed"
+// @Failure      400              {object}  map[string]interface{}  "invalid direction/gate"
+// @Failure      404              {object}  map[string]interface{}  "IP not found for this gate"
+// @Failure      500              {object}  map[string]interface{}  "modbus error"
+// @Router       /api/v2-202402/gate/close-barrier/{direction}/{gate} [post]
+func CloseBarrierCommand(c *gin.Context) { command("close", "GATE")(c) }
+
+// OpenZoningCommand godoc
+// @Summary      เปิดไม้กั้นโซน (POST, idempotent)
+// @Tags         barrier
+// @Accept       json
+// @Produce      json
+// @Param        direction        path      string          true   "ทิศทาง"  Enums(ENT,EXT)
+// @Param        gate             path      string          true   "หมายเลขประตู"
+// @Param        Idempotency-Key  header    string          false  "key สำหรับกันคำสั่งซ้ำ"
+// @Param        body             body      CommandRequest  false  "เหตุผล"
+// @Success      200              {object}  map[string]interface{}  "opened"
+// @Router       /api/v2-202402/gate/open-zoning/{direction}/{gate} [post]
+func OpenZoningCommand(c *gin.Context) { command("open", "ZONE")(c) }
+
+// CloseZoningCommand godoc
+// @Summary      ปิดไม้กั้นโซน (POST, idempotent)
+// @Tags         barrier
+// @Accept       json
+// @Produce      json
+// @Param        direction        path      string          true   "ทิศทาง"  Enums(ENT,EXT)
+// @Param        gate             path      string          true   "หมายเลขประตู"
+// @Param        Idempotency-Key  header    string          false  "key สำหรับกันคำสั่งซ้ำ"
+// @Param        body             body      CommandRequest  false  "เหตุผล"
+// @Success      200              {object}  map[string]interface{}  "closed"
+// @Router       /api/v2-202402/gate/close-zoning/{direction}/{gate} [post]
+func CloseZoningCommand(c *gin.Context) { command("close", "ZONE")(c) }
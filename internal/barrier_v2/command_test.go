@@ -0,0 +1,194 @@
+package barrier_v2
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// fakeModbus รับ Write Single Coil แล้วตอบ echo (fail = ตัด connection → modbus error) หลัง release ถูกปิด
+// คืนจำนวน connection ที่เข้ามา (= จำนวนครั้งที่สั่งไม้กั้นจริง)
+func fakeModbus(t *testing.T, fail bool, release <-chan struct{}) *atomic.Int32 {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	var conns atomic.Int32
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conns.Add(1)
+			go func() {
+				defer c.Close()
+				<-release
+				buf := make([]byte, 256)
+				for !fail {
+					n, err := c.Read(buf)
+					if err != nil {
+						return
+					}
+					c.Write(buf[:n])
+				}
+			}()
+		}
+	}()
+
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+	t.Setenv("MODBUS_PORT", port)
+	t.Setenv("MODBUS_PULSE_MS", "1")
+	t.Setenv("MODBUS_TIMEOUT_MS", "500")
+	t.Setenv("ENT_GATE_01", "127.0.0.1")
+	return &conns
+}
+
+// resetIdempotency ล้าง cache กลางของ package ให้แต่ละ test เริ่มใหม่ (go test -count=N)
+func resetIdempotency(t *testing.T) {
+	t.Helper()
+	idemMu.Lock()
+	idemCache = map[string]*idemEntry{}
+	idemMu.Unlock()
+}
+
+type commandResponse struct {
+	Status bool          `json:"status"`
+	Data   CommandResult `json:"data"`
+}
+
+func postCommand(t *testing.T, h gin.HandlerFunc, key string) (int, commandResponse, bool) {
+	t.Helper()
+	r := gin.New()
+	r.POST("/:direction/:gate", h)
+	req := httptest.NewRequest(http.MethodPost, "/ENT/1", strings.NewReader(`{"reason":"test"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Idempotency-Key", key)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	var out commandResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &out); err != nil {
+		t.Fatalf("decode response: %v (%s)", err, w.Body.String())
+	}
+	return w.Code, out, w.Header().Get("Idempotency-Replayed") == "true"
+}
+
+func TestCoilFor(t *testing.T) {
+	tests := []struct {
+		action, location string
+		want             int
+	}{
+		{"open", "GATE", 1},
+		{"close", "GATE", 4},
+		{"open", "RESE", 1},
+		{"close", "RESE", 4},
+		{"open", "ZONE", 1},
+		{"close", "ZONE", 1}, // zone ไม่มี coil ปิด — toggle
+	}
+	for _, tt := range tests {
+		if got := coilFor(tt.action, tt.location); got != tt.want {
+			t.Errorf("coilFor(%q, %q) = %d, want %d", tt.action, tt.location, got, tt.want)
+		}
+	}
+}
+
+func TestCommandIdempotency(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		name       string
+		fail       bool
+		wantStatus int
+		wantConns  int32 // หลังยิงพร้อมกันแล้ว retry อีกครั้งด้วย key เดิม
+		wantReplay bool  // retry หลังคำสั่งแรกจบได้ผลเดิม
+	}{
+		{"success is cached", false, http.StatusOK, 1, true},
+		{"modbus error is not cached", true, http.StatusInternalServerError, 2, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetIdempotency(t)
+			release := make(chan struct{})
+			conns := fakeModbus(t, tt.fail, release)
+			key := "k-" + strings.ReplaceAll(tt.name, " ", "-")
+			h := command("open", "GATE")
+
+			// retry พร้อมกันด้วย key เดียวกัน → สั่งไม้กั้นครั้งเดียว ทุกคนได้ command_id เดียวกัน
+			const n = 5
+			var wg sync.WaitGroup
+			codes := make([]int, n)
+			results := make([]commandResponse, n)
+			replayed := make([]bool, n)
+			for i := range n {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					codes[i], results[i], replayed[i] = postCommand(t, h, key)
+				}()
+			}
+			time.Sleep(100 * time.Millisecond) // ให้ทุก request จอง key ก่อนคำสั่งแรกจบ
+			close(release)
+			wg.Wait()
+
+			if got := conns.Load(); got != 1 {
+				t.Fatalf("concurrent retries reached modbus %d times, want 1", got)
+			}
+			replays := 0
+			for i := range n {
+				if codes[i] != tt.wantStatus {
+					t.Errorf("response %d: status %d, want %d", i, codes[i], tt.wantStatus)
+				}
+				if results[i].Data.CommandID != results[0].Data.CommandID {
+					t.Errorf("response %d: command_id %q, want %q", i, results[i].Data.CommandID, results[0].Data.CommandID)
+				}
+				if replayed[i] {
+					replays++
+				}
+			}
+			if replays != n-1 {
+				t.Errorf("replayed responses = %d, want %d", replays, n-1)
+			}
+
+			// retry หลังจบ: ผลสำเร็จตอบซ้ำจาก cache, 5xx สั่งไม้กั้นใหม่
+			code, res, replay := postCommand(t, h, key)
+			if code != tt.wantStatus || replay != tt.wantReplay {
+				t.Errorf("later retry: status %d replayed %v, want %d %v", code, replay, tt.wantStatus, tt.wantReplay)
+			}
+			if got := res.Data.CommandID == results[0].Data.CommandID; got != tt.wantReplay {
+				t.Errorf("later retry reused command_id = %v, want %v", got, tt.wantReplay)
+			}
+			if got := conns.Load(); got != tt.wantConns {
+				t.Errorf("modbus calls = %d, want %d", got, tt.wantConns)
+			}
+		})
+	}
+}
+
+func TestIdempotencyKeysAreIndependent(t *testing.T) {
+	resetIdempotency(t)
+	a, owner := claimIdempotency("test|a")
+	if !owner {
+		t.Fatal("first claim of a: want owner")
+	}
+	if _, owner := claimIdempotency("test|b"); !owner {
+		t.Error("first claim of b: want owner")
+	}
+	if e, owner := claimIdempotency("test|a"); owner || e != a {
+		t.Error("second claim of a: want the pending entry")
+	}
+	finishIdempotency("test|a", a, CommandResult{httpStatus: http.StatusConflict})
+	if _, owner := claimIdempotency("test|a"); owner {
+		t.Error("4xx result should stay cached for the window")
+	}
+}
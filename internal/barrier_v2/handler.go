@@ -6,8 +6,11 @@ import (
 	"os"
 	"regexp"
 	"strconv"
+	"strings"
 	"time"
 
+	"GO_LANG_WORKSPACE/internal/config"
+
 	"github.com/gin-gonic/gin"
 	"github.com/goburrow/modbus"
 )
@@ -27,6 +30,17 @@ func getenvInt(k string, def int) int {
 	}
 	return def
 }
+func getenvBool(k string, def bool) bool {
+	if v := os.Getenv(k); v != "" {
+		switch strings.ToLower(v) {
+		case "1", "true", "yes", "y", "on":
+			return true
+		case "0", "false", "no", "n", "off":
+			return false
+		}
+	}
+	return def
+}
 
 // ---------- Dynamic getters (อ่าน ENV ตอนเรียกใช้งาน) ----------
 func getModbusPort() string {
@@ -100,9 +114,11 @@ func toggleCoil(ip string, coilAddress int) error {
 // @Produce      json
 // @Param        direction  path      string  true  "ทิศทาง"  Enums(ENT,EXT)
 // @Param        gate       path      string  true  "หมายเลขประตู"
+// @Param        force      query     bool    false  "เปิดแม้ประตูปิดตามตารางเวลา"
 // @Success      200        {object}  map[string]interface{}  "opened"
 // @Failure      400        {object}  map[string]interface{}  "invalid direction/gate"
 // @Failure      404        {object}  map[string]interface{}  "IP not found for this gate"
+// @Failure      409        {object}  map[string]interface{}  "gate closed by schedule"
 // @Failure      500        {object}  map[string]interface{}  "modbus error"
 // @Router       /api/v2-202402/gate/open-barrier/{direction}/{gate} [get]
 func OpenBarrier(c *gin.Context) {
@@ -122,6 +138,11 @@ func OpenBarrier(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"status": false, "message": "IP not found for this gate"})
 		return
 	}
+	// ประตูปิดตามตารางเวลา → ต้องส่ง force=true ถึงจะเปิดมือได้
+	if currentMode(direction, "GATE", gate) == config.ModeClosed && c.Query("force") != "true" {
+		c.JSON(http.StatusConflict, gin.H{"status": false, "message": ErrGateClosed.Error()})
+		return
+	}
 	if err := toggleCoil(ip, 1); err != nil { // coil 1 = OPEN (ปรับตามหน้างาน)
 		c.JSON(http.StatusInternalServerError, gin.H{"status": false, "message": err.Error()})
 		return
@@ -176,9 +197,11 @@ func CloseBarrier(c *gin.Context) {
 // @Produce      json
 // @Param        direction  path      string  true  "ทิศทาง"  Enums(ENT,EXT)
 // @Param        gate       path      string  true  "หมายเลขประตู"
+// @Param        force      query     bool    false  "เปิดแม้ประตูปิดตามตารางเวลา"
 // @Success      200        {object}  map[string]interface{}  "opened"
 // @Failure      400        {object}  map[string]interface{}  "invalid direction/gate"
 // @Failure      404        {object}  map[string]interface{}  "IP not found for this gate"
+// @Failure      409        {object}  map[string]interface{}  "gate closed by schedule"
 // @Failure      500        {object}  map[string]interface{}  "modbus error"
 // @Router       /api/v2-202402/gate/open-zoning/{direction}/{gate} [get]
 func OpenZoning(c *gin.Context) {
@@ -200,6 +223,11 @@ func OpenZoning(c *gin.Context) {
 		return
 	}
 
+	// ประตูปิดตามตารางเวลา → ต้องส่ง force=true ถึงจะเปิดมือได้
+	if currentMode(direction, "ZONE", gate) == config.ModeClosed && c.Query("force") != "true" {
+		c.JSON(http.StatusConflict, gin.H{"status": false, "message": ErrGateClosed.Error()})
+		return
+	}
 	coil := 1
 	if err := toggleCoil(ip, coil); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"status": false, "message": err.Error()})
@@ -262,6 +290,9 @@ func OpenBarrierByGate(direction, gate string) error {
 	if ip == "" {
 		return fmt.Errorf("IP not found for gate %s %s", direction, gate)
 	}
+	if currentMode(direction, "GATE", gate) == config.ModeClosed {
+		return ErrGateClosed
+	}
 
 	if err := toggleCoil(ip, 1); err != nil {
 		return fmt.Errorf("failed to open barrier: %w", err)
@@ -283,6 +314,9 @@ func OpenZoningByGate(direction, gate string) error {
 	if ip == "" {
 		return fmt.Errorf("IP not found for zone %s %s", direction, gate)
 	}
+	if currentMode(direction, "ZONE", gate) == config.ModeClosed {
+		return ErrGateClosed
+	}
 
 	if err := toggleCoil(ip, 1); err != nil {
 		return fmt.Errorf("failed to open zone barrier: %w", err)
@@ -306,6 +340,9 @@ func OpenReserveBarrierByGate(direction, gate string) error {
 	if ip == "" {
 		return fmt.Errorf("IP not found for reserve barrier %s %s", direction, gate)
 	}
+	if currentMode(direction, "RESE", gate) == config.ModeClosed {
+		return ErrGateClosed
+	}
 
 	if err := toggleCoil(ip, 1); err != nil {
 		return fmt.Errorf("failed to open reserve barrier: %w", err)
@@ -0,0 +1,140 @@
+package barrier_v2
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/goburrow/modbus"
+)
+
+// ---------- Passage confirmation (loop detector หลังไม้กั้น) ----------
+//
+// หลังสั่งเปิดไม้กั้น เราเฝ้า discrete input ของ loop ขาออก:
+//   - loop "มีรถ" แล้วกลับเป็น "ว่าง" → ถือว่ารถผ่านแล้ว (passed)
+//   - ครบเวลา PASSAGE_TIMEOUT_MS แล้วยังไม่ครบรอบ → timeout
+//   - ไม่มี IP ของประตู / อ่าน loop ผ่าน Modbus ไม่ได้ → error (ไม่รู้ว่ารถผ่านหรือไม่)
+//
+// ENV:
+//   PASSAGE_CONFIRM=true        เปิดใช้การเฝ้า loop
+//   PASSAGE_LOOP_INPUT=0        address ของ discrete input ที่ต่อ loop
+//   PASSAGE_TIMEOUT_MS=30000    เวลารอรถผ่านสูงสุด
+//   PASSAGE_POLL_MS=200         รอบการอ่าน loop
+//   PASSAGE_AUTO_CLOSE=false    สั่งปิดไม้กั้น (coil 4) ทันทีที่ loop ว่าง
+
+const (
+	PassagePassed  = "passed"
+	PassageTimeout = "timeout"
+	PassageError   = "error"
+)
+
+func PassageEnabled() bool {
+	return getenvBool("PASSAGE_CONFIRM", false)
+}
+func getPassageLoopInput() uint16 {
+	return uint16(getenvInt("PASSAGE_LOOP_INPUT", 0))
+}
+func getPassageTimeout() time.Duration {
+	return time.Duration(getenvInt("PASSAGE_TIMEOUT_MS", 30000)) * time.Millisecond
+}
+func getPassagePoll() time.Duration {
+	return time.Duration(getenvInt("PASSAGE_POLL_MS", 200)) * time.Millisecond
+}
+func getPassageAutoClose() bool {
+	return getenvBool("PASSAGE_AUTO_CLOSE", false)
+}
+
+// PassageRef ผูกการเปิดไม้กั้นเข้ากับรถ/transaction ที่สั่งเปิด
+type PassageRef struct {
+	Plate string
+	UUID  string
+}
+
+// PassageEvent ผลการเฝ้า loop หลังเปิดไม้กั้น
+type PassageEvent struct {
+	Event      string    `json:"event"` // passed | timeout | error
+	Direction  string    `json:"direction"`
+	Gate       string    `json:"gate"`
+	Plate      string    `json:"license_plate"`
+	UUID       string    `json:"uuid"`
+	OpenedAt   time.Time `json:"opened_at"`
+	At         time.Time `json:"at"`
+	AutoClosed bool      `json:"auto_closed"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// WatchPassage เฝ้า loop ของไม้กั้นจนรถผ่านหรือหมดเวลา (blocking — ให้ caller เรียกใน goroutine)
+func WatchPassage(direction, gate, location string, ref PassageRef, openedAt time.Time) PassageEvent {
+	ev := PassageEvent{
+		Event:     PassageTimeout,
+		Direction: direction,
+		Gate:      gate,
+		Plate:     ref.Plate,
+		UUID:      ref.UUID,
+		OpenedAt:  openedAt,
+	}
+
+	ip := getDeviceIP(direction, gate, location)
+	if ip == "" {
+		ev.At = time.Now()
+		ev.Event, ev.Error = PassageError, fmt.Sprintf("IP not found for %s %s %s", direction, location, gate)
+		return ev
+	}
+
+	passed, err := waitLoopCycle(ip, openedAt.Add(getPassageTimeout()))
+	ev.At = time.Now()
+	if err != nil {
+		ev.Event, ev.Error = PassageError, err.Error()
+		return ev
+	}
+	if !passed {
+		return ev
+	}
+	ev.Event = PassagePassed
+
+	if getPassageAutoClose() {
+		if err := toggleCoil(ip, 4); err != nil { // coil 4 = CLOSE
+			log.Printf("[passage] auto-close %s %s failed: %v", direction, gate, err)
+		} else {
+			ev.AutoClosed = true
+		}
+	}
+	return ev
+}
+
+// waitLoopCycle อ่าน loop จนเห็น "มีรถ → ว่าง" ครบหนึ่งรอบ หรือเลย deadline
+func waitLoopCycle(ip string, deadline time.Time) (bool, error) {
+	addr := fmt.Sprintf("%s:%s", ip, getModbusPort())
+
+	h := modbus.NewTCPClientHandler(addr)
+	h.Timeout = getModbusTimeout()
+	h.SlaveId = getModbusSlaveID()
+
+	if err := h.Connect(); err != nil {
+		return false, fmt.Errorf("modbus connect: %w", err)
+	}
+	defer h.Close()
+
+	client := modbus.NewClient(h)
+	input := getPassageLoopInput()
+	poll := getPassagePoll()
+
+	occupied := false
+	for time.Now().Before(deadline) {
+		res, err := client.ReadDiscreteInputs(input, 1)
+		if err != nil {
+			return false, fmt.Errorf("read loop input: %w", err)
+		}
+		active := len(res) > 0 && res[0]&0x01 == 0x01
+
+		switch {
+		case active:
+			occupied = true
+		case occupied:
+			// เคยมีรถบน loop และตอนนี้ว่างแล้ว → ผ่าน
+			return true, nil
+		}
+		time.Sleep(poll)
+	}
+	return false, nil
+}
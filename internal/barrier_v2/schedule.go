@@ -0,0 +1,136 @@
+package barrier_v2
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"GO_LANG_WORKSPACE/internal/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ErrGateClosed ประตูถูกปิดตามตารางเวลา (SCHEDULE_*)
+var ErrGateClosed = errors.New("gate closed by schedule")
+
+func getScheduleInterval() time.Duration {
+	return time.Duration(getenvInt("SCHEDULE_CHECK_MS", 30000)) * time.Millisecond
+}
+
+// gateState mode ปัจจุบันของแต่ละประตูที่ scheduler เห็นล่าสุด
+type gateState struct {
+	Mode  config.GateMode `json:"mode"`
+	Since time.Time       `json:"since"`
+}
+
+var (
+	scheduleMu    sync.RWMutex
+	scheduleState = map[string]gateState{}
+)
+
+func gateKey(direction, location, gate string) string {
+	return direction + "_" + location + "_" + pad2(gate)
+}
+
+// RunScheduler เช็คตารางเวลาเป็นรอบ ๆ แล้วสั่งไม้กั้นเมื่อ mode เปลี่ยน
+//   - เข้า free-flow → เปิดค้าง (coil 1)
+//   - ออกจาก free-flow / เข้า closed → ปิด (coil 4, zone toggle coil 1)
+//
+// mode ใหม่บันทึกเมื่อสั่งไม้กั้นสำเร็จเท่านั้น — สั่งไม่ได้ รอบหน้าลองใหม่
+func RunScheduler(ctx context.Context) {
+	tick := time.NewTicker(getScheduleInterval())
+	defer tick.Stop()
+
+	applySchedules(time.Now())
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-tick.C:
+			applySchedules(now)
+		}
+	}
+}
+
+func applySchedules(now time.Time) {
+	for _, g := range config.ConfiguredGates() {
+		mode := config.GateModeAt(g.Direction, g.Location, g.Gate, now)
+		key := gateKey(g.Direction, g.Location, g.Gate)
+
+		scheduleMu.RLock()
+		prev, seen := scheduleState[key]
+		scheduleMu.RUnlock()
+		if seen && prev.Mode == mode {
+			continue
+		}
+
+		var action string
+		if seen || mode != config.ModeNormal { // เริ่มระบบในโหมดปกติ ไม่ต้องขยับไม้กั้น
+			log.Printf("[schedule] %s: %s → %s", key, prev.Mode, mode)
+			switch {
+			case mode == config.ModeFreeFlow:
+				action = "open"
+			case mode == config.ModeClosed || prev.Mode == config.ModeFreeFlow:
+				action = "close"
+			}
+		}
+		if action != "" {
+			coil := coilFor(action, g.Location) // zone ไม่มี coil ปิด — toggle coil 1
+			if err := toggleCoil(g.IP, coil); err != nil {
+				// ไม่บันทึก mode ใหม่ → รอบหน้าสั่งซ้ำ
+				log.Printf("[schedule] %s: toggle coil %d failed: %v", key, coil, err)
+				continue
+			}
+		}
+
+		scheduleMu.Lock()
+		scheduleState[key] = gateState{Mode: mode, Since: now}
+		scheduleMu.Unlock()
+	}
+}
+
+// currentMode mode ของประตู (ใช้ค่าจาก scheduler ถ้ามี ไม่งั้นคำนวณสด)
+func currentMode(direction, location, gate string) config.GateMode {
+	scheduleMu.RLock()
+	st, ok := scheduleState[gateKey(direction, location, gate)]
+	scheduleMu.RUnlock()
+	if ok {
+		return st.Mode
+	}
+	return config.GateModeAt(direction, location, gate, time.Now())
+}
+
+// GateStatus godoc
+// @Summary      สถานะประตูทั้งหมด
+// @Description  รายการไม้กั้นที่ตั้งค่าไว้ พร้อม mode ตามตารางเวลา (normal, free-flow, closed, reservation-only)
+// @Tags         barrier
+// @Produce      json
+// @Success      200  {object}  map[string]interface{}
+// @Router       /api/v2-202402/gate/status [get]
+func GateStatus(c *gin.Context) {
+	now := time.Now()
+	out := make([]gin.H, 0)
+	for _, g := range config.ConfiguredGates() {
+		scheduleMu.RLock()
+		st, ok := scheduleState[gateKey(g.Direction, g.Location, g.Gate)]
+		scheduleMu.RUnlock()
+		if !ok {
+			st = gateState{Mode: config.GateModeAt(g.Direction, g.Location, g.Gate, now)}
+		}
+		item := gin.H{
+			"direction": g.Direction,
+			"location":  g.Location,
+			"gate":      g.Gate,
+			"ip":        g.IP,
+			"mode":      st.Mode,
+		}
+		if !st.Since.IsZero() {
+			item["since"] = st.Since.Format(time.RFC3339)
+		}
+		out = append(out, item)
+	}
+	c.JSON(http.StatusOK, gin.H{"status": true, "message": "ok", "data": out})
+}
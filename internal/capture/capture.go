@@ -0,0 +1,217 @@
+package capture
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ---------- Camera request capture ----------
+//
+// เก็บ request ดิบของกล้อง (multipart/JSON ทั้งก้อน + header) ลงดิสก์ เพื่อ replay ซ้ำภายหลัง
+// ไม่ต้องรอรถคันเดิมกลับมาเพื่อไล่บั๊ก และเก็บเป็น fixture ได้
+//   <CAPTURE_DIR>/2026-10-18/<unixnano>-<route>-g<gate>.http   (รูปแบบ HTTP/1.1 — อ่านด้วย http.ReadRequest)
+//
+// ENV:
+//   CAPTURE_ENABLED=false
+//   CAPTURE_DIR=./data/capture
+//   CAPTURE_ROUTES=                  เช่น gate_out,zoning_exit (ว่าง = ทุก route)
+//   CAPTURE_MAX_MB=1024              ขนาดรวมสูงสุด เกินแล้วลบไฟล์เก่าสุด
+
+const (
+	maxCaptureBody = int64(16 << 20) // เท่ากับ limit ของ anpr.Parse
+	fileSuffix     = ".http"
+
+	// header ที่เพิ่มในไฟล์ (replay ตัดออกก่อนส่ง)
+	headerTime   = "X-Capture-Time"
+	headerRemote = "X-Capture-Remote"
+	headerRoute  = "X-Capture-Route"
+)
+
+var (
+	seq         atomic.Uint64
+	janitorOnce sync.Once
+)
+
+// Enabled CAPTURE_ENABLED (default false)
+func Enabled() bool {
+	v := strings.ToLower(os.Getenv("CAPTURE_ENABLED"))
+	return v == "1" || v == "true" || v == "yes"
+}
+
+func dir() string {
+	if v := os.Getenv("CAPTURE_DIR"); v != "" {
+		return v
+	}
+	return filepath.Join("data", "capture")
+}
+
+func wanted(route string) bool {
+	list := strings.TrimSpace(os.Getenv("CAPTURE_ROUTES"))
+	if list == "" {
+		return true
+	}
+	for _, r := range strings.Split(list, ",") {
+		if strings.TrimSpace(r) == route {
+			return true
+		}
+	}
+	return false
+}
+
+// Save เขียน request ลงดิสก์แล้วคืน body ให้อ่านต่อได้ตามเดิม (ไม่ได้เปิด / route ไม่อยู่ใน CAPTURE_ROUTES = ไม่ทำอะไร)
+func Save(r *http.Request, route string) {
+	if !Enabled() || !wanted(route) || r.Body == nil {
+		return
+	}
+	janitorOnce.Do(func() { go janitor() })
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxCaptureBody+1))
+	if err != nil || int64(len(body)) > maxCaptureBody {
+		// อ่านไม่จบ/ใหญ่เกิน — ไม่เก็บ แต่ต้องคืน body ให้ parser เห็น error แบบเดิม
+		r.Body = readCloser{io.MultiReader(bytes.NewReader(body), errReader{err}, r.Body), r.Body}
+		return
+	}
+	r.Body = readCloser{bytes.NewReader(body), r.Body}
+
+	now := time.Now()
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%s %s HTTP/1.1\r\n", r.Method, r.URL.RequestURI())
+	fmt.Fprintf(&buf, "Host: %s\r\n", r.Host)
+	h := r.Header.Clone()
+	h.Del("Transfer-Encoding")
+	h.Set("Content-Length", strconv.Itoa(len(body)))
+	h.Set(headerTime, now.Format(time.RFC3339Nano))
+	h.Set(headerRemote, r.RemoteAddr)
+	h.Set(headerRoute, route)
+	_ = h.Write(&buf)
+	buf.WriteString("\r\n")
+	buf.Write(body)
+
+	day := filepath.Join(dir(), now.Format("2006-01-02"))
+	if err := os.MkdirAll(day, 0o755); err != nil {
+		log.Printf("[capture] %v", err)
+		return
+	}
+	gate := r.URL.Query().Get("gate_no")
+	name := filepath.Join(day, fmt.Sprintf("%020d-%03d-%s-g%s%s", now.UnixNano(), seq.Add(1)%1000, route, safe(gate), fileSuffix))
+	if err := os.WriteFile(name, buf.Bytes(), 0o644); err != nil {
+		log.Printf("[capture] %v", err)
+	}
+}
+
+// Load อ่านไฟล์ capture กลับเป็น request (body อยู่ในหน่วยความจำ) + เวลาที่รับ
+func Load(name string) (*http.Request, time.Time, error) {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	req, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(b)))
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("%s: %w", filepath.Base(name), err)
+	}
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("%s: %w", filepath.Base(name), err)
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	req.ContentLength = int64(len(body))
+
+	at, _ := time.Parse(time.RFC3339Nano, req.Header.Get(headerTime))
+	return req, at, nil
+}
+
+// Files ไฟล์ capture ทั้งหมดใน path (ไฟล์เดียวหรือ directory ซ้อนกันได้) เรียงตามเวลาที่รับ
+func Files(paths ...string) ([]string, error) {
+	var out []string
+	for _, p := range paths {
+		err := filepath.WalkDir(p, func(path string, d os.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.IsDir() && strings.HasSuffix(path, fileSuffix) {
+				out = append(out, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	// ชื่อไฟล์ขึ้นต้นด้วย unixnano → เรียงตามชื่อไฟล์ = ตามเวลา
+	sort.Slice(out, func(i, j int) bool { return filepath.Base(out[i]) < filepath.Base(out[j]) })
+	return out, nil
+}
+
+// janitor ลบไฟล์เก่าสุดเมื่อขนาดรวมเกิน CAPTURE_MAX_MB
+func janitor() {
+	t := time.NewTicker(10 * time.Minute)
+	defer t.Stop()
+	for {
+		prune()
+		<-t.C
+	}
+}
+
+func prune() {
+	maxBytes := int64(1024) << 20
+	if n, err := strconv.Atoi(os.Getenv("CAPTURE_MAX_MB")); err == nil && n > 0 {
+		maxBytes = int64(n) << 20
+	}
+	files, err := Files(dir())
+	if err != nil {
+		return
+	}
+	sizes := make([]int64, len(files))
+	var total int64
+	for i, f := range files {
+		if fi, err := os.Stat(f); err == nil {
+			sizes[i] = fi.Size()
+			total += fi.Size()
+		}
+	}
+	removed := 0
+	for i := 0; i < len(files) && total > maxBytes; i++ {
+		if os.Remove(files[i]) == nil {
+			total -= sizes[i]
+			removed++
+		}
+	}
+	if removed > 0 {
+		log.Printf("[capture] removed %d old file(s) (CAPTURE_MAX_MB)", removed)
+	}
+}
+
+func safe(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r == '_' || r == '-' {
+			return r
+		}
+		return -1
+	}, s)
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+type errReader struct{ err error }
+
+func (e errReader) Read([]byte) (int, error) {
+	if e.err == nil {
+		return 0, io.EOF
+	}
+	return 0, e.err
+}
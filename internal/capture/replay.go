@@ -0,0 +1,163 @@
+package capture
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// ---------- replay subcommand ----------
+//
+//   server replay [flags] <file|dir> ...
+//
+//   -target http://127.0.0.1:8000   ปลายทาง (ใช้ path + query เดิมของ request)
+//   -path   /api/v2-202402/order/verify-license-plate-out   ส่งเข้า endpoint อื่นแทน path เดิม
+//   -gate   1=3,2=4                 เปลี่ยน gate_no (query และเลขท้าย path ของ /api/v3/anpr)
+//   -speed  1                       1 = ระยะห่างเท่าตอนจริง, 10 = เร็วขึ้น 10 เท่า, 0 = ส่งติดกัน
+//   -dry                            แสดงอย่างเดียว ไม่ส่ง
+
+// ReplayMain ตัว subcommand — คืน exit code
+func ReplayMain(args []string) int {
+	fs := flag.NewFlagSet("replay", flag.ContinueOnError)
+	target := fs.String("target", "http://127.0.0.1:8000", "base URL ปลายทาง")
+	path := fs.String("path", "", "ส่งเข้า path นี้แทน path เดิม")
+	gates := fs.String("gate", "", "เปลี่ยนหมายเลขประตู เช่น 1=3,2=4")
+	speed := fs.Float64("speed", 1, "ตัวคูณความเร็ว (0 = ไม่เว้นระยะ)")
+	dry := fs.Bool("dry", false, "แสดงอย่างเดียว ไม่ส่ง")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: server replay [flags] <file|dir> ...")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+	base, err := url.Parse(*target)
+	if err != nil || base.Host == "" {
+		fmt.Fprintf(os.Stderr, "invalid -target %q\n", *target)
+		return 2
+	}
+	gateMap, err := parseGateMap(*gates)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	files, err := Files(fs.Args()...)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if len(files) == 0 {
+		fmt.Fprintln(os.Stderr, "no capture files found")
+		return 1
+	}
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	var prev time.Time
+	failed := 0
+	for _, name := range files {
+		req, at, err := Load(name)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			failed++
+			continue
+		}
+		if *speed > 0 && !prev.IsZero() && at.After(prev) {
+			time.Sleep(time.Duration(float64(at.Sub(prev)) / *speed))
+		}
+		if !at.IsZero() {
+			prev = at
+		}
+
+		u := rewriteURL(base, req.URL, *path, gateMap)
+		fmt.Printf("%s %s %s", at.Format("15:04:05.000"), req.Method, u)
+		if *dry {
+			fmt.Println()
+			continue
+		}
+		status, body, err := send(client, req, u)
+		if err != nil {
+			fmt.Printf(" → error: %v\n", err)
+			failed++
+			continue
+		}
+		fmt.Printf(" → %d %s\n", status, strings.TrimSpace(body))
+		if status >= 300 {
+			failed++
+		}
+	}
+	fmt.Printf("replayed %d file(s), %d failed\n", len(files), failed)
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+func send(client *http.Client, orig *http.Request, u string) (int, string, error) {
+	body, _ := io.ReadAll(orig.Body)
+	req, err := http.NewRequest(orig.Method, u, bytes.NewReader(body))
+	if err != nil {
+		return 0, "", err
+	}
+	for k, vs := range orig.Header {
+		if strings.HasPrefix(k, "X-Capture-") || k == "Content-Length" {
+			continue
+		}
+		req.Header[k] = vs
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+	b, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	return resp.StatusCode, string(b), nil
+}
+
+// rewriteURL base + path/query ของ request เดิม (หรือ -path) แล้วเปลี่ยน gate ตาม -gate
+func rewriteURL(base, orig *url.URL, path string, gateMap map[string]string) string {
+	u := *base
+	u.Path = orig.Path
+	if path != "" {
+		u.Path = path
+	}
+	q := orig.Query()
+	if g, ok := gateMap[q.Get("gate_no")]; ok {
+		q.Set("gate_no", g)
+	}
+	u.RawQuery = q.Encode()
+	// webhook: /api/v3/anpr/:gate_type/:gate_no
+	if strings.HasPrefix(u.Path, "/api/v3/anpr/") {
+		if i := strings.LastIndex(u.Path, "/"); i >= 0 {
+			if g, ok := gateMap[u.Path[i+1:]]; ok {
+				u.Path = u.Path[:i+1] + g
+			}
+		}
+	}
+	return u.String()
+}
+
+func parseGateMap(s string) (map[string]string, error) {
+	m := map[string]string{}
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		from, to, ok := strings.Cut(pair, "=")
+		if !ok || strings.TrimSpace(from) == "" || strings.TrimSpace(to) == "" {
+			return nil, fmt.Errorf("invalid -gate %q (want from=to)", pair)
+		}
+		m[strings.TrimSpace(from)] = strings.TrimSpace(to)
+	}
+	return m, nil
+}
@@ -1,11 +1,13 @@
 package config
 
 import (
+	"crypto/subtle"
 	"fmt"
 	"log"
 	"net"
 	"net/http"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -156,3 +158,45 @@ func durEnv(key string, def time.Duration) time.Duration {
 	}
 	return def
 }
+
+// AdminAuthMiddleware ป้องกัน /api/admin ด้วย ADMIN_TOKEN (header X-Admin-Token หรือ Authorization: Bearer)
+// ไม่ตั้ง ADMIN_TOKEN → ปิด admin API ทั้งหมด
+func AdminAuthMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		want := os.Getenv("ADMIN_TOKEN")
+		if want == "" {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"status": false, "message": "admin api disabled (ADMIN_TOKEN not set)"})
+			return
+		}
+		got := c.GetHeader("X-Admin-Token")
+		if got == "" {
+			got = strings.TrimSpace(strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer "))
+		}
+		if subtle.ConstantTimeCompare([]byte(got), []byte(want)) != 1 {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"status": false, "message": "invalid admin token"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// WebhookAuthMiddleware ป้องกัน /api/v3/anpr ด้วย ANPR_WEBHOOK_TOKEN (header X-Webhook-Token หรือ Authorization: Bearer)
+// webhook สั่งเปิดไม้กั้นได้ → ไม่ตั้ง ANPR_WEBHOOK_TOKEN = ปิด webhook
+func WebhookAuthMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		want := os.Getenv("ANPR_WEBHOOK_TOKEN")
+		if want == "" {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"status": false, "message": "anpr webhook disabled (ANPR_WEBHOOK_TOKEN not set)"})
+			return
+		}
+		got := c.GetHeader("X-Webhook-Token")
+		if got == "" {
+			got = strings.TrimSpace(strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer "))
+		}
+		if subtle.ConstantTimeCompare([]byte(got), []byte(want)) != 1 {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"status": false, "message": "invalid webhook token"})
+			return
+		}
+		c.Next()
+	}
+}
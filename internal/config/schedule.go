@@ -0,0 +1,246 @@
+package config
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ---------- Gate schedules ----------
+//
+// ตั้งค่าต่อประตูด้วย key แบบเดียวกับ IP ของไม้กั้น นำหน้าด้วย SCHEDULE_
+//   SCHEDULE_EXT_GATE_01="mon-fri 07:00-09:00 free-flow; * 22:00-06:00 closed; sat,sun * reservation-only"
+//
+// แต่ละกฎคือ "<วัน> <ช่วงเวลา> <mode>" คั่นด้วย ; — อ่านจากซ้ายไปขวา กฎแรกที่ match ชนะ
+//   วัน:  *, mon, mon-fri, sat,sun
+//   เวลา: *, HH:MM-HH:MM (ข้ามเที่ยงคืนได้ เช่น 22:00-06:00 — เช็ควันจากวันปัจจุบัน)
+// ไม่ match กฎไหนเลย → normal
+
+type GateMode string
+
+const (
+	ModeNormal          GateMode = "normal"
+	ModeFreeFlow        GateMode = "free-flow"
+	ModeClosed          GateMode = "closed"
+	ModeReservationOnly GateMode = "reservation-only"
+)
+
+// ShouldOpen ตัดสินว่าจะเปิดไม้กั้นไหม จากผล Cloud + mode ของประตู
+func (m GateMode) ShouldOpen(cloudOK, reservation bool) bool {
+	switch m {
+	case ModeClosed:
+		return false
+	case ModeFreeFlow:
+		return true
+	case ModeReservationOnly:
+		return reservation && cloudOK
+	default:
+		return cloudOK
+	}
+}
+
+// Message ข้อความสำหรับ broadcast เมื่อ mode ทับผลปกติ
+func (m GateMode) Message() string {
+	switch m {
+	case ModeClosed:
+		return "gate closed by schedule"
+	case ModeFreeFlow:
+		return "free-flow by schedule"
+	case ModeReservationOnly:
+		return "reservation only"
+	default:
+		return ""
+	}
+}
+
+type scheduleRule struct {
+	days     [7]bool
+	from, to int // นาทีนับจากเที่ยงคืน; allDay = from==to==-1
+	mode     GateMode
+}
+
+type Schedule []scheduleRule
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// ParseSchedule แปลง spec จาก ENV เป็นกฎ
+func ParseSchedule(spec string) (Schedule, error) {
+	var out Schedule
+	for _, raw := range strings.Split(spec, ";") {
+		fields := strings.Fields(raw)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("rule %q: want \"<days> <time> <mode>\"", strings.TrimSpace(raw))
+		}
+
+		var r scheduleRule
+		if err := parseDays(fields[0], &r.days); err != nil {
+			return nil, fmt.Errorf("rule %q: %w", strings.TrimSpace(raw), err)
+		}
+		from, to, err := parseWindow(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("rule %q: %w", strings.TrimSpace(raw), err)
+		}
+		r.from, r.to = from, to
+
+		switch m := GateMode(strings.ToLower(fields[2])); m {
+		case ModeNormal, ModeFreeFlow, ModeClosed, ModeReservationOnly:
+			r.mode = m
+		default:
+			return nil, fmt.Errorf("rule %q: unknown mode %q", strings.TrimSpace(raw), fields[2])
+		}
+		out = append(out, r)
+	}
+	return out, nil
+}
+
+// ModeAt คืน mode ณ เวลา t (กฎแรกที่ตรงชนะ)
+// ช่วงข้ามเที่ยงคืน เช่น "fri 23:00-05:00" ส่วนหลังเที่ยงคืนนับเป็นของวันที่เริ่ม (เสาร์ 02:00 ตรงกฎของศุกร์)
+func (s Schedule) ModeAt(t time.Time) GateMode {
+	min := t.Hour()*60 + t.Minute()
+	today, yesterday := t.Weekday(), (t.Weekday()+6)%7
+	for _, r := range s {
+		switch {
+		case r.from < 0:
+			if r.days[today] {
+				return r.mode
+			}
+		case r.from <= r.to:
+			if r.days[today] && min >= r.from && min < r.to {
+				return r.mode
+			}
+		default:
+			if (r.days[today] && min >= r.from) || (r.days[yesterday] && min < r.to) {
+				return r.mode
+			}
+		}
+	}
+	return ModeNormal
+}
+
+func parseDays(s string, days *[7]bool) error {
+	if s == "*" {
+		for i := range days {
+			days[i] = true
+		}
+		return nil
+	}
+	for _, part := range strings.Split(strings.ToLower(s), ",") {
+		if a, b, ok := strings.Cut(part, "-"); ok {
+			from, ok1 := weekdays[a]
+			to, ok2 := weekdays[b]
+			if !ok1 || !ok2 {
+				return fmt.Errorf("invalid day range %q", part)
+			}
+			for d := from; ; d = (d + 1) % 7 {
+				days[d] = true
+				if d == to {
+					break
+				}
+			}
+			continue
+		}
+		d, ok := weekdays[part]
+		if !ok {
+			return fmt.Errorf("invalid day %q", part)
+		}
+		days[d] = true
+	}
+	return nil
+}
+
+func parseWindow(s string) (int, int, error) {
+	if s == "*" {
+		return -1, -1, nil
+	}
+	a, b, ok := strings.Cut(s, "-")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid time window %q", s)
+	}
+	from, err := parseClock(a)
+	if err != nil {
+		return 0, 0, err
+	}
+	to, err := parseClock(b)
+	if err != nil {
+		return 0, 0, err
+	}
+	return from, to, nil
+}
+
+func parseClock(s string) (int, error) {
+	h, m, ok := strings.Cut(s, ":")
+	if !ok {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+	hh, err1 := strconv.Atoi(h)
+	mm, err2 := strconv.Atoi(m)
+	if err1 != nil || err2 != nil || hh < 0 || hh > 24 || mm < 0 || mm > 59 || (hh == 24 && mm != 0) {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+	return hh*60 + mm, nil
+}
+
+// ---------- Lookup (อ่าน ENV ตอนเรียกใช้งาน) ----------
+
+func scheduleKey(direction, location, gate string) string {
+	return fmt.Sprintf("SCHEDULE_%s_%s_%02s", strings.ToUpper(direction), strings.ToUpper(location), gate)
+}
+
+// GateModeAt คืน mode ของประตู ณ เวลา t (location: GATE | ZONE | RESE)
+func GateModeAt(direction, location, gate string, t time.Time) GateMode {
+	spec := os.Getenv(scheduleKey(direction, location, gate))
+	if strings.TrimSpace(spec) == "" {
+		return ModeNormal
+	}
+	s, err := ParseSchedule(spec)
+	if err != nil {
+		log.Printf("[schedule] %s: %v", scheduleKey(direction, location, gate), err)
+		return ModeNormal
+	}
+	return s.ModeAt(t)
+}
+
+// GateRef ประตูหนึ่งบาน (ระบุด้วย key ENV แบบ ENT_GATE_01)
+type GateRef struct {
+	Direction string `json:"direction"`
+	Location  string `json:"location"`
+	Gate      string `json:"gate"`
+	IP        string `json:"ip"`
+}
+
+var reGateKey = regexp.MustCompile(`^(ENT|EXT)_(GATE|ZONE|RESE)_([0-9]+)$`)
+
+// ConfiguredGates ไล่หาไม้กั้นทุกตัวที่ตั้ง IP ไว้ใน ENV
+func ConfiguredGates() []GateRef {
+	var out []GateRef
+	for _, kv := range os.Environ() {
+		k, v, _ := strings.Cut(kv, "=")
+		m := reGateKey.FindStringSubmatch(k)
+		if m == nil || strings.TrimSpace(v) == "" {
+			continue
+		}
+		out = append(out, GateRef{Direction: m[1], Location: m[2], Gate: m[3], IP: v})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		a, b := out[i], out[j]
+		if a.Location != b.Location {
+			return a.Location < b.Location
+		}
+		if a.Gate != b.Gate {
+			return a.Gate < b.Gate
+		}
+		return a.Direction < b.Direction
+	})
+	return out
+}
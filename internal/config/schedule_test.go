@@ -0,0 +1,112 @@
+package config
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// 2026-10-12 เป็นวันจันทร์
+func at(day int, hhmm string) time.Time {
+	t, err := time.ParseInLocation("2006-01-02 15:04", fmt.Sprintf("2026-10-%02d %s", day, hhmm), time.Local)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestScheduleModeAt(t *testing.T) {
+	tests := []struct {
+		name string
+		spec string
+		t    time.Time
+		want GateMode
+	}{
+		{"empty spec", "", at(12, "10:00"), ModeNormal},
+		{"weekday range inside", "mon-fri 07:00-09:00 free-flow", at(14, "08:30"), ModeFreeFlow},
+		{"weekday range start inclusive", "mon-fri 07:00-09:00 free-flow", at(12, "07:00"), ModeFreeFlow},
+		{"weekday range end exclusive", "mon-fri 07:00-09:00 free-flow", at(16, "09:00"), ModeNormal},
+		{"weekday range excludes saturday", "mon-fri 07:00-09:00 free-flow", at(17, "08:00"), ModeNormal},
+		{"day range wraps week", "fri-mon * closed", at(18, "12:00"), ModeClosed},
+		{"day range wraps week excludes tuesday", "fri-mon * closed", at(13, "12:00"), ModeNormal},
+		{"day list", "sat,sun * reservation-only", at(18, "03:00"), ModeReservationOnly},
+		{"overnight before midnight", "* 22:00-06:00 closed", at(12, "23:30"), ModeClosed},
+		{"overnight after midnight", "* 22:00-06:00 closed", at(13, "05:59"), ModeClosed},
+		{"overnight end exclusive", "* 22:00-06:00 closed", at(13, "06:00"), ModeNormal},
+		{"overnight daytime", "* 22:00-06:00 closed", at(13, "12:00"), ModeNormal},
+		{"overnight carries into next day", "fri 23:00-05:00 closed", at(17, "02:00"), ModeClosed},
+		{"overnight not on start day morning", "fri 23:00-05:00 closed", at(16, "02:00"), ModeNormal},
+		{"overnight start day evening", "fri 23:00-05:00 closed", at(16, "23:10"), ModeClosed},
+		{"until 24:00", "mon 18:00-24:00 free-flow", at(12, "23:59"), ModeFreeFlow},
+		{"first rule wins", "mon-fri 07:00-09:00 free-flow; * 06:00-10:00 closed", at(12, "08:00"), ModeFreeFlow},
+		{"falls through to later rule", "mon-fri 07:00-09:00 free-flow; * 06:00-10:00 closed", at(12, "06:30"), ModeClosed},
+		{"explicit normal overrides later rule", "sun * normal; * 22:00-06:00 closed", at(18, "23:00"), ModeNormal},
+		{"case insensitive", "MON-Fri 07:00-09:00 FREE-FLOW", at(12, "08:00"), ModeFreeFlow},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := ParseSchedule(tt.spec)
+			if err != nil {
+				t.Fatalf("ParseSchedule(%q): %v", tt.spec, err)
+			}
+			if got := s.ModeAt(tt.t); got != tt.want {
+				t.Errorf("ModeAt(%s) = %q, want %q", tt.t.Format("Mon 15:04"), got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseScheduleErrors(t *testing.T) {
+	for _, spec := range []string{
+		"mon 07:00-09:00",              // ไม่มี mode
+		"mon 07:00-09:00 open",         // mode ไม่รู้จัก
+		"funday 07:00-09:00 closed",    // วันผิด
+		"mon-xyz 07:00-09:00 closed",   // ช่วงวันผิด
+		"mon 0700-0900 closed",         // เวลาไม่มี :
+		"mon 07:00 closed",             // ไม่มีช่วง
+		"mon 25:00-26:00 closed",       // ชั่วโมงเกิน
+		"mon 24:30-01:00 closed",       // 24 ได้แค่ 24:00
+		"mon 07:60-09:00 closed",       // นาทีเกิน
+		"mon 07:00-09:00 closed extra", // field เกิน
+	} {
+		if _, err := ParseSchedule(spec); err == nil {
+			t.Errorf("ParseSchedule(%q): want error", spec)
+		}
+	}
+}
+
+func TestGateModeAtEnv(t *testing.T) {
+	t.Setenv("SCHEDULE_EXT_GATE_01", "* 22:00-06:00 closed")
+	if got := GateModeAt("EXT", "GATE", "1", at(13, "01:00")); got != ModeClosed {
+		t.Errorf("gate 1 = %q, want closed", got)
+	}
+	if got := GateModeAt("EXT", "GATE", "2", at(13, "01:00")); got != ModeNormal {
+		t.Errorf("gate 2 = %q, want normal", got)
+	}
+
+	t.Setenv("SCHEDULE_EXT_GATE_03", "bogus")
+	if got := GateModeAt("EXT", "GATE", "03", at(13, "01:00")); got != ModeNormal {
+		t.Errorf("invalid spec = %q, want normal", got)
+	}
+}
+
+func TestShouldOpen(t *testing.T) {
+	tests := []struct {
+		mode              GateMode
+		cloudOK, reserved bool
+		want              bool
+	}{
+		{ModeNormal, true, false, true},
+		{ModeNormal, false, false, false},
+		{ModeFreeFlow, false, false, true},
+		{ModeClosed, true, true, false},
+		{ModeReservationOnly, true, false, false},
+		{ModeReservationOnly, true, true, true},
+		{ModeReservationOnly, false, true, false},
+	}
+	for _, tt := range tests {
+		if got := tt.mode.ShouldOpen(tt.cloudOK, tt.reserved); got != tt.want {
+			t.Errorf("%s.ShouldOpen(%v, %v) = %v, want %v", tt.mode, tt.cloudOK, tt.reserved, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package events
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"GO_LANG_WORKSPACE/internal/media"
+)
+
+// ---------- Event envelope ----------
+//
+// ทุก broadcast ใช้รูปแบบเดียวกัน:
+//   {"type":"exit.verified","schema_version":1,"room":"gate_out_1","gate":"1","direction":"EXT",
+//    "timestamp":"...","request_id":"...","payload":{...}}
+//
+// ENV:
+//   WS_LEGACY_ROOMS="gate_in_*,reserve_*"  ห้องที่ยังส่งรูปแบบเดิม (ก่อนมี envelope) — pattern แบบ path.Match
+//     default "*" = ทุกห้องยังเป็นรูปแบบเดิม, ตั้งเป็น "-" = ทุกห้องใช้ envelope
+//   WS_INLINE_IMAGE_ROOMS="gate_in_*"  ห้องที่ยังได้รูปเป็น base64 ในข้อความ (ที่เหลือได้ signed URL จาก /media)
+//     default "*" = inline ทุกห้อง, "-" = URL ทุกห้อง
+
+// SchemaVersion เพิ่มเมื่อเปลี่ยน payload แบบไม่ backward compatible
+const SchemaVersion = 1
+
+type Envelope struct {
+	Type          string    `json:"type"`
+	SchemaVersion int       `json:"schema_version"`
+	Room          string    `json:"room"`
+	Gate          string    `json:"gate"`
+	Direction     string    `json:"direction"` // ENT | EXT
+	Timestamp     time.Time `json:"timestamp"`
+	RequestID     string    `json:"request_id,omitempty"`
+	Payload       any       `json:"payload"`
+}
+
+// New สร้าง envelope ของ event
+func New(eventType, room, gate, direction, requestID string, payload any) Envelope {
+	return Envelope{
+		Type:          eventType,
+		SchemaVersion: SchemaVersion,
+		Room:          room,
+		Gate:          gate,
+		Direction:     direction,
+		Timestamp:     time.Now(),
+		RequestID:     requestID,
+		Payload:       payload,
+	}
+}
+
+// Broadcaster ปลายทางของ event (ws.Hub)
+type Broadcaster interface {
+	Broadcast(room string, data []byte)
+}
+
+// Publisher ส่ง event เข้าห้อง — เลือกรูปแบบ envelope หรือแบบเดิมตาม WS_LEGACY_ROOMS
+type Publisher struct {
+	out          Broadcaster
+	legacy       []string
+	inlineImages []string
+}
+
+func NewPublisher(out Broadcaster) *Publisher {
+	return &Publisher{
+		out:          out,
+		legacy:       roomPatterns("WS_LEGACY_ROOMS"),
+		inlineImages: roomPatterns("WS_INLINE_IMAGE_ROOMS"),
+	}
+}
+
+// roomPatterns อ่านรายการ pattern จาก env (ไม่ตั้ง = "*", "-" = ไม่มี)
+func roomPatterns(key string) []string {
+	spec, ok := os.LookupEnv(key)
+	if !ok {
+		spec = "*"
+	}
+	var out []string
+	for _, p := range strings.Split(spec, ",") {
+		if p = strings.TrimSpace(p); p != "" && p != "-" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+func matchRoom(patterns []string, room string) bool {
+	for _, pat := range patterns {
+		if pat == "*" || pat == room {
+			return true
+		}
+		if ok, _ := path.Match(pat, room); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Legacy true ถ้าห้องนี้ยังรับรูปแบบเดิม
+func (p *Publisher) Legacy(room string) bool {
+	return matchRoom(p.legacy, room)
+}
+
+// InlineImages true ถ้าห้องนี้ยังรับรูปเป็น base64
+func (p *Publisher) InlineImages(room string) bool {
+	return matchRoom(p.inlineImages, room)
+}
+
+// Publish ส่ง env เข้าห้อง env.Room; ห้อง legacy ได้ legacy แทน (nil = ส่ง envelope เสมอ)
+func (p *Publisher) Publish(env Envelope, legacy any) {
+	var msg any = env
+	if legacy != nil && p.Legacy(env.Room) {
+		msg = legacy
+	}
+	b, err := json.Marshal(msg)
+	if err != nil {
+		log.Printf("[events] marshal %s for %s failed: %v", env.Type, env.Room, err)
+		return
+	}
+	if !p.InlineImages(env.Room) {
+		b = media.Default().RewriteJSON(b)
+	}
+	p.out.Broadcast(env.Room, b)
+}
@@ -0,0 +1,130 @@
+package events
+
+import "strings"
+
+// ---------- Event types ----------
+
+const (
+	TypeEntryVerified   = "entry.verified"   // gate_in_N: อ่านป้ายขาเข้า + ผล verify-member
+	TypeExitVerified    = "exit.verified"    // gate_out_N: อ่านป้ายขาออก + ผลค่าจอด
+	TypeReserveEntry    = "reserve.entry"    // reserve_in_N
+	TypeReserveExit     = "reserve.exit"     // reserve_out_N
+	TypeZoningEntry     = "zoning.entry"     // entrance:ZONE:N
+	TypeZoningExit      = "zoning.exit"      // exit:ZONE:N
+	TypeVehiclePassage  = "vehicle.passage"  // ผลจาก loop หลังเปิดไม้กั้น
+	TypePlateCorrected  = "plate.corrected"  // พนักงานแก้ป้ายจาก kiosk
+	TypePlateUnreadable = "plate.unreadable" // กล้องอ่านป้ายไม่ได้ (unknown)
+	TypePlateDuplicate  = "plate.duplicate"  // กล้องส่งป้ายซ้ำ — ไม่ได้ทำอะไรต่อ (DEDUP_BROADCAST)
+)
+
+// Vehicle ข้อมูลรถที่อ่านได้จากกล้อง
+type Vehicle struct {
+	LicensePlate      string     `json:"license_plate"`
+	UUID              string     `json:"uuid,omitempty"`
+	TimeIn            string     `json:"time_in,omitempty"`
+	VehicleType       int        `json:"vehicle_type,omitempty"`
+	LicensePlateImage string     `json:"license_plate_img_base64,omitempty"`
+	ANPR              *PlateMeta `json:"anpr,omitempty"`
+}
+
+// PlateMeta metadata ของการอ่านป้ายจากกล้อง (ค่าที่กล้องไม่ส่งมาเว้นว่าง)
+type PlateMeta struct {
+	Confidence   float64 `json:"confidence,omitempty"` // 0-100
+	PlateColor   string  `json:"plate_color,omitempty"`
+	PlateType    string  `json:"plate_type,omitempty"`
+	Country      string  `json:"country,omitempty"`
+	Region       string  `json:"region,omitempty"`    // จังหวัด/ภูมิภาคที่กล้องอ่านได้
+	Direction    string  `json:"direction,omitempty"` // forward | reverse
+	VehicleColor string  `json:"vehicle_color,omitempty"`
+	VehicleBrand string  `json:"vehicle_brand,omitempty"`
+	VehicleModel string  `json:"vehicle_model,omitempty"`
+	PlateRect    *Rect   `json:"plate_rect,omitempty"` // ตำแหน่งป้ายในรูป (normalized 0-1 หรือ pixel ตามกล้อง)
+}
+
+// Rect กรอบป้ายในรูป
+type Rect struct {
+	X      float64 `json:"x"`
+	Y      float64 `json:"y"`
+	Width  float64 `json:"width"`
+	Height float64 `json:"height"`
+}
+
+// Decision ผลการตัดสินใจของประตู
+type Decision struct {
+	Status   bool   `json:"status"`
+	Message  string `json:"message,omitempty"`
+	GateMode string `json:"gate_mode,omitempty"` // มีเฉพาะเมื่อไม่ใช่ normal
+	Offline  bool   `json:"offline,omitempty"`   // ตัดสินจาก offline cache (Cloud ไม่ตอบ)
+}
+
+type EntryVerified struct {
+	Vehicle
+	Decision
+	CustID any `json:"cust_id,omitempty"`
+	EfID   any `json:"ef_id,omitempty"`
+}
+
+type ExitVerified struct {
+	Vehicle
+	Decision
+	Images  map[string]string `json:"images,omitempty"`  // รูปจากกล้องภาพรวม (key ตาม host)
+	Cloud   map[string]any    `json:"cloud,omitempty"`   // response เต็มจาก cloud (ค่าจอด ฯลฯ)
+	Barrier string            `json:"barrier,omitempty"` // opened | failed | closed (ตารางเวลา) — แยกจากผล Cloud
+}
+
+type ReserveVerified struct {
+	Vehicle
+	Decision
+	Cloud map[string]any `json:"cloud,omitempty"`
+}
+
+type ZoningTransition struct {
+	Vehicle
+	Decision
+	ZoningCode string         `json:"zoning_code"`
+	Cloud      map[string]any `json:"cloud,omitempty"`
+}
+
+type PlateUnreadable struct {
+	Vehicle
+	ZoningCode string `json:"zoning_code,omitempty"`
+	ReadPlate  string `json:"read_plate,omitempty"` // ป้ายที่กล้องอ่านได้แต่ความมั่นใจต่ำกว่า ANPR_MIN_CONFIDENCE
+}
+
+type PlateDuplicate struct {
+	Vehicle
+	Reason    string `json:"reason"` // uuid | plate
+	FirstSeen string `json:"first_seen"`
+}
+
+type VehiclePassage struct {
+	Event        string `json:"event"` // passed | timeout | error
+	LicensePlate string `json:"license_plate"`
+	UUID         string `json:"uuid,omitempty"`
+	OpenedAt     string `json:"opened_at"`
+	AutoClosed   bool   `json:"auto_closed"`
+	Error        string `json:"error,omitempty"` // event=error: ไม่มี IP / อ่าน loop ไม่ได้
+}
+
+type PlateCorrected struct {
+	LicensePlate  string `json:"license_plate"`
+	OriginalPlate string `json:"original_plate,omitempty"`
+	UUID          string `json:"uuid,omitempty"`
+	CorrectedBy   string `json:"corrected_by"`
+}
+
+// FromCloud อ่าน status / message จาก response ของ cloud ({"status":true,"message":"..."})
+func FromCloud(res map[string]any) Decision {
+	var d Decision
+	switch v := res["status"].(type) {
+	case bool:
+		d.Status = v
+	case string:
+		d.Status = strings.EqualFold(v, "true")
+	case float64:
+		d.Status = v != 0
+	}
+	d.Message, _ = res["message"].(string)
+	d.Offline, _ = res["offline"].(bool)
+	return d
+}
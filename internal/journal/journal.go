@@ -0,0 +1,381 @@
+package journal
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"GO_LANG_WORKSPACE/internal/events"
+)
+
+// ---------- Local event journal ----------
+//
+// บันทึกทุกป้ายที่กล้องส่งมา + สิ่งที่ทำกับมัน (Cloud request/response, ไม้กั้น, LED, เวลาแต่ละขั้น)
+// ลงไฟล์ JSONL วันละไฟล์ — ไว้พิสูจน์เมื่อ Cloud บอกว่ารถไม่เคยเข้า
+//   <JOURNAL_DIR>/events-2026-10-18.jsonl
+//
+// ENV:
+//   JOURNAL_ENABLED=true
+//   JOURNAL_DIR=./data/journal
+//   JOURNAL_RETENTION=720h        ลบไฟล์ที่เก่ากว่านี้ (30 วัน)
+//   JOURNAL_MAX_MB=512            ขนาดรวมสูงสุด เกินแล้วลบไฟล์เก่าสุด (ไม่ลบไฟล์วันนี้)
+
+const (
+	segmentPrefix = "events-"
+	segmentSuffix = ".jsonl"
+	dayLayout     = "2006-01-02"
+	maxRawBytes   = 64 << 10 // body ของ Cloud ที่ยาวกว่านี้ตัดทิ้ง (กัน base64 รูปหลุดเข้ามา)
+)
+
+// Entry หนึ่งบรรทัดของ journal = ป้ายหนึ่งครั้งที่ประตูหนึ่ง
+type Entry struct {
+	Time      time.Time         `json:"time"` // เวลาที่รับจากกล้อง
+	Route     string            `json:"route"`
+	Direction string            `json:"direction"`
+	Gate      string            `json:"gate"`
+	Zoning    string            `json:"zoning,omitempty"`
+	Plate     string            `json:"plate"`
+	RawPlate  string            `json:"raw_plate,omitempty"`
+	UUID      string            `json:"uuid,omitempty"`
+	Source    string            `json:"source,omitempty"` // hikvision | dahua | webhook
+	CameraIP  string            `json:"camera_ip,omitempty"`
+	RequestID string            `json:"request_id,omitempty"`
+	ANPR      *events.PlateMeta `json:"anpr,omitempty"`
+	Outcome   string            `json:"outcome"` // ok | duplicate | error
+	Error     string            `json:"error,omitempty"`
+	Cloud     []CloudCall       `json:"cloud,omitempty"`
+	Barrier   []BarrierAction   `json:"barrier,omitempty"`
+	LED       []LEDOutput       `json:"led,omitempty"`
+	Timings   []Timing          `json:"timings,omitempty"`
+	TotalMs   int64             `json:"total_ms"`
+}
+
+// CloudCall request/response ของ Cloud หนึ่งครั้ง
+type CloudCall struct {
+	Method   string          `json:"method"`
+	URL      string          `json:"url"`
+	Request  json.RawMessage `json:"request,omitempty"`
+	Status   int             `json:"status,omitempty"`
+	Response json.RawMessage `json:"response,omitempty"`
+	Error    string          `json:"error,omitempty"`
+	Ms       int64           `json:"ms"`
+}
+
+// BarrierAction ผลสั่งไม้กั้น
+type BarrierAction struct {
+	Action string `json:"action"` // เช่น open_gate, open_reserve, open_zone
+	OK     bool   `json:"ok"`
+	Error  string `json:"error,omitempty"`
+}
+
+// LEDOutput ข้อความที่ส่งขึ้นป้าย LED
+type LEDOutput struct {
+	Host  string `json:"host"`
+	Text  string `json:"text"`
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+type Timing struct {
+	Step string `json:"step"`
+	Ms   int64  `json:"ms"`
+}
+
+// Raw แปลงค่าเป็น JSON สำหรับเก็บ (ยาวเกิน maxRawBytes เก็บแค่ขนาด) — marshal ทันทีเพราะ map อาจถูกแก้ทีหลัง
+func Raw(v any) json.RawMessage {
+	switch x := v.(type) {
+	case nil:
+		return nil
+	case json.RawMessage:
+		v = []byte(x)
+	}
+	var b []byte
+	if raw, ok := v.([]byte); ok {
+		b = raw
+		if !json.Valid(b) {
+			b, _ = json.Marshal(string(raw))
+		}
+	} else {
+		var err error
+		if b, err = json.Marshal(v); err != nil {
+			b, _ = json.Marshal(err.Error())
+		}
+	}
+	if len(b) > maxRawBytes {
+		b, _ = json.Marshal(fmt.Sprintf("<%d bytes truncated>", len(b)))
+	}
+	return b
+}
+
+// Filter เงื่อนไขค้น journal
+type Filter struct {
+	Plate  string // ตรงกับ plate หรือ raw_plate บางส่วน (ไม่สนตัวพิมพ์)
+	Gate   string
+	Route  string
+	Zoning string
+	UUID   string
+	From   time.Time // zero = ไม่จำกัด
+	To     time.Time
+	Limit  int // default 100, สูงสุด 1000
+}
+
+func (f *Filter) match(e *Entry) bool {
+	if f.Plate != "" {
+		p := strings.ToLower(f.Plate)
+		if !strings.Contains(strings.ToLower(e.Plate), p) && !strings.Contains(strings.ToLower(e.RawPlate), p) {
+			return false
+		}
+	}
+	if f.Gate != "" && strings.TrimLeft(e.Gate, "0") != strings.TrimLeft(f.Gate, "0") {
+		return false
+	}
+	if f.Route != "" && e.Route != f.Route {
+		return false
+	}
+	if f.Zoning != "" && e.Zoning != f.Zoning {
+		return false
+	}
+	if f.UUID != "" && e.UUID != f.UUID {
+		return false
+	}
+	if !f.From.IsZero() && e.Time.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && e.Time.After(f.To) {
+		return false
+	}
+	return true
+}
+
+// Store journal บนดิสก์
+type Store struct {
+	mu        sync.Mutex
+	dir       string
+	retention time.Duration
+	maxBytes  int64
+
+	day  string
+	file *os.File
+}
+
+var (
+	defaultOnce  sync.Once
+	defaultStore *Store
+)
+
+// Default store ของทั้ง process (nil ถ้า JOURNAL_ENABLED=false)
+func Default() *Store {
+	defaultOnce.Do(func() {
+		if v := strings.ToLower(os.Getenv("JOURNAL_ENABLED")); v == "false" || v == "0" || v == "no" {
+			log.Println("[journal] disabled")
+			return
+		}
+		defaultStore = NewStoreFromEnv()
+		go defaultStore.janitor()
+	})
+	return defaultStore
+}
+
+func NewStoreFromEnv() *Store {
+	dir := os.Getenv("JOURNAL_DIR")
+	if dir == "" {
+		dir = filepath.Join("data", "journal")
+	}
+	return &Store{
+		dir:       dir,
+		retention: getenvDuration("JOURNAL_RETENTION", 30*24*time.Hour),
+		maxBytes:  int64(getenvInt("JOURNAL_MAX_MB", 512)) << 20,
+	}
+}
+
+// Append เขียน entry ต่อท้ายไฟล์ของวันนั้น
+func (s *Store) Append(e Entry) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	day := time.Now().Format(dayLayout)
+	if s.file == nil || s.day != day {
+		if s.file != nil {
+			s.file.Close()
+			s.file = nil
+		}
+		if err := os.MkdirAll(s.dir, 0o755); err != nil {
+			return err
+		}
+		f, err := os.OpenFile(s.segment(day), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return err
+		}
+		s.file, s.day = f, day
+	}
+	if _, err := s.file.Write(b); err != nil {
+		return err
+	}
+	return s.file.Sync()
+}
+
+// Query คืน entry ที่ตรงเงื่อนไข ใหม่ → เก่า
+func (s *Store) Query(f Filter) ([]Entry, error) {
+	if f.Limit <= 0 {
+		f.Limit = 100
+	}
+	if f.Limit > 1000 {
+		f.Limit = 1000
+	}
+	days, err := s.days()
+	if err != nil {
+		return nil, err
+	}
+	out := []Entry{}
+	for i := len(days) - 1; i >= 0 && len(out) < f.Limit; i-- {
+		day := days[i]
+		// ข้ามไฟล์ที่อยู่นอกช่วงเวลา (เผื่อ timezone ±1 วัน)
+		if t, err := time.ParseInLocation(dayLayout, day, time.Local); err == nil {
+			if !f.From.IsZero() && t.Add(48*time.Hour).Before(f.From) {
+				break
+			}
+			if !f.To.IsZero() && t.Add(-24*time.Hour).After(f.To) {
+				continue
+			}
+		}
+		matches, err := s.scan(day, &f)
+		if err != nil {
+			return nil, err
+		}
+		for j := len(matches) - 1; j >= 0 && len(out) < f.Limit; j-- {
+			out = append(out, matches[j])
+		}
+	}
+	return out, nil
+}
+
+func (s *Store) scan(day string, f *Filter) ([]Entry, error) {
+	file, err := os.Open(s.segment(day))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var out []Entry
+	sc := bufio.NewScanner(file)
+	sc.Buffer(make([]byte, 64<<10), 4<<20)
+	for sc.Scan() {
+		var e Entry
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			continue // บรรทัดที่เขียนไม่จบ (ไฟดับกลางทาง)
+		}
+		if f.match(&e) {
+			out = append(out, e)
+		}
+	}
+	return out, sc.Err()
+}
+
+func (s *Store) segment(day string) string {
+	return filepath.Join(s.dir, segmentPrefix+day+segmentSuffix)
+}
+
+// days วันที่มีไฟล์ เก่า → ใหม่
+func (s *Store) days() ([]string, error) {
+	names, err := filepath.Glob(filepath.Join(s.dir, segmentPrefix+"*"+segmentSuffix))
+	if err != nil {
+		return nil, err
+	}
+	days := make([]string, 0, len(names))
+	for _, n := range names {
+		days = append(days, strings.TrimSuffix(strings.TrimPrefix(filepath.Base(n), segmentPrefix), segmentSuffix))
+	}
+	sort.Strings(days)
+	return days, nil
+}
+
+// prune ลบไฟล์เกิน retention แล้วลบไฟล์เก่าสุดจนขนาดรวมไม่เกิน maxBytes
+func (s *Store) prune() {
+	days, err := s.days()
+	if err != nil {
+		return
+	}
+	today := time.Now().Format(dayLayout)
+	cutoff := time.Now().Add(-s.retention)
+
+	type seg struct {
+		day  string
+		size int64
+	}
+	var segs []seg
+	var total int64
+	for _, day := range days {
+		if day == today {
+			if fi, err := os.Stat(s.segment(day)); err == nil {
+				total += fi.Size()
+			}
+			continue
+		}
+		if t, err := time.ParseInLocation(dayLayout, day, time.Local); err == nil && s.retention > 0 && t.Add(24*time.Hour).Before(cutoff) {
+			s.remove(day, "retention")
+			continue
+		}
+		if fi, err := os.Stat(s.segment(day)); err == nil {
+			segs = append(segs, seg{day, fi.Size()})
+			total += fi.Size()
+		}
+	}
+	for _, sg := range segs {
+		if s.maxBytes <= 0 || total <= s.maxBytes {
+			break
+		}
+		s.remove(sg.day, "size limit")
+		total -= sg.size
+	}
+}
+
+func (s *Store) remove(day, reason string) {
+	if err := os.Remove(s.segment(day)); err != nil {
+		log.Printf("[journal] remove %s: %v", day, err)
+		return
+	}
+	log.Printf("[journal] removed %s (%s)", filepath.Base(s.segment(day)), reason)
+}
+
+func (s *Store) janitor() {
+	s.prune()
+	t := time.NewTicker(time.Hour)
+	defer t.Stop()
+	for range t.C {
+		s.prune()
+	}
+}
+
+func getenvInt(k string, def int) int {
+	if v := os.Getenv(k); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			return n
+		}
+	}
+	return def
+}
+
+func getenvDuration(k string, def time.Duration) time.Duration {
+	if v := os.Getenv(k); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			return d
+		}
+	}
+	return def
+}
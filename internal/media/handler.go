@@ -0,0 +1,37 @@
+package media
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Serve godoc
+// @Summary      รูปจากกล้อง (signed URL)
+// @Description  URL ได้จาก field *_url ใน broadcast — หมดอายุตาม MEDIA_TTL
+// @Tags         media
+// @Produce      image/jpeg
+// @Param        id     path   string  true   "media id"
+// @Param        exp    query  string  true   "เวลาหมดอายุ (unix)"
+// @Param        sig    query  string  true   "ลายเซ็น"
+// @Param        thumb  query  string  false  "1 = ภาพย่อ"
+// @Success      200
+// @Failure      403  {object}  map[string]interface{}  "invalid or expired signature"
+// @Failure      404  {object}  map[string]interface{}  "media not found"
+// @Router       /media/{id} [get]
+func Serve(c *gin.Context) {
+	s := Default()
+	id := c.Param("id")
+	if !s.Verify(id, c.Query("exp"), c.Query("sig")) {
+		c.JSON(http.StatusForbidden, gin.H{"status": false, "message": "invalid or expired signature"})
+		return
+	}
+	data, contentType, ok := s.Get(id, c.Query("thumb") == "1")
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"status": false, "message": "media not found"})
+		return
+	}
+	c.Header("Cache-Control", "private, max-age="+strconv.Itoa(int(s.ttl.Seconds())))
+	c.Data(http.StatusOK, contentType, data)
+}
@@ -0,0 +1,80 @@
+package media
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+)
+
+// ---------- base64 → URL ----------
+//
+// field รูปใน broadcast (license_plate_img_base64, driver_img_base_64, lpr_out, license_plate_out, driver_out
+// และ key ที่ลงท้าย _base64) ถูกแทนด้วย <ชื่อ>_url + <ชื่อ>_thumb_url ส่วน field base64 เดิมถูกลบ
+
+var imageKeys = map[string]bool{
+	"lpr_out":           true,
+	"license_plate_out": true,
+	"driver_out":        true,
+}
+
+// isImageKey true ถ้า key นี้เป็นรูป base64 — คืนชื่อฐานสำหรับ field URL
+func isImageKey(k string) (string, bool) {
+	for _, suffix := range []string{"_base64", "_base_64"} {
+		if strings.HasSuffix(k, suffix) {
+			return strings.TrimSuffix(k, suffix), true
+		}
+	}
+	if imageKeys[k] {
+		return k, true
+	}
+	return "", false
+}
+
+// RewriteJSON แทนรูป base64 ใน JSON ด้วย signed URL (ไม่ใช่ JSON → คืนตามเดิม)
+func (s *Store) RewriteJSON(data []byte) []byte {
+	var v any
+	if err := json.Unmarshal(data, &v); err != nil {
+		return data
+	}
+	if !s.rewrite(v) {
+		return data
+	}
+	out, err := json.Marshal(v)
+	if err != nil {
+		return data
+	}
+	return out
+}
+
+func (s *Store) rewrite(v any) bool {
+	changed := false
+	switch x := v.(type) {
+	case map[string]any:
+		for k, val := range x {
+			if str, ok := val.(string); ok {
+				if base, ok := isImageKey(k); ok && str != "" {
+					raw, err := base64.StdEncoding.DecodeString(str)
+					if err != nil || len(raw) == 0 {
+						continue
+					}
+					id := s.Put(raw, "")
+					delete(x, k)
+					x[base+"_url"] = s.URL(id, false)
+					x[base+"_thumb_url"] = s.URL(id, true)
+					changed = true
+				}
+				continue
+			}
+			if s.rewrite(val) {
+				changed = true
+			}
+		}
+	case []any:
+		for _, val := range x {
+			if s.rewrite(val) {
+				changed = true
+			}
+		}
+	}
+	return changed
+}
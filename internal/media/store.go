@@ -0,0 +1,251 @@
+package media
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"image"
+	"image/jpeg"
+	_ "image/png"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ---------- Media store ----------
+//
+// เก็บรูปจากกล้องไว้ในหน่วยความจำชั่วคราว แล้วส่ง URL แบบ signed ให้ kiosk แทน base64
+//   GET /media/:id?exp=<unix>&sig=<hmac>[&thumb=1]
+//
+// ENV:
+//   MEDIA_TTL=10m            อายุรูป (และอายุลายเซ็น URL)
+//   MEDIA_MAX_MB=256         ขนาดรวมสูงสุด เกินแล้วทิ้งรูปเก่าสุด
+//   MEDIA_SECRET=...         key สำหรับเซ็น URL (ไม่ตั้ง = สุ่มตอน start; URL เก่าใช้ไม่ได้หลัง restart)
+//   MEDIA_BASE_URL=http://10.10.22.5:8000   ใส่หน้า /media/... (ไม่ตั้ง = path อย่างเดียว)
+//   MEDIA_THUMB_WIDTH=320
+
+type item struct {
+	id          string
+	data        []byte
+	contentType string
+	created     time.Time
+	exp         time.Time
+
+	thumbOnce sync.Once
+	thumb     []byte
+}
+
+type Store struct {
+	mu    sync.Mutex
+	items map[string]*item
+	order []string // เก่า → ใหม่ (ใช้ตอนเกินขนาด)
+	bytes int
+
+	ttl        time.Duration
+	maxBytes   int
+	secret     []byte
+	baseURL    string
+	thumbWidth int
+}
+
+var (
+	defaultOnce  sync.Once
+	defaultStore *Store
+)
+
+// Default store ของทั้ง process (สร้างจาก env ครั้งแรกที่เรียก)
+func Default() *Store {
+	defaultOnce.Do(func() {
+		defaultStore = NewStoreFromEnv()
+		go defaultStore.janitor()
+	})
+	return defaultStore
+}
+
+func NewStoreFromEnv() *Store {
+	s := &Store{
+		items:      map[string]*item{},
+		ttl:        getenvDuration("MEDIA_TTL", 10*time.Minute),
+		maxBytes:   getenvInt("MEDIA_MAX_MB", 256) << 20,
+		baseURL:    strings.TrimRight(os.Getenv("MEDIA_BASE_URL"), "/"),
+		thumbWidth: getenvInt("MEDIA_THUMB_WIDTH", 320),
+	}
+	if secret := os.Getenv("MEDIA_SECRET"); secret != "" {
+		s.secret = []byte(secret)
+	} else {
+		s.secret = make([]byte, 32)
+		_, _ = rand.Read(s.secret)
+	}
+	return s
+}
+
+// Put เก็บรูปแล้วคืน id
+func (s *Store) Put(data []byte, contentType string) string {
+	if contentType == "" {
+		contentType = http.DetectContentType(data)
+	}
+	now := time.Now()
+	it := &item{
+		id:          newID(),
+		data:        data,
+		contentType: contentType,
+		created:     now,
+		exp:         now.Add(s.ttl),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.items[it.id] = it
+	s.order = append(s.order, it.id)
+	s.bytes += len(data)
+	for s.bytes > s.maxBytes && len(s.order) > 1 {
+		s.evictLocked(s.order[0])
+	}
+	return it.id
+}
+
+// URL คืน URL แบบ signed ของรูป (thumb = ภาพย่อ)
+func (s *Store) URL(id string, thumb bool) string {
+	s.mu.Lock()
+	it, ok := s.items[id]
+	s.mu.Unlock()
+	if !ok {
+		return ""
+	}
+	exp := strconv.FormatInt(it.exp.Unix(), 10)
+	q := url.Values{}
+	q.Set("exp", exp)
+	q.Set("sig", s.sign(id, exp))
+	if thumb {
+		q.Set("thumb", "1")
+	}
+	return s.baseURL + "/media/" + id + "?" + q.Encode()
+}
+
+// Verify ตรวจลายเซ็น + วันหมดอายุของ URL
+func (s *Store) Verify(id, exp, sig string) bool {
+	n, err := strconv.ParseInt(exp, 10, 64)
+	if err != nil || time.Now().Unix() > n {
+		return false
+	}
+	return hmac.Equal([]byte(sig), []byte(s.sign(id, exp)))
+}
+
+// Get คืนรูป (thumb = ภาพย่อ, สร้างครั้งแรกที่ขอ)
+func (s *Store) Get(id string, thumb bool) ([]byte, string, bool) {
+	s.mu.Lock()
+	it, ok := s.items[id]
+	s.mu.Unlock()
+	if !ok || time.Now().After(it.exp) {
+		return nil, "", false
+	}
+	if !thumb {
+		return it.data, it.contentType, true
+	}
+	it.thumbOnce.Do(func() {
+		t, err := makeThumb(it.data, s.thumbWidth)
+		if err != nil {
+			log.Printf("[media] thumbnail %s failed: %v", id, err)
+			return
+		}
+		it.thumb = t
+	})
+	if it.thumb == nil {
+		return it.data, it.contentType, true
+	}
+	return it.thumb, "image/jpeg", true
+}
+
+func (s *Store) sign(id, exp string) string {
+	m := hmac.New(sha256.New, s.secret)
+	m.Write([]byte(id + "|" + exp))
+	return hex.EncodeToString(m.Sum(nil))[:32]
+}
+
+func (s *Store) evictLocked(id string) {
+	if it, ok := s.items[id]; ok {
+		s.bytes -= len(it.data)
+		delete(s.items, id)
+	}
+	for i, v := range s.order {
+		if v == id {
+			s.order = append(s.order[:i], s.order[i+1:]...)
+			break
+		}
+	}
+}
+
+// janitor ลบรูปที่หมดอายุทุก 30 วิ
+func (s *Store) janitor() {
+	t := time.NewTicker(30 * time.Second)
+	defer t.Stop()
+	for range t.C {
+		now := time.Now()
+		s.mu.Lock()
+		for len(s.order) > 0 {
+			it, ok := s.items[s.order[0]]
+			if ok && now.Before(it.exp) {
+				break
+			}
+			s.evictLocked(s.order[0])
+		}
+		s.mu.Unlock()
+	}
+}
+
+// makeThumb ย่อรูปให้กว้าง width (nearest neighbour พอสำหรับ preview บน kiosk)
+func makeThumb(data []byte, width int) ([]byte, error) {
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	b := src.Bounds()
+	if width <= 0 || b.Dx() <= width {
+		return data, nil
+	}
+	height := b.Dy() * width / b.Dx()
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		sy := b.Min.Y + y*b.Dy()/height
+		for x := 0; x < width; x++ {
+			sx := b.Min.X + x*b.Dx()/width
+			dst.Set(x, y, src.At(sx, sy))
+		}
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, dst, &jpeg.Options{Quality: 70}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func newID() string {
+	b := make([]byte, 12)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func getenvInt(k string, def int) int {
+	if v := os.Getenv(k); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			return n
+		}
+	}
+	return def
+}
+
+func getenvDuration(k string, def time.Duration) time.Duration {
+	if v := os.Getenv(k); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			return d
+		}
+	}
+	return def
+}
@@ -0,0 +1,115 @@
+package offline
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"GO_LANG_WORKSPACE/internal/outbox"
+)
+
+// ---------- Cloud circuit breaker ----------
+//
+// ต่อ Cloud ไม่ได้ติดกัน OFFLINE_FAILURES ครั้ง → วงจรเปิด: ไม่ถาม Cloud อีก (ไม่ต้องรอ timeout ทุกคัน) ใช้ offline policy แทน
+// ทุก OFFLINE_PROBE_INTERVAL ปล่อยให้ request หนึ่งลอง Cloud — ผ่านแล้ววงจรปิด และสั่ง outbox ส่งงานค้างทันที
+//
+// ENV:
+//   OFFLINE_FAILURES=3
+//   OFFLINE_PROBE_INTERVAL=30s
+
+// ErrOpen ไม่ได้ถาม Cloud เพราะวงจรเปิดอยู่
+var ErrOpen = errors.New("cloud circuit open")
+
+type breaker struct {
+	mu        sync.Mutex
+	failures  int
+	open      bool
+	openedAt  time.Time
+	nextProbe time.Time
+	lastError string
+}
+
+var cloud breaker
+
+// Allow true = ถาม Cloud ได้ (วงจรปิด หรือถึงรอบ probe)
+func Allow() bool {
+	cloud.mu.Lock()
+	defer cloud.mu.Unlock()
+	if !cloud.open {
+		return true
+	}
+	now := time.Now()
+	if now.Before(cloud.nextProbe) {
+		return false
+	}
+	cloud.nextProbe = now.Add(getenvDuration("OFFLINE_PROBE_INTERVAL", 30*time.Second))
+	return true
+}
+
+// Report ผลการถาม Cloud (nil = ต่อได้ แม้ Cloud ตอบ status false)
+func Report(err error) {
+	cloud.mu.Lock()
+	defer cloud.mu.Unlock()
+	if err == nil {
+		cloud.failures = 0
+		if cloud.open {
+			cloud.open = false
+			log.Printf("[offline] cloud reachable again after %s — circuit closed", time.Since(cloud.openedAt).Round(time.Second))
+			go outbox.Default().Retry()
+		}
+		return
+	}
+	if errors.Is(err, ErrOpen) {
+		return
+	}
+	cloud.failures++
+	cloud.lastError = err.Error()
+	if !cloud.open && cloud.failures >= getenvInt("OFFLINE_FAILURES", 3) {
+		now := time.Now()
+		cloud.open, cloud.openedAt = true, now
+		cloud.nextProbe = now.Add(getenvDuration("OFFLINE_PROBE_INTERVAL", 30*time.Second))
+		log.Printf("[offline] cloud unreachable %d times (%v) — circuit open, using offline policy", cloud.failures, err)
+	}
+}
+
+// ResponseError Cloud ตอบแต่ใช้ไม่ได้ — 5xx (เช่น proxy ตอบ 502/503 เป็น HTML) หรือ body ไม่ใช่ JSON
+// นับเป็นต่อ Cloud ไม่ได้ (Report + ตัดสินจาก offline policy) ไม่ใช่ "Cloud ตอบว่าไม่ผ่าน"
+func ResponseError(status int, decodeErr error) error {
+	if status >= http.StatusInternalServerError {
+		return fmt.Errorf("cloud returned HTTP %d", status)
+	}
+	if decodeErr != nil {
+		return fmt.Errorf("cloud returned invalid JSON (HTTP %d): %w", status, decodeErr)
+	}
+	return nil
+}
+
+// Online false ขณะวงจรเปิด
+func Online() bool {
+	cloud.mu.Lock()
+	defer cloud.mu.Unlock()
+	return !cloud.open
+}
+
+// BreakerStats สถานะวงจร (สำหรับ admin)
+type BreakerStats struct {
+	Open      bool       `json:"open"`
+	Failures  int        `json:"failures"`
+	OpenedAt  *time.Time `json:"opened_at,omitempty"`
+	NextProbe *time.Time `json:"next_probe,omitempty"`
+	LastError string     `json:"last_error,omitempty"`
+}
+
+func breakerStats() BreakerStats {
+	cloud.mu.Lock()
+	defer cloud.mu.Unlock()
+	st := BreakerStats{Open: cloud.open, Failures: cloud.failures, LastError: cloud.lastError}
+	if cloud.open {
+		o, p := cloud.openedAt, cloud.nextProbe
+		st.OpenedAt, st.NextProbe = &o, &p
+	}
+	return st
+}
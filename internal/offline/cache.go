@@ -0,0 +1,371 @@
+package offline
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"GO_LANG_WORKSPACE/internal/config"
+	"GO_LANG_WORKSPACE/internal/plate"
+)
+
+// ---------- Local decision cache ----------
+//
+// สำเนาข้อมูลจาก Cloud ไว้ตัดสินใจตอนออฟไลน์ ดึงใหม่ทุก OFFLINE_SYNC_INTERVAL และเก็บลงดิสก์ (restart ตอนเน็ตหลุดก็ยังมี)
+//   GET <SERVER_URL><OFFLINE_SYNC_PATH>?parking_code=...
+//   → {"members":[...], "reservations":[...], "paid_exits":[...]}  (หรือห่อใน "data")
+//
+// ENV:
+//   OFFLINE_SYNC_PATH=/api/v1-202402/offline/snapshot
+//   OFFLINE_SYNC_INTERVAL=5m
+//   OFFLINE_CACHE_FILE=./data/offline/cache.json
+
+// Member สมาชิก (รถประจำ)
+type Member struct {
+	LicensePlate string     `json:"license_plate"`
+	CustID       any        `json:"cust_id,omitempty"`
+	EfID         any        `json:"ef_id,omitempty"`
+	ValidUntil   *time.Time `json:"valid_until,omitempty"`
+}
+
+// Reservation การจองที่ยังใช้ได้
+type Reservation struct {
+	LicensePlate string     `json:"license_plate"`
+	ValidFrom    *time.Time `json:"valid_from,omitempty"`
+	ValidUntil   *time.Time `json:"valid_until,omitempty"`
+}
+
+// PaidExit รถที่ชำระแล้ว ออกได้ภายใน ExitBefore
+type PaidExit struct {
+	LicensePlate string     `json:"license_plate"`
+	UUID         string     `json:"uuid,omitempty"`
+	PaidAt       *time.Time `json:"paid_at,omitempty"`
+	ExitBefore   *time.Time `json:"exit_before,omitempty"`
+}
+
+// Snapshot ข้อมูลทั้งชุดจาก Cloud
+type Snapshot struct {
+	SyncedAt     time.Time     `json:"synced_at"`
+	Members      []Member      `json:"members"`
+	Reservations []Reservation `json:"reservations"`
+	PaidExits    []PaidExit    `json:"paid_exits"`
+}
+
+// CacheStats สถานะ cache (สำหรับ admin)
+type CacheStats struct {
+	SyncedAt     *time.Time `json:"synced_at,omitempty"`
+	Members      int        `json:"members"`
+	Reservations int        `json:"reservations"`
+	PaidExits    int        `json:"paid_exits"`
+	UsedPaid     int        `json:"used_paid_exits"` // ใช้ออกตอนออฟไลน์แล้ว
+	LastSyncErr  string     `json:"last_sync_error,omitempty"`
+}
+
+type cache struct {
+	mu           sync.RWMutex
+	snap         Snapshot
+	members      map[string]Member
+	reservations map[string][]Reservation
+	paidExits    map[string][]PaidExit
+	usedPaid     map[string]bool // paid exit ที่ใช้ออกตอนออฟไลน์แล้ว (ตั๋วหนึ่งใบออกได้ครั้งเดียว)
+	lastSyncErr  string
+	fileMu       sync.Mutex // เขียนไฟล์ cache ทีละครั้ง (sync กับ markPaidExit)
+}
+
+// cacheFileData รูปแบบไฟล์บนดิสก์ = Snapshot + รอยใช้ paid exit (restart แล้วตั๋วที่ใช้ไปแล้วยังใช้ซ้ำไม่ได้)
+type cacheFileData struct {
+	Snapshot
+	UsedPaidExits []string `json:"used_paid_exits,omitempty"`
+}
+
+var (
+	local   = &cache{}
+	syncNow = make(chan struct{}, 1)
+)
+
+// Start โหลด cache จากดิสก์แล้ว sync กับ Cloud เป็นรอบ ๆ จน ctx ถูกยกเลิก
+func Start(ctx context.Context, serverURL, parkingCode string) {
+	if snap, used, err := loadFile(); err == nil {
+		local.usedPaid = make(map[string]bool, len(used))
+		for _, id := range used {
+			local.usedPaid[id] = true
+		}
+		local.set(snap)
+		log.Printf("[offline] cache loaded (synced %s): %d members, %d reservations, %d paid exits",
+			snap.SyncedAt.Format(time.RFC3339), len(snap.Members), len(snap.Reservations), len(snap.PaidExits))
+	} else if !os.IsNotExist(err) {
+		log.Printf("[offline] cache file: %v", err)
+	}
+
+	client := &http.Client{Timeout: 30 * time.Second, Transport: config.NewHTTPTransport()}
+	go func() {
+		t := time.NewTicker(getenvDuration("OFFLINE_SYNC_INTERVAL", 5*time.Minute))
+		defer t.Stop()
+		for {
+			local.sync(ctx, client, serverURL, parkingCode)
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+			case <-syncNow:
+			}
+		}
+	}()
+}
+
+// SyncNow สั่ง sync ทันที (admin)
+func SyncNow() {
+	select {
+	case syncNow <- struct{}{}:
+	default:
+	}
+}
+
+func (c *cache) sync(ctx context.Context, client *http.Client, serverURL, parkingCode string) {
+	path := os.Getenv("OFFLINE_SYNC_PATH")
+	if path == "" {
+		path = "/api/v1-202402/offline/snapshot"
+	}
+	u := strings.TrimRight(serverURL, "/") + path + "?" + url.Values{"parking_code": {parkingCode}}.Encode()
+
+	snap, err := fetch(ctx, client, u)
+	if err != nil {
+		c.mu.Lock()
+		c.lastSyncErr = err.Error()
+		c.mu.Unlock()
+		log.Printf("[offline] sync failed: %v", err)
+		return
+	}
+	c.set(snap)
+	c.mu.Lock()
+	c.lastSyncErr = ""
+	c.mu.Unlock()
+	Report(nil) // sync ผ่าน = Cloud กลับมาแล้ว
+	c.persist()
+}
+
+// persist เขียน snapshot + รอยใช้ปัจจุบันลงดิสก์
+func (c *cache) persist() {
+	c.fileMu.Lock()
+	defer c.fileMu.Unlock()
+	c.mu.RLock()
+	data := cacheFileData{Snapshot: c.snap, UsedPaidExits: make([]string, 0, len(c.usedPaid))}
+	for id := range c.usedPaid {
+		data.UsedPaidExits = append(data.UsedPaidExits, id)
+	}
+	c.mu.RUnlock()
+	sort.Strings(data.UsedPaidExits)
+	if err := saveFile(data); err != nil {
+		log.Printf("[offline] save cache: %v", err)
+	}
+}
+
+func fetch(ctx context.Context, client *http.Client, u string) (Snapshot, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return Snapshot{}, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return Snapshot{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return Snapshot{}, fmt.Errorf("GET %s returned %d", u, resp.StatusCode)
+	}
+	var body struct {
+		Snapshot
+		Data *Snapshot `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return Snapshot{}, err
+	}
+	snap := body.Snapshot
+	if body.Data != nil {
+		snap = *body.Data
+	}
+	// ไม่มีรายการไหนเลย (ไม่ใช่ [] ว่าง) = response ผิดรูป — อย่าทับ cache เดิม
+	if snap.Members == nil && snap.Reservations == nil && snap.PaidExits == nil {
+		return Snapshot{}, fmt.Errorf("GET %s: no members/reservations/paid_exits in response", u)
+	}
+	snap.SyncedAt = time.Now()
+	return snap, nil
+}
+
+func (c *cache) set(snap Snapshot) {
+	members := make(map[string]Member, len(snap.Members))
+	for _, m := range snap.Members {
+		members[key(m.LicensePlate)] = m
+	}
+	reservations := map[string][]Reservation{}
+	for _, r := range snap.Reservations {
+		k := key(r.LicensePlate)
+		reservations[k] = append(reservations[k], r)
+	}
+	paid := map[string][]PaidExit{}
+	for _, p := range snap.PaidExits {
+		k := key(p.LicensePlate)
+		paid[k] = append(paid[k], p)
+	}
+	c.mu.Lock()
+	// เก็บรอยใช้ไว้ถ้ารายการยังอยู่ใน snapshot ใหม่ (Cloud อาจยังไม่ได้รับผล reconcile)
+	used := map[string]bool{}
+	for k := range c.usedPaid {
+		plateKey, _, _ := strings.Cut(k, "|")
+		for _, p := range paid[plateKey] {
+			if paidExitID(plateKey, p) == k {
+				used[k] = true
+			}
+		}
+	}
+	c.snap, c.members, c.reservations, c.paidExits, c.usedPaid = snap, members, reservations, paid, used
+	c.mu.Unlock()
+}
+
+// key ป้ายรูปแบบเดียวกับที่ pipeline ส่ง Cloud (canonical)
+func key(p string) string {
+	if c := plate.Normalize(p).Canonical; c != "" {
+		return c
+	}
+	return strings.TrimSpace(p)
+}
+
+func (c *cache) member(p string, now time.Time) (Member, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	m, ok := c.members[key(p)]
+	if !ok || (m.ValidUntil != nil && now.After(*m.ValidUntil)) {
+		return Member{}, false
+	}
+	return m, true
+}
+
+func (c *cache) reservation(p string, now time.Time) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for _, r := range c.reservations[key(p)] {
+		if r.ValidFrom != nil && now.Before(*r.ValidFrom) {
+			continue
+		}
+		if r.ValidUntil != nil && now.After(*r.ValidUntil) {
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+// paidExit หารายการชำระแล้วที่ยังไม่หมดเวลาและยังไม่ถูกใช้ (ยังไม่ทำเครื่องหมาย — รอไม้กั้นเปิดได้ก่อน ดู markPaidExit)
+func (c *cache) paidExit(p string, now time.Time) (PaidExit, string, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	k := key(p)
+	for _, e := range c.paidExits[k] {
+		if e.ExitBefore != nil && now.After(*e.ExitBefore) {
+			continue
+		}
+		id := paidExitID(k, e)
+		if c.usedPaid[id] {
+			continue
+		}
+		return e, id, true
+	}
+	return PaidExit{}, "", false
+}
+
+// markPaidExit ทำเครื่องหมายว่าตั๋วนี้ใช้ออกแล้ว แล้วเขียนลงดิสก์ทันที
+func (c *cache) markPaidExit(id string) {
+	c.mu.Lock()
+	if c.usedPaid == nil {
+		c.usedPaid = map[string]bool{}
+	}
+	c.usedPaid[id] = true
+	c.mu.Unlock()
+	c.persist()
+}
+
+func paidExitID(plateKey string, e PaidExit) string {
+	id := e.UUID
+	if id == "" && e.PaidAt != nil {
+		id = e.PaidAt.UTC().Format(time.RFC3339Nano)
+	}
+	return plateKey + "|" + id
+}
+
+func (c *cache) stats() CacheStats {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	st := CacheStats{
+		Members:      len(c.snap.Members),
+		Reservations: len(c.snap.Reservations),
+		PaidExits:    len(c.snap.PaidExits),
+		UsedPaid:     len(c.usedPaid),
+		LastSyncErr:  c.lastSyncErr,
+	}
+	if !c.snap.SyncedAt.IsZero() {
+		t := c.snap.SyncedAt
+		st.SyncedAt = &t
+	}
+	return st
+}
+
+func cacheFile() string {
+	if v := os.Getenv("OFFLINE_CACHE_FILE"); v != "" {
+		return v
+	}
+	return filepath.Join("data", "offline", "cache.json")
+}
+
+func loadFile() (Snapshot, []string, error) {
+	var data cacheFileData
+	b, err := os.ReadFile(cacheFile())
+	if err != nil {
+		return data.Snapshot, nil, err
+	}
+	err = json.Unmarshal(b, &data)
+	return data.Snapshot, data.UsedPaidExits, err
+}
+
+func saveFile(data cacheFileData) error {
+	name := cacheFile()
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		return err
+	}
+	b, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	tmp := name + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, name)
+}
+
+func getenvInt(k string, def int) int {
+	if v := strings.TrimSpace(os.Getenv(k)); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			return n
+		}
+	}
+	return def
+}
+
+func getenvDuration(k string, def time.Duration) time.Duration {
+	if v := strings.TrimSpace(os.Getenv(k)); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			return d
+		}
+	}
+	return def
+}
@@ -0,0 +1,171 @@
+package offline
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"GO_LANG_WORKSPACE/internal/outbox"
+)
+
+// ---------- Offline policy ----------
+//
+// ใช้เมื่อถาม Cloud ไม่ได้ (วงจรเปิด หรือ request ล้ม) — ตัดสินจาก cache แล้วส่งผลให้ Cloud ผ่าน outbox ภายหลัง
+//   allow_members  ผ่านถ้าอยู่ใน cache: สมาชิก, การจองที่ยังใช้ได้, และ (ขาออก) รถที่ชำระแล้ว — ออกได้ครั้งเดียวต่อรายการ
+//   allow_all      ผ่านทุกคัน
+//   deny           ไม่ผ่าน (รอเจ้าหน้าที่)
+//
+// ENV:
+//   OFFLINE_POLICY=allow_members
+//   OFFLINE_POLICY_<ENT|EXT>_<GATE|RESE|ZONE>_<NN>=allow_all     ทับรายประตู
+//   OFFLINE_RECONCILE_PATH=/api/v1-202402/offline/reconcile
+
+// Policy นโยบายของประตูตอนออฟไลน์
+type Policy string
+
+const (
+	AllowMembers Policy = "allow_members"
+	AllowAll     Policy = "allow_all"
+	Deny         Policy = "deny"
+)
+
+// Decision ผลตัดสินตอนออฟไลน์
+type Decision struct {
+	Allow  bool   `json:"allow"`
+	Policy Policy `json:"policy"`
+	Match  string `json:"match,omitempty"` // member | reservation | paid_exit
+	Reason string `json:"reason"`
+	CustID any    `json:"cust_id,omitempty"`
+	EfID   any    `json:"ef_id,omitempty"`
+	UUID   string `json:"uuid,omitempty"` // uuid ของรายการที่ชำระแล้ว (paid_exit)
+
+	paidID string // ตั๋ว paid exit ที่จับคู่ได้ — ทำเครื่องหมายใช้แล้วเมื่อไม้กั้นเปิดสำเร็จ (MarkUsed)
+}
+
+// MarkUsed เรียกหลังเปิดไม้กั้นทางออกสำเร็จ — ตั๋ว paid exit ที่ใช้ตัดสินออกซ้ำไม่ได้อีก (ไม้กั้นเปิดไม่ได้ = ยังใช้ได้)
+func (d Decision) MarkUsed() {
+	if d.paidID != "" {
+		local.markPaidExit(d.paidID)
+	}
+}
+
+// Message ข้อความสำหรับ broadcast/LED
+func (d Decision) Message() string {
+	if d.Allow {
+		return "offline: " + d.Reason
+	}
+	return "offline: " + d.Reason + " — please contact staff"
+}
+
+// Response ผลตัดสินในรูป response ของ Cloud ({status, message, data}) ให้ flow เดิมเปิดไม้กั้น/broadcast ต่อได้
+func (d Decision) Response(licensePlate string) map[string]any {
+	data := map[string]any{
+		"license_plate":  licensePlate,
+		"offline_policy": d.Policy,
+	}
+	if d.Match != "" {
+		data["offline_match"] = d.Match
+	}
+	if d.UUID != "" {
+		data["uuid"] = d.UUID
+	}
+	return map[string]any{
+		"status":  d.Allow,
+		"message": d.Message(),
+		"offline": true,
+		"data":    data,
+	}
+}
+
+// PolicyFor นโยบายของประตู (ไม่ได้ตั้งรายประตูใช้ OFFLINE_POLICY)
+func PolicyFor(direction, location, gateNo string) Policy {
+	key := fmt.Sprintf("OFFLINE_POLICY_%s_%s_%02s", direction, location, gateNo)
+	if v := os.Getenv(key); v != "" {
+		return parsePolicy(key, v)
+	}
+	return defaultPolicy()
+}
+
+func defaultPolicy() Policy {
+	if v := os.Getenv("OFFLINE_POLICY"); v != "" {
+		return parsePolicy("OFFLINE_POLICY", v)
+	}
+	return AllowMembers
+}
+
+// parsePolicy ค่าที่ไม่รู้จักใช้ allow_members
+func parsePolicy(key, v string) Policy {
+	switch p := Policy(strings.ToLower(strings.TrimSpace(v))); p {
+	case AllowMembers, AllowAll, Deny:
+		return p
+	default:
+		log.Printf("[offline] invalid %s=%q, using %s", key, v, AllowMembers)
+		return AllowMembers
+	}
+}
+
+// Decide ตัดสินป้ายนี้ที่ประตูนี้จาก cache + นโยบาย
+func Decide(direction, location, gateNo, licensePlate string) Decision {
+	now := time.Now()
+	d := Decision{Policy: PolicyFor(direction, location, gateNo)}
+	switch d.Policy {
+	case AllowAll:
+		d.Allow, d.Reason = true, "allow all"
+		return d
+	case Deny:
+		d.Reason = "cloud unreachable"
+		return d
+	}
+
+	if licensePlate == "" || strings.EqualFold(licensePlate, "unknown") {
+		d.Reason = "plate unreadable"
+		return d
+	}
+	if m, ok := local.member(licensePlate, now); ok {
+		d.Allow, d.Match, d.Reason, d.CustID, d.EfID = true, "member", "member", m.CustID, m.EfID
+		return d
+	}
+	if local.reservation(licensePlate, now) {
+		d.Allow, d.Match, d.Reason = true, "reservation", "reservation"
+		return d
+	}
+	if direction == "EXT" {
+		if p, id, ok := local.paidExit(licensePlate, now); ok {
+			d.Allow, d.Match, d.Reason, d.UUID, d.paidID = true, "paid_exit", "paid", p.UUID, id
+			return d
+		}
+	}
+	d.Reason = "not in offline cache"
+	return d
+}
+
+// Reconcile ส่งผลตัดสินออฟไลน์ให้ Cloud ผ่าน outbox (ส่งเมื่อเน็ตกลับมา)
+func Reconcile(serverURL, parkingCode, direction, location, gateNo, licensePlate, uuid string, d Decision) {
+	path := os.Getenv("OFFLINE_RECONCILE_PATH")
+	if path == "" {
+		path = "/api/v1-202402/offline/reconcile"
+	}
+	body := map[string]any{
+		"license_plate": licensePlate,
+		"uuid":          uuid,
+		"parking_code":  parkingCode,
+		"direction":     strings.ToLower(direction),
+		"location":      strings.ToLower(location),
+		"gate_id":       gateNo,
+		"decision":      d,
+		"decided_at":    time.Now().Format(time.RFC3339),
+	}
+	log.Printf("[offline] %s %s gate=%s plate=%s allow=%v (%s, %s)", location, direction, gateNo, licensePlate, d.Allow, d.Policy, d.Reason)
+	outbox.Post(uuid, "offline_decision", strings.TrimRight(serverURL, "/")+path, body)
+}
+
+// Stats สถานะวงจร + cache (สำหรับ admin)
+func Stats() map[string]any {
+	return map[string]any{
+		"circuit": breakerStats(),
+		"cache":   local.stats(),
+		"policy":  defaultPolicy(),
+	}
+}
@@ -1,17 +1,12 @@
 package order
 
 import (
-	"bytes"
 	"context"
 	"crypto/tls"
 	"encoding/base64"
 	"encoding/json"
-	"encoding/xml"
 	"fmt"
-	"io"
 	"log"
-	"mime"
-	"mime/multipart"
 	"net/http"
 	"net/url"
 	"os"
@@ -22,21 +17,24 @@ import (
 
 	digest "github.com/icholy/digest"
 
+	"GO_LANG_WORKSPACE/internal/anpr"
 	"GO_LANG_WORKSPACE/internal/barrier_v2"
 	"GO_LANG_WORKSPACE/internal/config"
+	"GO_LANG_WORKSPACE/internal/events"
+	"GO_LANG_WORKSPACE/internal/offline"
+	"GO_LANG_WORKSPACE/internal/outbox"
+	"GO_LANG_WORKSPACE/internal/plate"
 	"GO_LANG_WORKSPACE/internal/utils"
 	"GO_LANG_WORKSPACE/internal/ws"
-
-	"github.com/gin-gonic/gin"
 )
 
 // Handler หลัก
 type Handler struct {
 	cfg        *config.Config
 	hub        *ws.Hub
+	events     *events.Publisher
 	httpClient *http.Client // ไว้ยิง Cloud (transport ปกติ)
 	camClient  *http.Client // ไว้ยิงกล้อง (Digest)
-	deduper    *utils.Deduper
 }
 
 func NewHandler(cfg *config.Config, hub *ws.Hub) *Handler {
@@ -63,154 +61,81 @@ func NewHandler(cfg *config.Config, hub *ws.Hub) *Handler {
 	return &Handler{
 		cfg:        cfg,
 		hub:        hub,
+		events:     events.NewPublisher(hub),
 		httpClient: httpCli,
 		camClient:  camCli,
-		deduper:    utils.NewDeduper(30 * time.Second),
 	}
 }
 
-func (h *Handler) VerifyMember(c *gin.Context) {
-	t0 := time.Now()
-
-	// ---------- Step 1: Validate Request + limit body ----------
-	ct := c.GetHeader("Content-Type")
-	mediaType, params, err := mime.ParseMediaType(ct)
-	if err != nil || !strings.HasPrefix(mediaType, "multipart/") {
-		c.String(http.StatusOK, "Invalid request")
-		return
+// Routes เส้นทางกล้องของ order สำหรับ anpr pipeline
+//
+//	POST /api/v2-202402/order/verify-member?gate_no=1             → gate_in
+//	POST /api/v2-202402/order/verify-license-plate-out?gate_no=1  → gate_out
+func (h *Handler) Routes() []anpr.Route {
+	return []anpr.Route{
+		{Name: "gate_in", Label: "GATE IN", Direction: "ENT", Location: "GATE", Decide: h.decideEntrance,
+			Room: func(ev *anpr.PlateEvent) string { return "gate_in_" + ev.GateNo }},
+		{Name: "gate_out", Label: "GATE OUT", Direction: "EXT", Location: "GATE", Decide: h.decideExit,
+			Room: func(ev *anpr.PlateEvent) string { return "gate_out_" + ev.GateNo }},
 	}
+}
 
-	// กัน body ใหญ่เกิน (เช่น กล้องส่งรูปบวม/ผิดพลาด) — ป้องกันค้างยาว
-	const maxBody = int64(16 << 20) // 16MB รวมทั้ง multipart
-	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBody)
-	defer c.Request.Body.Close()
+// decideEntrance ขาเข้า: ถาม Cloud หา customer → LED → broadcast gate_in_<gate>
+func (h *Handler) decideEntrance(ctx context.Context, ev *anpr.PlateEvent) error {
+	plate, gateNo := ev.Plate, ev.GateNo
 
-	mr := multipart.NewReader(c.Request.Body, params["boundary"])
-	t1 := time.Since(t0)
+	h.postParkingLicensePlate(ev.UUID, plate, ev.CameraIP, h.cfg.ParkingCode, ev.Metadata())
+	ev.Mark("plpPost")
 
-	// ---------- Step 2: Separate Files ----------
-	var xmlBuf []byte
-	var lpImg []byte
-	var detectImg = []byte(nil) // detected/pedestrian: ไม่ใช้
+	// confidence ต่ำกว่า ANPR_MIN_CONFIDENCE → แจ้งอ่านป้ายไม่ได้ ไม่ถาม Cloud
+	if ev.LowConfidence {
+		h.unreadable(ev, "ENT")
+		return nil
+	}
 
-	parts := 0
-	const maxParts = 10 // กันลูปไม่รู้จบจาก input แปลก
+	// ตารางเวลาประตู: closed / reservation-only ไม่ต้องถาม Cloud, free-flow เปิดให้เลย
+	mode := config.GateModeAt("ENT", "GATE", gateNo, time.Now())
 
-	for {
-		part, err := mr.NextPart()
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			// เจอ error ระหว่างอ่าน (รวม timeout) → จบรีเควสต์ทันที
-			// ใช้ 408 ถ้าดูเหมือน timeout, นอกนั้น 400
-			if ne, ok := err.(interface{ Timeout() bool }); ok && ne.Timeout() {
-				c.String(http.StatusRequestTimeout, "multipart read timeout")
-			} else {
-				c.String(http.StatusOK, "invalid multipart")
-			}
-			return
-		}
+	var custID, efID any
+	var od *offline.Decision
+	if mode == config.ModeNormal || mode == config.ModeFreeFlow {
+		base, _ := url.Parse(h.cfg.ServerURL)
+		base.Path = path.Join(base.Path, "/api/v2-202402/order/get-customer-id")
 
-		parts++
-		if parts > maxParts {
-			_ = part.Close()
-			c.String(http.StatusOK, "too many parts")
-			return
-		}
+		q := base.Query()
+		q.Set("license_plate", plate)
+		q.Set("parking_code", h.cfg.ParkingCode)
+		base.RawQuery = q.Encode()
 
-		fn := part.FileName()
-		if fn == "" {
-			// form field (ไม่ใช่ไฟล์) — ทิ้ง
-			_, _ = io.Copy(io.Discard, part)
-			_ = part.Close()
-			continue
-		}
+		exitURL := base.String()
 
-		// อ่านทั้งไฟล์เข้าหน่วยความจำ (คงพฤติกรรมเดิม)
-		buf, _ := io.ReadAll(part)
-		_ = part.Close()
-
-		switch {
-		case strings.HasSuffix(strings.ToLower(fn), ".xml"):
-			xmlBuf = buf
-		case fn == "licensePlatePicture.jpg":
-			lpImg = buf
-		case fn == "detectedImage.jpg" || fn == "pedestrianDetectionPicture.jpg":
-			detectImg = buf
-		default:
-			// ไฟล์อื่นไม่รู้จัก — ทิ้ง
+		started := time.Now()
+		jsonRes, status, err := h.cloudJSON(exitURL)
+		ev.RecordCloud(http.MethodGet, exitURL, nil, jsonRes, status, err, started)
+		if err != nil {
+			log.Printf("[Step6][cloud] error: %v", err)
+			// Cloud ไม่ตอบ → ตัดสินจาก offline cache แล้วส่งผลให้ Cloud ทีหลัง
+			d := offline.Decide("ENT", "GATE", gateNo, plate)
+			custID, efID, od = d.CustID, d.EfID, &d
+			offline.Reconcile(h.cfg.ServerURL, h.cfg.ParkingCode, "ENT", "GATE", gateNo, plate, ev.UUID, d)
+		} else if jsonRes != nil {
+			custID = jsonRes["cust_id"]
+			efID = jsonRes["ef_id"]
 		}
 	}
-
-	if len(xmlBuf) == 0 {
-		c.String(http.StatusOK, "Missing XML file")
-		return
-	}
-	t2 := time.Since(t0) - t1
-
-	// ---------- Step 3: Parse XML (คงตรรกะเดิม) ----------
-	var plate, uuid, timeIn, ip, vehicleType string
-	{
-		var ev eventXML
-		if err := xml.Unmarshal(xmlBuf, &ev); err == nil && strings.TrimSpace(ev.ANPR.LicensePlate) != "" {
-			plate = strings.TrimSpace(ev.ANPR.LicensePlate)
-			uuid = strings.TrimSpace(ev.UUID)
-			timeIn = strings.TrimSpace(ev.DateTime)
-			ip = strings.TrimSpace(ev.IPAddress)
-			vehicleType = strings.TrimSpace(ev.ANPR.VehicleType)
-		} else {
-			var ev2 eventXMLNoNS
-			if err2 := xml.Unmarshal(xmlBuf, &ev2); err2 == nil && strings.TrimSpace(ev2.ANPR.LicensePlate) != "" {
-				plate = strings.TrimSpace(ev2.ANPR.LicensePlate)
-				uuid = strings.TrimSpace(ev2.UUID)
-				timeIn = strings.TrimSpace(ev2.DateTime)
-				ip = strings.TrimSpace(ev2.IPAddress)
-				// คงตรรกะเดิมตามคอมเมนต์ของคุณ
-				vehicleType = strings.TrimSpace(ev.ANPR.VehicleType)
-			}
+	if mode == config.ModeFreeFlow {
+		err := barrier_v2.OpenBarrierByGate("ENT", gateNo)
+		ev.RecordBarrier("open_gate", err)
+		if err != nil {
+			log.Printf("[schedule] free-flow open gate in %s failed: %v", gateNo, err)
 		}
 	}
-	if plate == "" {
-		c.String(http.StatusOK, "Failed to parse XML")
-		return
-	}
-	t3 := time.Since(t0) - t1 - t2
-
-	// ---------- Step 4.. ต่อจากนี้เหมือนเดิม ----------
-	gateNo := c.Query("gate_no")
-	t4 := time.Since(t0) - t1 - t2 - t3
-
-	go h.postParkingLicensePlate(plate, ip, h.cfg.ParkingCode)
-	t5 := time.Since(t0) - t1 - t2 - t3 - t4
-
-	base, _ := url.Parse(h.cfg.ServerURL)
-	base.Path = path.Join(base.Path, "/api/v2-202402/order/get-customer-id")
-
-	q := base.Query()
-	q.Set("license_plate", plate)
-	q.Set("parking_code", h.cfg.ParkingCode)
-	base.RawQuery = q.Encode()
-
-	exitURL := base.String()
+	ev.Mark("Call API")
 
-	jsonRes, err := h.getJSON(exitURL)
-	if err != nil {
-		log.Printf("[Step6][cloud] error: %v", err)
-	}
-	var custID, efID any
-	if jsonRes != nil {
-		custID = jsonRes["cust_id"]
-		efID = jsonRes["ef_id"]
-	}
-	t6 := time.Since(t0) - t1 - t2 - t3 - t4 - t5
-
-	gateStr := c.Query("gate_no")
-	gateNoE, err := strconv.Atoi(gateStr)
+	gateNoE, err := strconv.Atoi(gateNo)
 	if err != nil {
-		log.Printf("invalid gate_no %q: %v", gateStr, err)
-		c.String(http.StatusOK, "invalid gate_no")
-		return
+		log.Printf("invalid gate_no %q: %v", gateNo, err)
+		return anpr.Reject(http.StatusOK, "invalid gate_no")
 	}
 
 	envKey := fmt.Sprintf("HIK_LED_MAIN_ENT_%02d", gateNoE)
@@ -220,133 +145,86 @@ func (h *Handler) VerifyMember(c *gin.Context) {
 	}
 
 	disErr := utils.DisplayHexData(value, 9999, plate, "ent", "main", "")
+	ev.RecordLED(value, plate, disErr)
 	if disErr != nil {
 		fmt.Println("Error:", disErr)
 	} else {
 		fmt.Println("Packet sent successfully.")
 	}
 
-	if lpImg == nil {
-		lpImg = detectImg
-	}
-
+	lpB64 := base64.StdEncoding.EncodeToString(ev.Image())
 	payload := map[string]any{
 		"license_plate":            plate,
-		"uuid":                     uuid,
-		"time_in":                  timeIn,
+		"uuid":                     ev.UUID,
+		"time_in":                  ev.DateTime,
 		"cust_id":                  custID,
 		"ef_id":                    efID,
-		"vehicle_type":             utils.VehicleType(vehicleType),
-		"license_plate_img_base64": base64.StdEncoding.EncodeToString(lpImg),
+		"vehicle_type":             utils.VehicleType(ev.VehicleType),
+		"license_plate_img_base64": lpB64,
 	}
-	room := "gate_in_" + gateNo
-	h.broadcastJSON(room, payload)
-	t7 := time.Since(t0) - t1 - t2 - t3 - t4 - t5 - t6
-
-	h.logTimingsEntrance(c, t0, t1, t2, t3, t4, t5, t6, t7, plate)
-	c.String(http.StatusOK, "File(s) uploaded successfully")
-}
-
-// VerifyLicensePlateOut = POST /api/v2-202402/order/verify-license-plate-out?gate_no=1
-func (h *Handler) VerifyLicensePlateOut(c *gin.Context) {
-	t0 := time.Now()
-
-	// =========================================================================
-	// Step 1: Validate Request + limit body
-	// =========================================================================
-	ct := c.GetHeader("Content-Type")
-	mediatype, params, err := mime.ParseMediaType(ct)
-	if err != nil || !strings.HasPrefix(mediatype, "multipart/") {
-		c.String(http.StatusOK, "Invalid request")
-		return
+	if meta := ev.Metadata(); meta != nil {
+		payload["anpr"] = meta
 	}
-
-	const maxBody = int64(16 << 20) // 16MB
-	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBody)
-	defer c.Request.Body.Close()
-
-	mr := multipart.NewReader(c.Request.Body, params["boundary"])
-	t1 := time.Since(t0)
-
-	// =========================================================================
-	// Step 2: Separate Files (XML only)
-	// =========================================================================
-	var xmlBuf []byte
-	parts := 0
-	const maxParts = 10
-
-	for {
-		part, err := mr.NextPart()
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			if ne, ok := err.(interface{ Timeout() bool }); ok && ne.Timeout() {
-				c.String(http.StatusRequestTimeout, "multipart read timeout")
-			} else {
-				c.String(http.StatusOK, "invalid multipart")
-			}
-			return
-		}
-
-		parts++
-		if parts > maxParts {
-			_ = part.Close()
-			c.String(http.StatusOK, "too many parts")
-			return
-		}
-
-		fn := part.FileName()
-		if fn == "" {
-			_, _ = io.Copy(io.Discard, part)
-			_ = part.Close()
-			continue
-		}
-
-		if strings.HasSuffix(strings.ToLower(fn), ".xml") {
-			buf, _ := io.ReadAll(part)
-			xmlBuf = buf
-			_ = part.Close()
-		} else {
-			_, _ = io.Copy(io.Discard, part)
-			_ = part.Close()
+	if mode != config.ModeNormal {
+		payload["gate_mode"] = mode
+		if mode != config.ModeFreeFlow {
+			payload["status"] = false
+			payload["message"] = mode.Message()
 		}
 	}
-
-	if len(xmlBuf) == 0 {
-		c.String(http.StatusOK, "Missing XML file")
-		return
+	if od != nil {
+		payload["offline"] = true
+		if mode == config.ModeNormal {
+			payload["status"] = od.Allow
+			payload["message"] = od.Message()
+		}
 	}
-	t2 := time.Since(t0) - t1
-
-	// =========================================================================
-	// Step 3: Parse XML
-	// =========================================================================
-	var plate, ip string
-	{
-		var ev eventXML
-		if err := xml.Unmarshal(xmlBuf, &ev); err == nil && strings.TrimSpace(ev.ANPR.LicensePlate) != "" {
-			plate = strings.TrimSpace(ev.ANPR.LicensePlate)
-			ip = strings.TrimSpace(ev.IPAddress)
-		} else {
-			var ev2 eventXMLNoNS
-			if err2 := xml.Unmarshal(xmlBuf, &ev2); err2 == nil && strings.TrimSpace(ev2.ANPR.LicensePlate) != "" {
-				plate = strings.TrimSpace(ev2.ANPR.LicensePlate)
-				ip = strings.TrimSpace(ev2.IPAddress)
-			}
+	entry := events.EntryVerified{
+		Vehicle: events.Vehicle{
+			LicensePlate:      plate,
+			UUID:              ev.UUID,
+			TimeIn:            ev.DateTime,
+			VehicleType:       utils.VehicleType(ev.VehicleType),
+			LicensePlateImage: lpB64,
+			ANPR:              ev.Metadata(),
+		},
+		Decision: events.Decision{Status: mode == config.ModeNormal || mode == config.ModeFreeFlow},
+		CustID:   custID,
+		EfID:     efID,
+	}
+	if mode != config.ModeNormal {
+		entry.GateMode = string(mode)
+		if mode != config.ModeFreeFlow {
+			entry.Message = mode.Message()
 		}
 	}
-	if plate == "" {
-		c.String(http.StatusOK, "Failed to parse XML")
-		return
+	if od != nil {
+		entry.Offline = true
+		if mode == config.ModeNormal {
+			entry.Status, entry.Message = od.Allow, od.Message()
+		}
 	}
-	t3 := time.Since(t0) - t1 - t2
+	room := "gate_in_" + gateNo
+	h.events.Publish(events.New(events.TypeEntryVerified, room, gateNo, "ENT", ev.RequestID, entry), payload)
+	ev.Mark("Broadcast")
+	return nil
+}
+
+// decideExit ขาออก: เช็คยอดกับ Cloud → เปิดไม้กั้น → ดึงรูป → broadcast gate_out_<gate> → LED
+func (h *Handler) decideExit(ctx context.Context, ev *anpr.PlateEvent) error {
+	plate, gateNo := ev.Plate, ev.GateNo
 
 	// =========================================================================
 	// Step 4: Background Save Local Record
 	// =========================================================================
-	go h.postParkingLicensePlate(plate, ip, h.cfg.ParkingCode)
-	t4 := time.Since(t0) - t1 - t2 - t3
+	h.postParkingLicensePlate(ev.UUID, plate, ev.CameraIP, h.cfg.ParkingCode, ev.Metadata())
+	ev.Mark("plpPost")
+
+	// confidence ต่ำกว่า ANPR_MIN_CONFIDENCE → แจ้งอ่านป้ายไม่ได้ ไม่ถาม Cloud / ไม่เปิดไม้กั้น
+	if ev.LowConfidence {
+		h.unreadable(ev, "EXT")
+		return nil
+	}
 
 	// =========================================================================
 	// Step 5: Call Cloud API (Exit Check)
@@ -360,11 +238,27 @@ func (h *Handler) VerifyLicensePlateOut(c *gin.Context) {
 	base.RawQuery = q.Encode()
 
 	exitURL := base.String()
-	jsonRes, err := h.getJSON(exitURL)
+	started := time.Now()
+	jsonRes, status, err := h.cloudJSON(exitURL)
+	ev.RecordCloud(http.MethodGet, exitURL, nil, jsonRes, status, err, started)
+	var od *offline.Decision
 	if err != nil {
 		log.Printf("[cloud] error: %v", err)
+		// Cloud ไม่ตอบ → ตัดสินจาก offline cache (รูปแบบเดียวกับ response ของ Cloud) แล้วส่งผลให้ Cloud ทีหลัง
+		d := offline.Decide("EXT", "GATE", gateNo, plate)
+		od = &d
+		jsonRes = d.Response(plate)
+		offline.Reconcile(h.cfg.ServerURL, h.cfg.ParkingCode, "EXT", "GATE", gateNo, plate, ev.UUID, d)
+	}
+
+	// หาไม่เจอ → ลองป้ายที่ OCR อาจอ่านสลับ (ข/ช, 0/8 ...)
+	if err == nil && exitNotFound(jsonRes) {
+		if cand, res := h.retryExitCandidates(ev); res != nil {
+			log.Printf("[cloud] plate %s not found, matched candidate %s", plate, cand)
+			plate, jsonRes, ev.Plate = cand, res, cand
+		}
 	}
-	t5 := time.Since(t0) - t1 - t2 - t3 - t4
+	ev.Mark("Call API")
 
 	// เช็คสถานะความสำเร็จ
 	isSuccess := false
@@ -372,26 +266,50 @@ func (h *Handler) VerifyLicensePlateOut(c *gin.Context) {
 		isSuccess = true
 	}
 
-	gateNo := c.Query("gate_no")
-
 	// =========================================================================
 	// Step 6: Immediate Action (Open Barrier) if Success
 	// *ทำทันทีเพื่อ UX ที่ดี ไม่ต้องรอรูป*
 	// =========================================================================
-	if isSuccess {
-		if err := barrier_v2.OpenBarrierByGate("EXT", gateNo); err != nil {
+	// barrier: ผลการเปิดไม้กั้นแยกจากผล Cloud — opened | failed | closed (ตารางเวลาไม่ให้เปิด) | "" (ไม่ได้สั่ง)
+	mode := config.GateModeAt("EXT", "GATE", gateNo, time.Now())
+	barrier := ""
+	if mode.ShouldOpen(isSuccess, false) {
+		err := barrier_v2.OpenBarrierByGate("EXT", gateNo)
+		ev.RecordBarrier("open_gate", err)
+		if err != nil {
 			log.Printf("Failed to open barrier for gate %s: %v", gateNo, err)
+			barrier = "failed"
 		} else {
 			log.Printf("Barrier opened automatically for gate %s, plate: %s", gateNo, plate)
+			barrier = "opened"
+			if od != nil {
+				od.MarkUsed()
+			}
+
+			// เฝ้า loop ว่ารถผ่านจริงไหม (ผูกกับ uuid ของ transaction; ตัดสินออฟไลน์ไม่มี → ใช้ uuid ของ event จากกล้อง)
+			if barrier_v2.PassageEnabled() {
+				var txUUID string
+				if data, ok := jsonRes["data"].(map[string]any); ok {
+					txUUID, _ = data["uuid"].(string)
+				}
+				if txUUID == "" {
+					txUUID = ev.UUID
+				}
+				go h.confirmPassage(ev.UUID, gateNo, barrier_v2.PassageRef{Plate: plate, UUID: txUUID}, time.Now())
+			}
+		}
+	} else if mode != config.ModeNormal {
+		log.Printf("[schedule] gate out %s is %s, barrier stays closed (plate %s)", gateNo, mode, plate)
+		if isSuccess {
+			barrier = "closed"
 		}
+	}
 
+	if isSuccess {
 		// Handle Valet Case (Return early)
 		if msg, ok := jsonRes["message"].(string); ok && msg == "valet user" {
 			log.Printf("valet user exit %s", plate)
-			c.Status(http.StatusOK)
-			// Log timing แล้วจบเลย
-			h.logTimingsExit(c, t0, t1, t2, t3, t4, t5, 0, 0, plate)
-			return
+			return nil
 		}
 	}
 
@@ -419,7 +337,7 @@ func (h *Handler) VerifyLicensePlateOut(c *gin.Context) {
 	// *สำคัญ: ดึงรูปตรงนี้ให้เสร็จก่อน เพื่อไม่ให้ชนกับ Background Upload*
 	// =========================================================================
 	images := utils.FetchImagesHedgeHosts(h.cfg, gateNo, h.camClient)
-	t6 := time.Since(t0) - t1 - t2 - t3 - t4 - t5
+	ev.Mark("Fetch Images")
 
 	// =========================================================================
 	// Step 9: Broadcast WebSocket
@@ -434,10 +352,29 @@ func (h *Handler) VerifyLicensePlateOut(c *gin.Context) {
 	for k, v := range images {
 		broadcast[k] = v
 	}
+	if mode != config.ModeNormal {
+		broadcast["gate_mode"] = mode
+	}
+	if barrier != "" {
+		broadcast["barrier"] = barrier
+	}
 
+	exit := events.ExitVerified{
+		Vehicle:  events.Vehicle{LicensePlate: plate, ANPR: ev.Metadata()},
+		Decision: events.FromCloud(jsonRes),
+		Images:   images,
+		Cloud:    jsonRes,
+		Barrier:  barrier,
+	}
+	if data, ok := jsonRes["data"].(map[string]any); ok {
+		exit.UUID, _ = data["uuid"].(string)
+	}
+	if mode != config.ModeNormal {
+		exit.GateMode = string(mode)
+	}
 	room := "gate_out_" + gateNo
-	h.broadcastJSON(room, broadcast)
-	t7 := time.Since(t0) - t1 - t2 - t3 - t4 - t5 - t6
+	h.events.Publish(events.New(events.TypeExitVerified, room, gateNo, "EXT", ev.RequestID, exit), broadcast)
+	ev.Mark("Broadcast")
 
 	// =========================================================================
 	// Step 10: LED Display
@@ -455,7 +392,9 @@ func (h *Handler) VerifyLicensePlateOut(c *gin.Context) {
 			if toPayStr != "" {
 				line3 = fmt.Sprintf("%s THB", toPayStr)
 			}
-			if err := utils.DisplayHexData(value, 9999, plate, "ext", "main", line3); err != nil {
+			err := utils.DisplayHexData(value, 9999, plate, "ext", "main", line3)
+			ev.RecordLED(value, strings.TrimSpace(plate+" "+line3), err)
+			if err != nil {
 				fmt.Println("LED Error:", err)
 			} else {
 				fmt.Println("LED Packet sent successfully.")
@@ -471,93 +410,166 @@ func (h *Handler) VerifyLicensePlateOut(c *gin.Context) {
 		if data, ok := jsonRes["data"].(map[string]any); ok {
 			if uuid, ok := data["uuid"].(string); ok && uuid != "" {
 				// เรียก goroutine ไปทำงานเบื้องหลัง
-				go h.uploadExitImages(uuid, plate, gateNo)
+				go h.uploadExitImages(ev.UUID, uuid, plate, gateNo)
 			}
 		}
 	}
+	return nil
+}
 
-	// =========================================================================
-	// Finish
-	// =========================================================================
-	h.logTimingsExit(c, t0, t1, t2, t3, t4, t5, t6, t7, plate)
-	c.String(http.StatusOK, "File(s) uploaded successfully")
+// unreadable broadcast plate.unreadable เข้า gate_in_/gate_out_<gate> แล้วแสดงป้าย unknown บน LED (แบบ zoning)
+func (h *Handler) unreadable(ev *anpr.PlateEvent, direction string) {
+	gateNo := ev.GateNo
+	img := base64.StdEncoding.EncodeToString(ev.Image())
+	payload := map[string]any{
+		"status":  false,
+		"message": "cannot read license plate",
+		"data": map[string]any{
+			"license_plate":            ev.Plate,
+			"read_plate":               ev.RawPlate,
+			"license_plate_img_base64": img,
+		},
+	}
+	unreadable := events.PlateUnreadable{
+		Vehicle:   events.Vehicle{LicensePlate: ev.Plate, UUID: ev.UUID, LicensePlateImage: img, ANPR: ev.Metadata()},
+		ReadPlate: ev.RawPlate,
+	}
+	room := "gate_in_" + gateNo
+	if direction == "EXT" {
+		room = "gate_out_" + gateNo
+	}
+	h.events.Publish(events.New(events.TypePlateUnreadable, room, gateNo, direction, ev.RequestID, unreadable), payload)
+	ev.Mark("Broadcast")
+
+	gateNoE, _ := strconv.Atoi(gateNo)
+	envKey := fmt.Sprintf("HIK_LED_MAIN_%s_%02d", direction, gateNoE)
+	if value, ok := os.LookupEnv(envKey); ok && value != "" {
+		err := utils.DisplayHexData(value, 9999, ev.Plate, strings.ToLower(direction), "main", "")
+		ev.RecordLED(value, ev.Plate, err)
+		if err != nil {
+			log.Printf("[LED][%s][unknown] error: %v", direction, err)
+		}
+	}
 }
 
 // ----------------- helpers -----------------
 
-func (h *Handler) postParkingLicensePlate(plate, ip, code string) {
+// exitNotFound Cloud ตอบว่าไม่มีรถคันนี้ในลาน (status false และไม่มี data — ต่างจากค้างชำระที่มี data.to_pay_amount)
+func exitNotFound(res map[string]any) bool {
+	if res == nil || res["status"] == true {
+		return false
+	}
+	return res["data"] == nil
+}
+
+// retryExitCandidates ลอง license-plate-exit ด้วยป้ายดิบของกล้อง แล้ว candidate ทีละป้าย (สูงสุด PLATE_CANDIDATE_RETRY) — คืนป้ายแรกที่เจอ
+func (h *Handler) retryExitCandidates(ev *anpr.PlateEvent) (string, map[string]any) {
+	cands := ev.Candidates
+	if n := plate.RetryLimit(); len(cands) > n {
+		cands = cands[:n]
+	}
+	// ป้ายดิบของกล้องก่อน — รถที่เข้ามาก่อนเปิด PLATE_NORMALIZE ถูกบันทึกใน Cloud ด้วยป้ายดิบ
+	if raw := strings.TrimSpace(ev.RawPlate); raw != "" && raw != ev.Plate {
+		cands = append([]string{raw}, cands...)
+	}
+	for _, cand := range cands {
+		base, _ := url.Parse(h.cfg.ServerURL)
+		base.Path = path.Join(base.Path, "/api/v1-202402/order/license-plate-exit")
+		q := base.Query()
+		q.Set("license_plate", cand)
+		q.Set("parking_code", h.cfg.ParkingCode)
+		base.RawQuery = q.Encode()
+
+		started := time.Now()
+		res, status, err := h.cloudJSON(base.String())
+		ev.RecordCloud(http.MethodGet, base.String(), nil, res, status, err, started)
+		if err != nil {
+			log.Printf("[cloud] candidate %s error: %v", cand, err)
+			return "", nil
+		}
+		if !exitNotFound(res) {
+			return cand, res
+		}
+	}
+	return "", nil
+}
+
+// postParkingLicensePlate key = uuid ของ event จากกล้อง (ทุกงาน outbox ของรถคันนี้ใช้ key เดียวกัน → ส่งตามลำดับ)
+func (h *Handler) postParkingLicensePlate(key, plate, ip, code string, meta *events.PlateMeta) {
 	url := fmt.Sprintf("%s/api/v1-202402/order/parking_license_plate", h.cfg.ServerURL)
 	body := map[string]any{
 		"license_plate": plate,
 		"ip_address":    ip,
 		"parking_code":  code,
 	}
-	if _, err := h.postJSON(url, body); err != nil {
-		log.Println("Background task error:", err)
+	if meta != nil {
+		body["anpr"] = meta
 	}
+	outbox.Post(key, "parking_license_plate", url, body)
 }
 
-func (h *Handler) postJSON(url string, body map[string]any) (map[string]any, error) {
-	b, _ := json.Marshal(body)
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(b))
-	req.Header.Set("Content-Type", "application/json")
-	resp, err := h.httpClient.Do(req)
-	if err != nil {
-		return nil, err
+// cloudJSON getJSON ผ่าน circuit breaker — วงจรเปิดอยู่คืน offline.ErrOpen ทันทีไม่ต้องรอ timeout
+func (h *Handler) cloudJSON(url string) (map[string]any, int, error) {
+	if !offline.Allow() {
+		return nil, 0, offline.ErrOpen
 	}
-	defer resp.Body.Close()
-	out := map[string]any{}
-	_ = json.NewDecoder(resp.Body).Decode(&out)
-	return out, nil
+	res, status, err := h.getJSON(url)
+	offline.Report(err)
+	return res, status, err
 }
 
-func (h *Handler) getJSON(url string) (map[string]any, error) {
+// getJSON คืน body ที่ decode แล้ว + HTTP status (0 = ต่อไม่ได้) สำหรับ journal
+func (h *Handler) getJSON(url string) (map[string]any, int, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	resp, err := h.httpClient.Do(req)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 	defer resp.Body.Close()
 	out := map[string]any{}
-	_ = json.NewDecoder(resp.Body).Decode(&out)
-	return out, nil
-}
-
-func (h *Handler) broadcastJSON(room string, payload map[string]any) {
-	b, _ := json.Marshal(payload)
-	h.hub.Broadcast(room, b)
+	if err := offline.ResponseError(resp.StatusCode, json.NewDecoder(resp.Body).Decode(&out)); err != nil {
+		return nil, resp.StatusCode, err
+	}
+	return out, resp.StatusCode, nil
 }
 
-func (h *Handler) logTimingsExit(c *gin.Context, t0 time.Time, t1, t2, t3, t4, t5, t6, t7 time.Duration, plate string) {
-	log.Printf("[GATE OUT %s: LICENSE PLATE: %s]", c.Query("gate_no"), plate)
-	log.Printf(" - Parse Multipart:  %.2fs", t1.Seconds())
-	log.Printf(" - Split Files:      %.2fs", t2.Seconds())
-	log.Printf(" - Parse XML:        %.2fs", t3.Seconds())
-	log.Printf(" - plpPost:          %.2fs", t4.Seconds())
-	log.Printf(" - Call API:         %.2fs", t5.Seconds())
-	log.Printf(" - Fetch Images:     %.2fs", t6.Seconds())
-	log.Printf(" - Broadcast:        %.2fs", t7.Seconds())
-	log.Printf(" - Total Time:       %.2fs", time.Since(t0).Seconds())
-}
+// confirmPassage รอผลจาก loop แล้วแจ้งทั้ง Cloud และห้อง gate_out_<gate> (key = uuid ของ event จากกล้อง)
+func (h *Handler) confirmPassage(key, gateNo string, ref barrier_v2.PassageRef, openedAt time.Time) {
+	ev := barrier_v2.WatchPassage("EXT", gateNo, "GATE", ref, openedAt)
+	log.Printf("[passage] gate=%s plate=%s uuid=%s event=%s err=%s", gateNo, ev.Plate, ev.UUID, ev.Event, ev.Error)
 
-func (h *Handler) logTimingsEntrance(c *gin.Context, t0 time.Time, t1, t2, t3, t4, t5, t6, t7 time.Duration, plate string) {
-	log.Printf("[GATE IN %s: LICENSE PLATE: %s]", c.Query("gate_no"), plate)
-	log.Printf(" - Parse Multipart:  %.2fs", t1.Seconds())
-	log.Printf(" - Split Files:      %.2fs", t2.Seconds())
-	log.Printf(" - Parse XML:        %.2fs", t3.Seconds())
-	log.Printf(" - De-dup:           %.2fs", t4.Seconds())
-	log.Printf(" - plpPost:          %.2fs", t5.Seconds())
-	log.Printf(" - Call API:         %.2fs", t6.Seconds())
-	log.Printf(" - Broadcast:        %.2fs", t7.Seconds())
-	log.Printf(" - Total Time:       %.2fs", time.Since(t0).Seconds())
+	payload := map[string]any{
+		"event":         ev.Event,
+		"license_plate": ev.Plate,
+		"uuid":          ev.UUID,
+		"gate":          "ext",
+		"opened_at":     ev.OpenedAt.Format(time.RFC3339),
+		"time_stamp":    ev.At.Format(time.RFC3339),
+		"auto_closed":   ev.AutoClosed,
+	}
+	// event=error: ไม่มี IP / loop เสีย — ต่างจาก timeout (รถไม่ผ่านจริง)
+	if ev.Error != "" {
+		payload["error"] = ev.Error
+	}
+	passage := events.VehiclePassage{
+		Event:        ev.Event,
+		LicensePlate: ev.Plate,
+		UUID:         ev.UUID,
+		OpenedAt:     ev.OpenedAt.Format(time.RFC3339),
+		AutoClosed:   ev.AutoClosed,
+		Error:        ev.Error,
+	}
+	h.events.Publish(events.New(events.TypeVehiclePassage, "gate_out_"+gateNo, gateNo, "EXT", "", passage), payload)
+
+	payload["park_code"] = h.cfg.ParkingCode
+	url := fmt.Sprintf("%s/api/v1-202402/order/vehicle-passage", h.cfg.ServerURL)
+	outbox.Post(key, "vehicle_passage", url, payload)
 }
 
-// uploadExitImages uploads exit images in background
-func (h *Handler) uploadExitImages(uuid, licensePlate, gateNo string) {
+// uploadExitImages uploads exit images in background (key = uuid ของ event จากกล้อง, uuid = transaction ของ Cloud)
+func (h *Handler) uploadExitImages(key, uuid, licensePlate, gateNo string) {
 	if uuid == "" || licensePlate == "" || gateNo == "" {
 		log.Printf("uploadExitImages: missing required fields (uuid=%s, plate=%s, gate=%s)", uuid, licensePlate, gateNo)
 		return
@@ -607,11 +619,8 @@ func (h *Handler) uploadExitImages(uuid, licensePlate, gateNo string) {
 		payload["license_plate_img_base64"] = lpB64
 	}
 
-	// POST ไปที่ collect-image API
+	// POST ไปที่ collect-image API (ผ่าน outbox — เน็ตหลุดก็ส่งทีหลัง)
 	url := fmt.Sprintf("%s/api/v1-202401/image/collect-image", h.cfg.ServerURL)
-	if _, err := h.postJSON(url, payload); err != nil {
-		log.Printf("Failed to upload exit images: %v", err)
-	} else {
-		log.Printf("Successfully uploaded exit images for plate: %s, uuid: %s", licensePlate, uuid)
-	}
+	outbox.Post(key, "collect_image", url, payload)
+	log.Printf("Queued exit images for plate: %s, uuid: %s", licensePlate, uuid)
 }
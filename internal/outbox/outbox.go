@@ -0,0 +1,525 @@
+package outbox
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"GO_LANG_WORKSPACE/internal/config"
+)
+
+// ---------- Store-and-forward outbox ----------
+//
+// งานเขียนไป Cloud ที่ไม่ต้องรอผล (parking_license_plate, collect-image, vehicle-passage)
+// ลงดิสก์ก่อน แล้วค่อยส่ง — เน็ตหลุดก็ไม่หาย ส่งต่อเองเมื่อกลับมา
+//   - งานที่ key เดียวกัน (uuid ของ event จากกล้อง) ส่งตามลำดับ — ตัวหน้ายังไม่ผ่าน ตัวหลังรอ
+//   - ต่อ Cloud ไม่ได้ → หยุดทั้งกล่องตาม backoff แล้วลองใหม่, ส่งผ่านครั้งแรกหลังหลุด = drain ทุกงานทันที
+//   - 5xx/408/429 → ลองใหม่ตาม backoff ของงานนั้น, 4xx อื่น → ย้ายไป failed/ (ดูได้ที่ GET /api/admin/outbox)
+//
+// ENV:
+//   OUTBOX_DIR=./data/outbox
+//   OUTBOX_MAX_ITEMS=10000         เกินแล้วทิ้งงานเก่าสุด
+//   OUTBOX_MAX_MB=512
+//   OUTBOX_RETRY_MIN=2s            backoff เริ่มต้น (x2 ทุกครั้งที่ไม่ผ่าน)
+//   OUTBOX_RETRY_MAX=5m
+//   OUTBOX_TIMEOUT=15s             timeout ต่อ request
+
+// Item งานหนึ่งชิ้นในกล่อง
+type Item struct {
+	ID        string          `json:"id"`
+	Key       string          `json:"key,omitempty"` // ว่าง = ไม่ต้องรอใคร
+	Label     string          `json:"label"`
+	Method    string          `json:"method"`
+	URL       string          `json:"url"`
+	Body      json.RawMessage `json:"body,omitempty"`
+	Created   time.Time       `json:"created"`
+	Attempts  int             `json:"attempts"`
+	NextAt    time.Time       `json:"next_at"`
+	LastError string          `json:"last_error,omitempty"`
+
+	size int64
+}
+
+// ItemInfo Item ที่ไม่มี body (สำหรับหน้า admin)
+type ItemInfo struct {
+	ID        string    `json:"id"`
+	Key       string    `json:"key,omitempty"`
+	Label     string    `json:"label"`
+	Method    string    `json:"method"`
+	URL       string    `json:"url"`
+	Size      int64     `json:"size"`
+	Created   time.Time `json:"created"`
+	Attempts  int       `json:"attempts"`
+	NextAt    time.Time `json:"next_at"`
+	LastError string    `json:"last_error,omitempty"`
+}
+
+// Stats สถานะกล่อง
+type Stats struct {
+	Online       bool       `json:"online"`
+	OfflineSince *time.Time `json:"offline_since,omitempty"`
+	PausedUntil  *time.Time `json:"paused_until,omitempty"`
+	Pending      int        `json:"pending"`
+	PendingBytes int64      `json:"pending_bytes"`
+	Oldest       *time.Time `json:"oldest,omitempty"`
+	Sent         uint64     `json:"sent"`
+	Failed       uint64     `json:"failed"`
+	Dropped      uint64     `json:"dropped"`
+	LastError    string     `json:"last_error,omitempty"`
+	Items        []ItemInfo `json:"items"`
+	FailedItems  []ItemInfo `json:"failed_items"`
+}
+
+// Box outbox บนดิสก์ + ตัวส่ง
+type Box struct {
+	mu    sync.Mutex
+	dir   string
+	items []*Item // เรียงตาม ID (= ลำดับที่เข้า)
+	bytes int64
+
+	maxItems int
+	maxBytes int64
+	minRetry time.Duration
+	maxRetry time.Duration
+	client   *http.Client
+	wake     chan struct{}
+
+	online       bool
+	offlineSince time.Time
+	pauseUntil   time.Time
+	outages      int // ต่อไม่ได้ติดกันกี่ครั้ง (ใช้คำนวณ backoff ของทั้งกล่อง)
+	lastError    string
+
+	sent, failed, dropped atomic.Uint64
+	seq                   atomic.Uint64
+}
+
+var (
+	defaultOnce sync.Once
+	defaultBox  *Box
+)
+
+// Default กล่องของทั้ง process (โหลดงานค้างจากดิสก์และเริ่มส่งครั้งแรกที่เรียก)
+func Default() *Box {
+	defaultOnce.Do(func() {
+		defaultBox = NewFromEnv()
+		defaultBox.load()
+		go defaultBox.run()
+	})
+	return defaultBox
+}
+
+func NewFromEnv() *Box {
+	dir := os.Getenv("OUTBOX_DIR")
+	if dir == "" {
+		dir = filepath.Join("data", "outbox")
+	}
+	return &Box{
+		dir:      dir,
+		maxItems: getenvInt("OUTBOX_MAX_ITEMS", 10000),
+		maxBytes: int64(getenvInt("OUTBOX_MAX_MB", 512)) << 20,
+		minRetry: getenvDuration("OUTBOX_RETRY_MIN", 2*time.Second),
+		maxRetry: getenvDuration("OUTBOX_RETRY_MAX", 5*time.Minute),
+		client: &http.Client{
+			Timeout:   getenvDuration("OUTBOX_TIMEOUT", 15*time.Second),
+			Transport: config.NewHTTPTransport(),
+		},
+		wake:   make(chan struct{}, 1),
+		online: true,
+	}
+}
+
+// Post ใส่งาน POST JSON เข้ากล่อง default
+func Post(key, label, url string, body any) {
+	Default().Enqueue(key, label, http.MethodPost, url, body)
+}
+
+// Put ใส่งาน PUT JSON เข้ากล่อง default
+func Put(key, label, url string, body any) {
+	Default().Enqueue(key, label, http.MethodPut, url, body)
+}
+
+// Enqueue เขียนงานลงดิสก์แล้วปลุกตัวส่ง (เขียนดิสก์ไม่ได้ = ส่งจากหน่วยความจำ ไม่รอด restart)
+func (b *Box) Enqueue(key, label, method, url string, body any) {
+	raw, err := json.Marshal(body)
+	if err != nil {
+		log.Printf("[outbox] %s: marshal body: %v", label, err)
+		return
+	}
+	now := time.Now()
+	it := &Item{
+		ID:      fmt.Sprintf("%020d-%06d", now.UnixNano(), b.seq.Add(1)%1e6),
+		Key:     key,
+		Label:   label,
+		Method:  method,
+		URL:     url,
+		Body:    raw,
+		Created: now,
+		NextAt:  now,
+	}
+
+	b.mu.Lock()
+	if err := b.save(it); err != nil {
+		log.Printf("[outbox] %s: %v (kept in memory only)", label, err)
+	}
+	b.items = append(b.items, it)
+	b.bytes += it.size
+	b.enforceLimits()
+	b.mu.Unlock()
+
+	b.Drain()
+}
+
+// Drain ปลุกตัวส่งให้ลองงานที่ถึงเวลาทันที
+func (b *Box) Drain() {
+	select {
+	case b.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Retry ล้าง backoff ทั้งหมดแล้วส่งทันที (ปุ่ม drain ของ admin / เน็ตกลับมา)
+func (b *Box) Retry() {
+	b.mu.Lock()
+	now := time.Now()
+	b.pauseUntil = time.Time{}
+	for _, it := range b.items {
+		it.NextAt = now
+	}
+	b.mu.Unlock()
+	b.Drain()
+}
+
+// Online false ถ้าครั้งล่าสุดต่อ Cloud ไม่ได้
+func (b *Box) Online() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.online
+}
+
+func (b *Box) run() {
+	t := time.NewTicker(time.Second)
+	defer t.Stop()
+	for {
+		select {
+		case <-b.wake:
+		case <-t.C:
+		}
+		for {
+			it := b.next()
+			if it == nil {
+				break
+			}
+			status, err := b.send(it)
+			b.done(it, status, err)
+		}
+	}
+}
+
+// next งานแรกที่ถึงเวลาและไม่มีงาน key เดียวกันรออยู่ข้างหน้า
+func (b *Box) next() *Item {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	if now.Before(b.pauseUntil) {
+		return nil
+	}
+	blocked := map[string]bool{}
+	for _, it := range b.items {
+		if it.Key != "" && blocked[it.Key] {
+			continue
+		}
+		if it.NextAt.After(now) {
+			if it.Key != "" {
+				blocked[it.Key] = true
+			}
+			continue
+		}
+		return it
+	}
+	return nil
+}
+
+func (b *Box) send(it *Item) (int, error) {
+	req, err := http.NewRequest(it.Method, it.URL, bytes.NewReader(it.Body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	return resp.StatusCode, nil
+}
+
+func (b *Box) done(it *Item, status int, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.has(it) {
+		return // ถูกทิ้งเพราะกล่องเต็มระหว่างส่ง
+	}
+	now := time.Now()
+	it.Attempts++
+
+	switch {
+	case err != nil:
+		// ต่อ Cloud ไม่ได้ → หยุดทั้งกล่องตาม backoff (ไม่ยิงงานอื่นให้ timeout ซ้ำ)
+		it.LastError = err.Error()
+		b.lastError = it.LastError
+		b.outages++
+		if b.online {
+			b.online, b.offlineSince = false, now
+			log.Printf("[outbox] cloud unreachable (%v) — %d item(s) pending", err, len(b.items))
+		}
+		b.pauseUntil = now.Add(b.backoff(b.outages))
+		it.NextAt = b.pauseUntil
+		b.persist(it)
+
+	case status >= 200 && status < 300:
+		b.remove(it)
+		b.sent.Add(1)
+		b.outages = 0
+		if !b.online {
+			b.online = true
+			log.Printf("[outbox] cloud reachable again after %s — draining %d item(s)",
+				now.Sub(b.offlineSince).Round(time.Second), len(b.items))
+			for _, p := range b.items {
+				p.NextAt = now
+			}
+		}
+
+	case status == http.StatusRequestTimeout || status == http.StatusTooManyRequests || status >= 500:
+		it.LastError = fmt.Sprintf("HTTP %d", status)
+		b.lastError = it.LastError
+		b.outages = 0
+		b.online = true
+		it.NextAt = now.Add(b.backoff(it.Attempts))
+		b.persist(it)
+
+	default:
+		// 4xx อื่น ส่งซ้ำก็ไม่ผ่าน — เก็บไว้ให้คนดู
+		it.LastError = fmt.Sprintf("HTTP %d", status)
+		b.lastError = it.LastError
+		log.Printf("[outbox] %s %s rejected with %d — moved to failed/", it.Label, it.ID, status)
+		b.failed.Add(1)
+		b.moveToFailed(it)
+	}
+}
+
+func (b *Box) has(it *Item) bool {
+	for _, p := range b.items {
+		if p == it {
+			return true
+		}
+	}
+	return false
+}
+
+func (b *Box) backoff(n int) time.Duration {
+	d := b.minRetry
+	for i := 1; i < n && d < b.maxRetry; i++ {
+		d *= 2
+	}
+	if d > b.maxRetry {
+		d = b.maxRetry
+	}
+	return d
+}
+
+// enforceLimits ทิ้งงานเก่าสุดเมื่อเกิน OUTBOX_MAX_ITEMS / OUTBOX_MAX_MB (เรียกตอนถือ lock)
+func (b *Box) enforceLimits() {
+	for len(b.items) > 1 && (len(b.items) > b.maxItems || (b.maxBytes > 0 && b.bytes > b.maxBytes)) {
+		old := b.items[0]
+		log.Printf("[outbox] full — dropped %s %s (created %s)", old.Label, old.ID, old.Created.Format(time.RFC3339))
+		b.remove(old)
+		b.dropped.Add(1)
+	}
+}
+
+// Stats สถานะ + งานค้าง (สูงสุด limit รายการ) สำหรับ admin
+func (b *Box) Stats(limit int) Stats {
+	b.mu.Lock()
+	st := Stats{
+		Online:       b.online,
+		Pending:      len(b.items),
+		PendingBytes: b.bytes,
+		Sent:         b.sent.Load(),
+		Failed:       b.failed.Load(),
+		Dropped:      b.dropped.Load(),
+		LastError:    b.lastError,
+		Items:        []ItemInfo{},
+	}
+	if !b.online {
+		t := b.offlineSince
+		st.OfflineSince = &t
+	}
+	if time.Now().Before(b.pauseUntil) {
+		t := b.pauseUntil
+		st.PausedUntil = &t
+	}
+	if len(b.items) > 0 {
+		t := b.items[0].Created
+		st.Oldest = &t
+	}
+	for _, it := range b.items {
+		if len(st.Items) >= limit {
+			break
+		}
+		st.Items = append(st.Items, it.info())
+	}
+	b.mu.Unlock()
+
+	st.FailedItems = b.failedItems(limit)
+	return st
+}
+
+func (it *Item) info() ItemInfo {
+	return ItemInfo{
+		ID: it.ID, Key: it.Key, Label: it.Label, Method: it.Method, URL: it.URL, Size: it.size,
+		Created: it.Created, Attempts: it.Attempts, NextAt: it.NextAt, LastError: it.LastError,
+	}
+}
+
+// ---------- disk ----------
+
+func (b *Box) path(id string) string { return filepath.Join(b.dir, id+".json") }
+
+func (b *Box) failedDir() string { return filepath.Join(b.dir, "failed") }
+
+// save เขียนงานแบบ atomic (tmp → fsync → rename)
+func (b *Box) save(it *Item) error {
+	data, err := json.Marshal(it)
+	if err != nil {
+		return err
+	}
+	it.size = int64(len(data))
+	if err := os.MkdirAll(b.dir, 0o755); err != nil {
+		return err
+	}
+	tmp := b.path(it.ID) + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(data); err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, b.path(it.ID))
+	}
+	if err != nil {
+		os.Remove(tmp)
+	}
+	return err
+}
+
+// persist บันทึก attempts/next_at หลังส่งไม่ผ่าน
+func (b *Box) persist(it *Item) {
+	old := it.size
+	if err := b.save(it); err != nil {
+		log.Printf("[outbox] save %s: %v", it.ID, err)
+		return
+	}
+	b.bytes += it.size - old
+}
+
+func (b *Box) remove(it *Item) {
+	for i, p := range b.items {
+		if p == it {
+			b.items = append(b.items[:i], b.items[i+1:]...)
+			b.bytes -= it.size
+			break
+		}
+	}
+	if err := os.Remove(b.path(it.ID)); err != nil && !os.IsNotExist(err) {
+		log.Printf("[outbox] remove %s: %v", it.ID, err)
+	}
+}
+
+func (b *Box) moveToFailed(it *Item) {
+	if err := os.MkdirAll(b.failedDir(), 0o755); err == nil {
+		if data, err := json.Marshal(it); err == nil {
+			_ = os.WriteFile(filepath.Join(b.failedDir(), it.ID+".json"), data, 0o644)
+		}
+	}
+	b.remove(it)
+}
+
+// load อ่านงานค้างจากรอบก่อน
+func (b *Box) load() {
+	names, _ := filepath.Glob(filepath.Join(b.dir, "*.json"))
+	sort.Strings(names)
+	now := time.Now()
+	for _, name := range names {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			continue
+		}
+		var it Item
+		if err := json.Unmarshal(data, &it); err != nil || it.ID == "" {
+			log.Printf("[outbox] skip %s: invalid item", filepath.Base(name))
+			continue
+		}
+		it.size = int64(len(data))
+		it.NextAt = now // restart = ลองใหม่ทันที
+		b.items = append(b.items, &it)
+		b.bytes += it.size
+	}
+	if len(b.items) > 0 {
+		log.Printf("[outbox] loaded %d pending item(s) from %s", len(b.items), b.dir)
+	}
+}
+
+func (b *Box) failedItems(limit int) []ItemInfo {
+	out := []ItemInfo{}
+	names, _ := filepath.Glob(filepath.Join(b.failedDir(), "*.json"))
+	sort.Sort(sort.Reverse(sort.StringSlice(names))) // ใหม่ก่อน
+	for _, name := range names {
+		if len(out) >= limit {
+			break
+		}
+		data, err := os.ReadFile(name)
+		if err != nil {
+			continue
+		}
+		var it Item
+		if json.Unmarshal(data, &it) == nil {
+			it.size = int64(len(data))
+			out = append(out, it.info())
+		}
+	}
+	return out
+}
+
+func getenvInt(k string, def int) int {
+	if v := strings.TrimSpace(os.Getenv(k)); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			return n
+		}
+	}
+	return def
+}
+
+func getenvDuration(k string, def time.Duration) time.Duration {
+	if v := strings.TrimSpace(os.Getenv(k)); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			return d
+		}
+	}
+	return def
+}
@@ -0,0 +1,142 @@
+package outbox
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testBox กล่องใน temp dir ที่ไม่ได้ run — เรียก next/done เองทีละขั้น
+func testBox(t *testing.T) *Box {
+	t.Helper()
+	t.Setenv("OUTBOX_DIR", t.TempDir())
+	t.Setenv("OUTBOX_RETRY_MIN", "1s")
+	t.Setenv("OUTBOX_RETRY_MAX", "8s")
+	return NewFromEnv()
+}
+
+func TestNextKeepsKeyOrder(t *testing.T) {
+	b := testBox(t)
+	b.Enqueue("ev-1", "a", http.MethodPost, "http://cloud/a", nil)
+	b.Enqueue("ev-1", "b", http.MethodPost, "http://cloud/b", nil)
+	b.Enqueue("ev-2", "c", http.MethodPost, "http://cloud/c", nil)
+	b.Enqueue("", "d", http.MethodPost, "http://cloud/d", nil)
+
+	steps := []struct {
+		want   string // label ที่ next ต้องคืน ("" = ไม่มีงานพร้อมส่ง)
+		status int
+	}{
+		{"a", http.StatusServiceUnavailable}, // a รอ backoff → b (key เดียวกัน) ต้องรอด้วย
+		{"c", http.StatusOK},
+		{"d", http.StatusOK},
+		{"", 0},
+	}
+	for i, s := range steps {
+		it := b.next()
+		got := ""
+		if it != nil {
+			got = it.Label
+		}
+		if got != s.want {
+			t.Fatalf("step %d: next = %q, want %q", i, got, s.want)
+		}
+		if it != nil {
+			b.done(it, s.status, nil)
+		}
+	}
+
+	// a ถึงเวลาแล้ว → a ก่อน b เสมอ
+	b.Retry()
+	for _, want := range []string{"a", "b"} {
+		it := b.next()
+		if it == nil || it.Label != want {
+			t.Fatalf("after retry: next = %v, want %q", it, want)
+		}
+		b.done(it, http.StatusOK, nil)
+	}
+	if st := b.Stats(10); st.Pending != 0 || st.Sent != 4 {
+		t.Errorf("pending=%d sent=%d, want 0 and 4", st.Pending, st.Sent)
+	}
+}
+
+func TestDone(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		err        error
+		wantKept   bool // ยังอยู่ในกล่อง (ลองใหม่)
+		wantFailed bool // ย้ายไป failed/
+		wantPaused bool // ทั้งกล่องหยุดรอ (ต่อ Cloud ไม่ได้)
+	}{
+		{"2xx removes", http.StatusCreated, nil, false, false, false},
+		{"5xx retries", http.StatusBadGateway, nil, true, false, false},
+		{"408 retries", http.StatusRequestTimeout, nil, true, false, false},
+		{"429 retries", http.StatusTooManyRequests, nil, true, false, false},
+		{"400 moves to failed", http.StatusBadRequest, nil, false, true, false},
+		{"404 moves to failed", http.StatusNotFound, nil, false, true, false},
+		{"unreachable pauses the box", 0, errors.New("connection refused"), true, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := testBox(t)
+			b.Enqueue("ev-1", "x", http.MethodPost, "http://cloud/x", map[string]any{"n": 1})
+			it := b.next()
+			b.done(it, tt.status, tt.err)
+
+			if kept := b.has(it); kept != tt.wantKept {
+				t.Errorf("kept = %v, want %v", kept, tt.wantKept)
+			}
+			_, err := os.Stat(b.path(it.ID))
+			if onDisk := err == nil; onDisk != tt.wantKept {
+				t.Errorf("pending file exists = %v, want %v", onDisk, tt.wantKept)
+			}
+			_, err = os.Stat(filepath.Join(b.failedDir(), it.ID+".json"))
+			if failed := err == nil; failed != tt.wantFailed {
+				t.Errorf("failed/ file exists = %v, want %v", failed, tt.wantFailed)
+			}
+			if paused := time.Now().Before(b.pauseUntil); paused != tt.wantPaused {
+				t.Errorf("paused = %v, want %v", paused, tt.wantPaused)
+			}
+			if b.Online() == tt.wantPaused {
+				t.Errorf("online = %v, want %v", b.Online(), !tt.wantPaused)
+			}
+			if tt.wantKept && b.next() != nil {
+				t.Error("retried item sent again before its backoff")
+			}
+		})
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	b := testBox(t)
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{0, time.Second},
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{3, 4 * time.Second},
+		{4, 8 * time.Second},
+		{5, 8 * time.Second}, // ไม่เกิน OUTBOX_RETRY_MAX
+		{50, 8 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := b.backoff(tt.attempts); got != tt.want {
+			t.Errorf("backoff(%d) = %s, want %s", tt.attempts, got, tt.want)
+		}
+	}
+
+	// 5xx ติดกันหลายครั้ง → next_at ห่างไม่เกิน max
+	b.Enqueue("ev-1", "x", http.MethodPost, "http://cloud/x", nil)
+	it := b.next()
+	for range 10 {
+		b.done(it, http.StatusInternalServerError, nil)
+	}
+	if wait := time.Until(it.NextAt); wait > 8*time.Second {
+		t.Errorf("next retry in %s after %d attempts, want <= 8s", wait.Round(time.Second), it.Attempts)
+	}
+}
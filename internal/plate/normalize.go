@@ -0,0 +1,211 @@
+package plate
+
+import (
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// ---------- Thai licence plate normalization ----------
+//
+// ป้ายจากกล้องเป็นข้อความดิบของ OCR เช่น "1กก 1234 กรุงเทพมหานคร", "กข-๑๒๓๔", "กข12O4"
+// Normalize แปลงเป็นรูปแบบเดียว (canonical) ก่อนส่ง Cloud และให้ป้ายใกล้เคียง (candidates)
+// ไว้ลองซ้ำเมื่อหาไม่เจอ
+//
+// ENV:
+//   PLATE_NORMALIZE=true          false = ส่งป้ายตามที่กล้องอ่าน (แบบเดิม)
+//   PLATE_CANDIDATE_RETRY=3       จำนวน candidate ที่ลองซ้ำตอนขาออกหาไม่เจอ (0 = ไม่ลอง)
+
+// Plate ผลการ normalize
+type Plate struct {
+	Raw        string   `json:"raw"`
+	Canonical  string   `json:"canonical"`
+	Province   string   `json:"province,omitempty"`
+	Candidates []string `json:"candidates,omitempty"` // ป้ายที่ OCR อาจอ่านสลับ (ไม่รวม Canonical)
+}
+
+const maxCandidates = 8
+
+// ตัวอักษรละตินที่ OCR อ่านแทนตัวเลข (ใช้เฉพาะตำแหน่งที่ต้องเป็นตัวเลข)
+var latinDigit = map[rune]rune{
+	'O': '0', 'Q': '0', 'D': '0',
+	'I': '1', 'L': '1',
+	'Z': '2',
+	'S': '5',
+	'G': '6',
+	'B': '8',
+}
+
+// พยัญชนะไทยที่ OCR สับสนบ่อย (สลับได้ทั้งสองทาง)
+var thaiConfusions = [][2]rune{
+	{'ข', 'ช'}, {'ค', 'ด'}, {'บ', 'ป'}, {'ผ', 'พ'}, {'ฝ', 'ฟ'},
+	{'ฎ', 'ฏ'}, {'ถ', 'ภ'}, {'ท', 'ม'}, {'ฃ', 'ข'}, {'ฅ', 'ค'},
+}
+
+var digitConfusions = [][2]rune{{'0', '8'}, {'1', '7'}, {'5', '6'}}
+
+// ชื่อย่อ → ชื่อเต็มของจังหวัด
+var provinceAlias = map[string]string{
+	"กรุงเทพ": "กรุงเทพมหานคร",
+	"กทม":     "กรุงเทพมหานคร",
+	"อยุธยา":  "พระนครศรีอยุธยา",
+}
+
+func init() {
+	// ชื่อยาวก่อน — "กรุงเทพมหานคร" ต้องเจอก่อน "กรุงเทพ"
+	sort.SliceStable(provinces, func(i, j int) bool { return len(provinces[i]) > len(provinces[j]) })
+}
+
+// Normalize คืนป้ายแบบ canonical + candidates ("" หรือ unknown คืน Canonical ตามเดิม)
+func Normalize(raw string) Plate {
+	p := Plate{Raw: raw}
+	s := strings.TrimSpace(raw)
+	if s == "" || strings.EqualFold(s, "unknown") {
+		p.Canonical = s
+		return p
+	}
+
+	// เลขไทย → เลขอารบิก, ตัด space / ขีด / จุด, ละติน → ตัวใหญ่
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r >= '๐' && r <= '๙':
+			b.WriteRune('0' + (r - '๐'))
+		case unicode.IsSpace(r) || r == '-' || r == '.' || r == '_' || r == '·':
+		default:
+			b.WriteRune(unicode.ToUpper(r))
+		}
+	}
+	s = b.String()
+
+	// จังหวัดต่อท้าย (ต้องตามหลังตัวเลขของป้าย ไม่งั้นไม่ใช่จังหวัด)
+	for _, name := range provinces {
+		rest := strings.TrimSuffix(s, name)
+		if rest == s || rest == "" {
+			continue
+		}
+		if last := []rune(rest)[len([]rune(rest))-1]; unicode.IsDigit(last) || latinDigit[last] != 0 {
+			p.Province = name
+			if full, ok := provinceAlias[name]; ok {
+				p.Province = full
+			}
+			s = rest
+			break
+		}
+	}
+
+	runes := keepPlateRunes([]rune(s))
+	fixDigitPositions(runes)
+	p.Canonical = string(runes)
+	p.Candidates = candidates(runes)
+	if isTruckPlate(p.Canonical) {
+		// ป้ายรถบรรทุก/รถโดยสาร (เลขล้วน 6 หลัก) เขียนแบบ NN-NNNN
+		p.Canonical = truckFormat(p.Canonical)
+		for i, c := range p.Candidates {
+			p.Candidates[i] = truckFormat(c)
+		}
+	}
+	return p
+}
+
+func isTruckPlate(s string) bool {
+	if len(s) != 6 {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func truckFormat(s string) string {
+	return s[:2] + "-" + s[2:]
+}
+
+// keepPlateRunes เก็บเฉพาะพยัญชนะไทย ตัวเลข และละติน (ตัดสระ/วรรณยุกต์ที่ OCR ใส่มาเกิน)
+func keepPlateRunes(rs []rune) []rune {
+	out := rs[:0]
+	for _, r := range rs {
+		if isThaiConsonant(r) || unicode.IsDigit(r) || (r >= 'A' && r <= 'Z') {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// fixDigitPositions ป้ายไทย = [เลข 0-2 หลัก][พยัญชนะ 1-3 ตัว][เลข 1-4 หลัก]
+// ตัวละตินที่อยู่หน้าพยัญชนะตัวแรกหรือหลังพยัญชนะตัวสุดท้ายคือเลขที่ OCR อ่านผิด (O→0, B→8 ...)
+func fixDigitPositions(rs []rune) {
+	first, last := -1, -1
+	for i, r := range rs {
+		if isThaiConsonant(r) {
+			if first < 0 {
+				first = i
+			}
+			last = i
+		}
+	}
+	if first < 0 {
+		return // ไม่ใช่ป้ายไทย (ป้ายต่างประเทศ) — ไม่เดา
+	}
+	for i, r := range rs {
+		if i > first && i < last {
+			continue
+		}
+		if d, ok := latinDigit[r]; ok {
+			rs[i] = d
+		}
+	}
+}
+
+// candidates สลับทีละตำแหน่งตามตารางที่ OCR สับสน (พยัญชนะก่อน แล้วค่อยตัวเลข)
+func candidates(rs []rune) []string {
+	seen := map[string]bool{string(rs): true}
+	var out []string
+	add := func(i int, r rune) {
+		if len(out) >= maxCandidates {
+			return
+		}
+		c := append([]rune(nil), rs...)
+		c[i] = r
+		if s := string(c); !seen[s] {
+			seen[s] = true
+			out = append(out, s)
+		}
+	}
+	for _, table := range [][][2]rune{thaiConfusions, digitConfusions} {
+		for i, r := range rs {
+			for _, pair := range table {
+				switch r {
+				case pair[0]:
+					add(i, pair[1])
+				case pair[1]:
+					add(i, pair[0])
+				}
+			}
+		}
+	}
+	return out
+}
+
+func isThaiConsonant(r rune) bool {
+	return r >= 'ก' && r <= 'ฮ'
+}
+
+// Enabled PLATE_NORMALIZE (default true)
+func Enabled() bool {
+	v := strings.ToLower(strings.TrimSpace(os.Getenv("PLATE_NORMALIZE")))
+	return v != "false" && v != "0" && v != "no"
+}
+
+// RetryLimit PLATE_CANDIDATE_RETRY (default 3)
+func RetryLimit() int {
+	if n, err := strconv.Atoi(os.Getenv("PLATE_CANDIDATE_RETRY")); err == nil && n >= 0 {
+		return n
+	}
+	return 3
+}
@@ -0,0 +1,109 @@
+package plate
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name      string
+		raw       string
+		canonical string
+		province  string
+		candidate string // ต้องอยู่ใน Candidates ("" = ไม่เช็ค)
+	}{
+		{"already canonical", "กข1234", "กข1234", "", "กช1234"},
+		{"kho/cho confusion", "กช1234", "กช1234", "", "กข1234"},
+		{"thai digits and hyphen", "กข-๑๒๓๔", "กข1234", "", ""},
+		{"spaces and dot", " กข 12.34 ", "กข1234", "", ""},
+		{"latin O as zero", "กข12O4", "กข1204", "", "กข1284"},
+		{"latin B as eight", "กขB234", "กข8234", "", "กข0234"},
+		{"latin O before consonant", "1กกO234", "1กก0234", "", ""},
+		{"leading digit prefix", "1กก 1234", "1กก1234", "", "7กก1234"},
+		{"province suffix", "1กก 1234 กรุงเทพมหานคร", "1กก1234", "กรุงเทพมหานคร", ""},
+		{"province alias", "กข 1234 กทม", "กข1234", "กรุงเทพมหานคร", ""},
+		{"province short name", "กข1234 อยุธยา", "กข1234", "พระนครศรีอยุธยา", ""},
+		{"province with vowels", "กข 12 34 เชียงใหม่", "กข1234", "เชียงใหม่", ""},
+		{"province sharing consonants with plate", "ชล 99 ชลบุรี", "ชล99", "ชลบุรี", "ขล99"},
+		{"stray tone mark", "ก่ข1234", "กข1234", "", ""},
+		{"truck plate", "701234", "70-1234", "", "78-1234"},
+		{"truck plate with hyphen", "70-1234", "70-1234", "", ""},
+		{"foreign plate untouched", "ABC123", "ABC123", "", ""},
+		{"unknown", "unknown", "unknown", "", ""},
+		{"empty", "  ", "", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := Normalize(tt.raw)
+			if p.Raw != tt.raw {
+				t.Errorf("Raw = %q, want %q", p.Raw, tt.raw)
+			}
+			if p.Canonical != tt.canonical {
+				t.Errorf("Canonical = %q, want %q", p.Canonical, tt.canonical)
+			}
+			if p.Province != tt.province {
+				t.Errorf("Province = %q, want %q", p.Province, tt.province)
+			}
+			if tt.candidate != "" && !slices.Contains(p.Candidates, tt.candidate) {
+				t.Errorf("Candidates = %q, want to contain %q", p.Candidates, tt.candidate)
+			}
+			if slices.Contains(p.Candidates, p.Canonical) {
+				t.Errorf("Candidates %q contain Canonical", p.Candidates)
+			}
+			if len(p.Candidates) > maxCandidates {
+				t.Errorf("len(Candidates) = %d, want <= %d", len(p.Candidates), maxCandidates)
+			}
+		})
+	}
+}
+
+func TestFixDigitPositions(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"กขO234", "กข0234"},
+		{"Oกข1234", "0กข1234"},
+		{"กOข1234", "กOข1234"}, // ระหว่างพยัญชนะไม่ใช่ตำแหน่งตัวเลข — ไม่เดา
+		{"กขSZIB", "กข5218"},
+		{"ABO123", "ABO123"}, // ไม่มีพยัญชนะไทย
+	}
+	for _, tt := range tests {
+		rs := []rune(tt.in)
+		fixDigitPositions(rs)
+		if got := string(rs); got != tt.want {
+			t.Errorf("fixDigitPositions(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestCandidates(t *testing.T) {
+	got := candidates([]rune("ขค08"))
+	want := []string{"ชค08", "ฃค08", "ขด08", "ขฅ08", "ขค88", "ขค00"}
+	if !slices.Equal(got, want) {
+		t.Errorf("candidates = %q, want %q", got, want)
+	}
+
+	// ยาวมาก → ไม่เกิน maxCandidates
+	if got := candidates([]rune("ขขขขขขขขขข")); len(got) != maxCandidates {
+		t.Errorf("len = %d, want %d", len(got), maxCandidates)
+	}
+	if got := candidates([]rune("ฮฮ44")); len(got) != 0 {
+		t.Errorf("candidates without confusions = %q, want none", got)
+	}
+}
+
+func TestTruckPlate(t *testing.T) {
+	for s, want := range map[string]bool{
+		"701234":  true,
+		"70123":   false,
+		"7012345": false,
+		"70ก234":  false,
+		"70-123":  false,
+	} {
+		if got := isTruckPlate(s); got != want {
+			t.Errorf("isTruckPlate(%q) = %v, want %v", s, got, want)
+		}
+	}
+	if got := truckFormat("701234"); got != "70-1234" {
+		t.Errorf("truckFormat = %q, want 70-1234", got)
+	}
+}
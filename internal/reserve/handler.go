@@ -6,52 +6,28 @@ import (
 	"crypto/tls"
 	"encoding/base64"
 	"encoding/json"
-	"encoding/xml"
 	"fmt"
 	"io"
 	"log"
-	"mime"
-	"mime/multipart"
 	"net/http"
-	"strings"
 	"time"
 
 	digest "github.com/icholy/digest"
 
+	"GO_LANG_WORKSPACE/internal/anpr"
 	"GO_LANG_WORKSPACE/internal/barrier_v2"
 	"GO_LANG_WORKSPACE/internal/config"
+	"GO_LANG_WORKSPACE/internal/events"
+	"GO_LANG_WORKSPACE/internal/offline"
+	"GO_LANG_WORKSPACE/internal/outbox"
 	"GO_LANG_WORKSPACE/internal/utils"
 	"GO_LANG_WORKSPACE/internal/ws"
-
-	"github.com/gin-gonic/gin"
 )
 
-type eventXML struct {
-	XMLName   xml.Name `xml:"http://www.isapi.org/ver20/XMLSchema EventNotificationAlert"`
-	IPAddress string   `xml:"ipAddress"`
-	DateTime  string   `xml:"dateTime"`
-	UUID      string   `xml:"UUID"`
-	ANPR      struct {
-		VehicleType  string `xml:"vehicleType"`
-		LicensePlate string `xml:"licensePlate"`
-	} `xml:"ANPR"`
-}
-
-// แบบไม่มี namespace (fallback)
-type eventXMLNoNS struct {
-	XMLName   xml.Name `xml:"EventNotificationAlert"`
-	IPAddress string   `xml:"ipAddress"`
-	DateTime  string   `xml:"dateTime"`
-	UUID      string   `xml:"UUID"`
-	ANPR      struct {
-		VehicleType  string `xml:"vehicleType"`
-		LicensePlate string `xml:"licensePlate"`
-	} `xml:"ANPR"`
-}
-
 type Handler struct {
 	cfg        *config.Config
 	hub        *ws.Hub
+	events     *events.Publisher
 	httpClient *http.Client
 	camClient  *http.Client
 }
@@ -78,362 +54,156 @@ func NewHandler(cfg *config.Config, hub *ws.Hub) *Handler {
 	return &Handler{
 		cfg:        cfg,
 		hub:        hub,
+		events:     events.NewPublisher(hub),
 		httpClient: httpCli,
 		camClient:  camCli,
 	}
 }
 
-// VerifyReserve = POST /api/v2-202402/reserve/verify-reserve
-func (h *Handler) VerifyReserve(c *gin.Context) {
-	t0 := time.Now()
-
-	// ---------- Step 1: Validate Request + limit body ----------
-	ct := c.GetHeader("Content-Type")
-	mediaType, params, err := mime.ParseMediaType(ct)
-	if err != nil || !strings.HasPrefix(mediaType, "multipart/") {
-		c.String(http.StatusOK, "Invalid request")
-		return
+// Routes เส้นทางกล้องของ reserve สำหรับ anpr pipeline
+//
+//	POST /api/v2-202402/reserve/entrance?gate_no=1  → reserve_in
+//	POST /api/v2-202402/reserve/exit?gate_no=1      → reserve_out
+func (h *Handler) Routes() []anpr.Route {
+	return []anpr.Route{
+		{Name: "reserve_in", Label: "RESERVE IN", Direction: "ENT", Location: "RESE", Decide: h.decideEntrance,
+			Room: func(ev *anpr.PlateEvent) string { return "reserve_in_" + ev.GateNo }},
+		{Name: "reserve_out", Label: "RESERVE OUT", Direction: "EXT", Location: "RESE", Decide: h.decideExit,
+			Room: func(ev *anpr.PlateEvent) string { return "reserve_out_" + ev.GateNo }},
 	}
+}
 
-	const maxBody = int64(16 << 20) // 16MB
-	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBody)
-	defer c.Request.Body.Close()
-
-	mr := multipart.NewReader(c.Request.Body, params["boundary"])
-	t1 := time.Since(t0)
-
-	// ---------- Step 2: Separate Files ----------
-	var xmlBuf []byte
-	var lpImg []byte
-	var detectImg = []byte(nil)
+// decideEntrance ขาเข้าที่จอง: entrance-lpr → เปิดไม้กั้น → broadcast reserve_in_<gate>
+func (h *Handler) decideEntrance(ctx context.Context, ev *anpr.PlateEvent) error {
+	h.verify(ev, "ENT", "/api/v1/reserve/entrance-lpr", "VerifyReserve")
+	return nil
+}
 
-	parts := 0
-	const maxParts = 10
+// decideExit ขาออกที่จอง: exit-lpr → เปิดไม้กั้น → broadcast reserve_out_<gate>
+func (h *Handler) decideExit(ctx context.Context, ev *anpr.PlateEvent) error {
+	h.verify(ev, "EXT", "/api/v1/reserve/exit-lpr", "VerifyReserveExit")
+	return nil
+}
 
-	for {
-		part, err := mr.NextPart()
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			if ne, ok := err.(interface{ Timeout() bool }); ok && ne.Timeout() {
-				c.String(http.StatusRequestTimeout, "multipart read timeout")
-			} else {
-				c.String(http.StatusOK, "invalid multipart")
-			}
-			return
-		}
+// verify ขั้นตอนร่วมของ reserve ทั้งสองทิศ (ต่างกันแค่ API ของ Cloud และห้อง)
+func (h *Handler) verify(ev *anpr.PlateEvent, direction, apiPath, tag string) {
+	plate, gateNo := ev.Plate, ev.GateNo
 
-		parts++
-		if parts > maxParts {
-			_ = part.Close()
-			c.String(http.StatusOK, "too many parts")
-			return
-		}
+	h.postParkingLicensePlate(ev.UUID, plate, ev.CameraIP, h.cfg.ParkingCode, ev.Metadata())
+	ev.Mark("plpPost")
 
-		fn := part.FileName()
-		if fn == "" {
-			_, _ = io.Copy(io.Discard, part)
-			_ = part.Close()
-			continue
-		}
-
-		buf, _ := io.ReadAll(part)
-		_ = part.Close()
-
-		switch {
-		case strings.HasSuffix(strings.ToLower(fn), ".xml"):
-			xmlBuf = buf
-		case fn == "licensePlatePicture.jpg":
-			lpImg = buf
-		case fn == "detectedImage.jpg" || fn == "pedestrianDetectionPicture.jpg":
-			detectImg = buf
-		default:
-		}
+	room, eventType := "reserve_in_"+gateNo, events.TypeReserveEntry
+	if direction == "EXT" {
+		room, eventType = "reserve_out_"+gateNo, events.TypeReserveExit
 	}
 
-	if len(xmlBuf) == 0 {
-		c.String(http.StatusOK, "Missing XML file")
+	// confidence ต่ำกว่า ANPR_MIN_CONFIDENCE → แจ้งอ่านป้ายไม่ได้ ไม่ถาม Cloud / ไม่เปิดไม้กั้น
+	if ev.LowConfidence {
+		h.unreadable(ev, room, direction)
 		return
 	}
-	t2 := time.Since(t0) - t1
-
-	// ---------- Step 3: Parse XML ----------
-	var plate, uuid, timeIn, ip, vehicleType string
-	{
-		var ev eventXML
-		if err := xml.Unmarshal(xmlBuf, &ev); err == nil && strings.TrimSpace(ev.ANPR.LicensePlate) != "" {
-			plate = strings.TrimSpace(ev.ANPR.LicensePlate)
-			uuid = strings.TrimSpace(ev.UUID)
-			timeIn = strings.TrimSpace(ev.DateTime)
-			ip = strings.TrimSpace(ev.IPAddress)
-			vehicleType = strings.TrimSpace(ev.ANPR.VehicleType)
-		} else {
-			var ev2 eventXMLNoNS
-			if err2 := xml.Unmarshal(xmlBuf, &ev2); err2 == nil && strings.TrimSpace(ev2.ANPR.LicensePlate) != "" {
-				plate = strings.TrimSpace(ev2.ANPR.LicensePlate)
-				uuid = strings.TrimSpace(ev2.UUID)
-				timeIn = strings.TrimSpace(ev2.DateTime)
-				ip = strings.TrimSpace(ev2.IPAddress)
-				vehicleType = strings.TrimSpace(ev.ANPR.VehicleType)
-			}
-		}
-	}
-	if plate == "" {
-		c.String(http.StatusOK, "Failed to parse XML")
-		return
-	}
-	t3 := time.Since(t0) - t1 - t2
-
-	// ---------- Step 4: Call Reserve API instead of Get Customer ID ----------
-	gateNo := c.Query("gate_no")
-	t4 := time.Since(t0) - t1 - t2 - t3
 
-	go h.postParkingLicensePlate(plate, ip, h.cfg.ParkingCode)
-	t5 := time.Since(t0) - t1 - t2 - t3 - t4
-
-	// NEW LOGIC START
-	apiURL := fmt.Sprintf("%s/api/v1/reserve/entrance-lpr", h.cfg.ServerURL)
+	apiURL := fmt.Sprintf("%s%s", h.cfg.ServerURL, apiPath)
 	body := map[string]any{
 		"license_plate": plate,
 		"parking_code":  h.cfg.ParkingCode,
 	}
+	if meta := ev.Metadata(); meta != nil {
+		body["anpr"] = meta
+	}
 
-	// Log always
-	// Check status
 	var jsonRes map[string]any
 	isSuccess := false
 
+	// ประตูปิดตามตารางเวลา → ไม่ต้องแจ้ง Cloud
+	mode := config.GateModeAt(direction, "RESE", gateNo, time.Now())
+
 	b, _ := json.Marshal(body)
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, apiURL, bytes.NewReader(b))
 	req.Header.Set("Content-Type", "application/json")
-	resp, err := h.httpClient.Do(req)
 
-	if err != nil {
-		log.Printf("[VerifyReserve] API Request Error: %v", err)
+	var resp *http.Response
+	var err error
+	started := time.Now()
+	if mode == config.ModeClosed {
+		jsonRes = map[string]any{"status": false, "message": mode.Message()}
+	} else if !offline.Allow() {
+		err = offline.ErrOpen
 	} else {
-		defer resp.Body.Close()
-		respBody, _ := io.ReadAll(resp.Body)
-		log.Printf("[VerifyReserve] API Response Status: %d, Body: %s", resp.StatusCode, string(respBody))
-
-		// Try to parse json regardless of status code
-		_ = json.Unmarshal(respBody, &jsonRes)
-
-		if resp.StatusCode == 200 {
-			isSuccess = true
-		}
-	}
-
-	t6 := time.Since(t0) - t1 - t2 - t3 - t4 - t5
-
-	// 3. If 200 -> open barrier
-	if isSuccess {
-		if err := barrier_v2.OpenReserveBarrierByGate("ENT", gateNo); err != nil {
-			log.Printf("[VerifyReserve] Open Barrier Error: %v", err)
-		} else {
-			log.Printf("[VerifyReserve] Barrier Opened for gate %s", gateNo)
-		}
-	}
-
-	if lpImg == nil {
-		lpImg = detectImg
-	}
-
-	payload := map[string]any{
-		"license_plate":            plate,
-		"uuid":                     uuid,
-		"time_in":                  timeIn,
-		"vehicle_type":             utils.VehicleType(vehicleType),
-		"license_plate_img_base64": base64.StdEncoding.EncodeToString(lpImg),
-	}
-
-	respPayload := map[string]any{
-		"status":  jsonRes["status"],
-		"message": jsonRes["message"],
-		"data":    payload,
+		resp, err = h.httpClient.Do(req)
 	}
 
-	log.Printf("[VerifyReserve] payload: %v", respPayload)
-
-	// Merge API response into payload for broadcast
-	for k, v := range jsonRes {
-		payload[k] = v
-	}
-
-	// 4. Broadcast to /reserve-in/:gate_no
-	room := "reserve_in_" + gateNo
-	h.broadcastJSON(room, respPayload)
-
-	t7 := time.Since(t0) - t1 - t2 - t3 - t4 - t5 - t6
-
-	h.logTimingsEntrance(c, t0, t1, t2, t3, t4, t5, t6, t7, plate)
-	c.String(http.StatusOK, "File(s) uploaded successfully")
-}
-
-// VerifyReserveExit = POST /api/v2-202402/reserve/verify-reserve-exit?gate_no=1
-func (h *Handler) VerifyReserveExit(c *gin.Context) {
-	t0 := time.Now()
-
-	// ---------- Step 1: Validate Request + limit body ----------
-	ct := c.GetHeader("Content-Type")
-	mediaType, params, err := mime.ParseMediaType(ct)
-	if err != nil || !strings.HasPrefix(mediaType, "multipart/") {
-		c.String(http.StatusOK, "Invalid request")
-		return
-	}
-
-	const maxBody = int64(16 << 20) // 16MB
-	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBody)
-	defer c.Request.Body.Close()
-
-	mr := multipart.NewReader(c.Request.Body, params["boundary"])
-	t1 := time.Since(t0)
-
-	// ---------- Step 2: Separate Files ----------
-	var xmlBuf []byte
-	var lpImg []byte
-	var detectImg = []byte(nil)
-
-	parts := 0
-	const maxParts = 10
-
-	for {
-		part, err := mr.NextPart()
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			if ne, ok := err.(interface{ Timeout() bool }); ok && ne.Timeout() {
-				c.String(http.StatusRequestTimeout, "multipart read timeout")
-			} else {
-				c.String(http.StatusOK, "invalid multipart")
-			}
-			return
-		}
-
-		parts++
-		if parts > maxParts {
-			_ = part.Close()
-			c.String(http.StatusOK, "too many parts")
-			return
-		}
-
-		fn := part.FileName()
-		if fn == "" {
-			_, _ = io.Copy(io.Discard, part)
-			_ = part.Close()
-			continue
-		}
-
-		buf, _ := io.ReadAll(part)
-		_ = part.Close()
-
-		switch {
-		case strings.HasSuffix(strings.ToLower(fn), ".xml"):
-			xmlBuf = buf
-		case fn == "licensePlatePicture.jpg":
-			lpImg = buf
-		case fn == "detectedImage.jpg" || fn == "pedestrianDetectionPicture.jpg":
-			detectImg = buf
-		default:
-		}
-	}
-
-	if len(xmlBuf) == 0 {
-		c.String(http.StatusOK, "Missing XML file")
-		return
-	}
-	t2 := time.Since(t0) - t1
-
-	// ---------- Step 3: Parse XML ----------
-	var plate, uuid, timeIn, ip, vehicleType string
-	{
-		var ev eventXML
-		if err := xml.Unmarshal(xmlBuf, &ev); err == nil && strings.TrimSpace(ev.ANPR.LicensePlate) != "" {
-			plate = strings.TrimSpace(ev.ANPR.LicensePlate)
-			uuid = strings.TrimSpace(ev.UUID)
-			timeIn = strings.TrimSpace(ev.DateTime)
-			ip = strings.TrimSpace(ev.IPAddress)
-			vehicleType = strings.TrimSpace(ev.ANPR.VehicleType)
-		} else {
-			var ev2 eventXMLNoNS
-			if err2 := xml.Unmarshal(xmlBuf, &ev2); err2 == nil && strings.TrimSpace(ev2.ANPR.LicensePlate) != "" {
-				plate = strings.TrimSpace(ev2.ANPR.LicensePlate)
-				uuid = strings.TrimSpace(ev2.UUID)
-				timeIn = strings.TrimSpace(ev2.DateTime)
-				ip = strings.TrimSpace(ev2.IPAddress)
-				vehicleType = strings.TrimSpace(ev.ANPR.VehicleType)
-			}
-		}
-	}
-	if plate == "" {
-		c.String(http.StatusOK, "Failed to parse XML")
-		return
-	}
-	t3 := time.Since(t0) - t1 - t2
-
-	// ---------- Step 4: Call Reserve Exit API ----------
-	gateNo := c.Query("gate_no")
-	t4 := time.Since(t0) - t1 - t2 - t3
-
-	go h.postParkingLicensePlate(plate, ip, h.cfg.ParkingCode)
-	t5 := time.Since(t0) - t1 - t2 - t3 - t4
-
-	// NEW LOGIC START (Exit)
-	apiURL := fmt.Sprintf("%s/api/v1/reserve/exit-lpr", h.cfg.ServerURL)
-	body := map[string]any{
-		"license_plate": plate,
-		"parking_code":  h.cfg.ParkingCode,
-	}
-
-	var jsonRes map[string]any
-	isSuccess := false
-
-	b, _ := json.Marshal(body)
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, apiURL, bytes.NewReader(b))
-	req.Header.Set("Content-Type", "application/json")
-	resp, err := h.httpClient.Do(req)
-
 	if err != nil {
-		log.Printf("[VerifyReserveExit] API Request Error: %v", err)
-	} else {
+		log.Printf("[%s] API Request Error: %v", tag, err)
+		offline.Report(err)
+		ev.RecordCloud(http.MethodPost, apiURL, body, nil, 0, err, started)
+	} else if resp != nil {
 		defer resp.Body.Close()
 		respBody, _ := io.ReadAll(resp.Body)
-		log.Printf("[VerifyReserveExit] API Response Status: %d, Body: %s", resp.StatusCode, string(respBody))
+		log.Printf("[%s] API Response Status: %d, Body: %s", tag, resp.StatusCode, string(respBody))
 
-		// Try to parse json regardless of status code
-		_ = json.Unmarshal(respBody, &jsonRes)
+		// Try to parse json regardless of status code — 5xx / ไม่ใช่ JSON ถือว่า Cloud ใช้ไม่ได้
+		err = offline.ResponseError(resp.StatusCode, json.Unmarshal(respBody, &jsonRes))
+		offline.Report(err)
+		ev.RecordCloud(http.MethodPost, apiURL, body, respBody, resp.StatusCode, err, started)
 
-		if resp.StatusCode == 200 {
+		if err == nil && resp.StatusCode == 200 {
 			isSuccess = true
 		}
 	}
+	// Cloud ไม่ตอบ / ตอบใช้ไม่ได้ → ตัดสินจาก offline cache แล้วส่งผลให้ Cloud ทีหลัง
+	var od offline.Decision
+	if err != nil {
+		d := offline.Decide(direction, "RESE", gateNo, plate)
+		od = d
+		jsonRes, isSuccess = d.Response(plate), d.Allow
+		offline.Reconcile(h.cfg.ServerURL, h.cfg.ParkingCode, direction, "RESE", gateNo, plate, ev.UUID, d)
+	}
+	ev.Mark("Call API")
 
-	t6 := time.Since(t0) - t1 - t2 - t3 - t4 - t5
-
-	// 3. If 200 -> open barrier (EXT)
-	if isSuccess {
-		if err := barrier_v2.OpenReserveBarrierByGate("EXT", gateNo); err != nil {
-			log.Printf("[VerifyReserveExit] Open Barrier Error: %v", err)
+	// If 200 -> open barrier (ตารางเวลาประตูทับผลได้)
+	if mode.ShouldOpen(isSuccess, true) {
+		err := barrier_v2.OpenReserveBarrierByGate(direction, gateNo)
+		ev.RecordBarrier("open_reserve", err)
+		if err != nil {
+			log.Printf("[%s] Open Barrier Error: %v", tag, err)
 		} else {
-			log.Printf("[VerifyReserveExit] Barrier Opened for gate %s", gateNo)
+			log.Printf("[%s] Barrier Opened for gate %s", tag, gateNo)
+			od.MarkUsed()
+
+			// ขาออกเฝ้า loop เหมือนประตูหลัก (ผูกกับ uuid ของ Cloud ถ้ามี ไม่งั้น uuid ของ event จากกล้อง)
+			if direction == "EXT" && barrier_v2.PassageEnabled() {
+				var txUUID string
+				if data, ok := jsonRes["data"].(map[string]any); ok {
+					txUUID, _ = data["uuid"].(string)
+				}
+				if txUUID == "" {
+					txUUID = ev.UUID
+				}
+				go h.confirmPassage(ev.UUID, gateNo, barrier_v2.PassageRef{Plate: plate, UUID: txUUID}, time.Now())
+			}
 		}
 	}
 
-	if lpImg == nil {
-		lpImg = detectImg
+	vehicle := events.Vehicle{
+		LicensePlate:      plate,
+		UUID:              ev.UUID,
+		TimeIn:            ev.DateTime,
+		VehicleType:       utils.VehicleType(ev.VehicleType),
+		LicensePlateImage: base64.StdEncoding.EncodeToString(ev.Image()),
+		ANPR:              ev.Metadata(),
 	}
-
 	payload := map[string]any{
-		"license_plate":            plate,
-		"uuid":                     uuid,
-		"time_in":                  timeIn,
-		"vehicle_type":             utils.VehicleType(vehicleType),
-		"license_plate_img_base64": base64.StdEncoding.EncodeToString(lpImg),
+		"license_plate":            vehicle.LicensePlate,
+		"uuid":                     vehicle.UUID,
+		"time_in":                  vehicle.TimeIn,
+		"vehicle_type":             vehicle.VehicleType,
+		"license_plate_img_base64": vehicle.LicensePlateImage,
+	}
+	if vehicle.ANPR != nil {
+		payload["anpr"] = vehicle.ANPR
 	}
 
 	respPayload := map[string]any{
@@ -441,79 +211,91 @@ func (h *Handler) VerifyReserveExit(c *gin.Context) {
 		"message": jsonRes["message"],
 		"data":    payload,
 	}
+	if mode != config.ModeNormal {
+		respPayload["gate_mode"] = mode
+	}
 
-	log.Printf("[VerifyReserveOut] payload: %v", respPayload)
+	log.Printf("[%s] payload: %v", tag, respPayload)
 
 	// Merge API response into payload for broadcast
 	for k, v := range jsonRes {
 		payload[k] = v
 	}
 
-	// 4. Broadcast to /reserve-out/:gate_no
-	room := "reserve_out_" + gateNo
-	h.broadcastJSON(room, respPayload)
-
-	t7 := time.Since(t0) - t1 - t2 - t3 - t4 - t5 - t6
+	// Broadcast to /reserve-in/:gate_no | /reserve-out/:gate_no
+	reserve := events.ReserveVerified{Vehicle: vehicle, Decision: events.FromCloud(jsonRes), Cloud: jsonRes}
+	if mode != config.ModeNormal {
+		reserve.GateMode = string(mode)
+	}
+	h.events.Publish(events.New(eventType, room, gateNo, direction, ev.RequestID, reserve), respPayload)
+	ev.Mark("Broadcast")
+}
 
-	h.logTimingsExit(c, t0, t1, t2, t3, t4, t5, t6, t7, plate)
-	c.String(http.StatusOK, "File(s) uploaded successfully")
+// unreadable broadcast plate.unreadable เข้าห้องของประตู (payload legacy แบบเดียวกับ zoning)
+func (h *Handler) unreadable(ev *anpr.PlateEvent, room, direction string) {
+	img := base64.StdEncoding.EncodeToString(ev.Image())
+	payload := map[string]any{
+		"status":  false,
+		"message": "cannot read license plate",
+		"data": map[string]any{
+			"license_plate":            ev.Plate,
+			"read_plate":               ev.RawPlate,
+			"license_plate_img_base64": img,
+		},
+	}
+	unreadable := events.PlateUnreadable{
+		Vehicle:   events.Vehicle{LicensePlate: ev.Plate, UUID: ev.UUID, LicensePlateImage: img, ANPR: ev.Metadata()},
+		ReadPlate: ev.RawPlate,
+	}
+	h.events.Publish(events.New(events.TypePlateUnreadable, room, ev.GateNo, direction, ev.RequestID, unreadable), payload)
+	ev.Mark("Broadcast")
 }
 
 // ----------------- helpers -----------------
 
-func (h *Handler) postParkingLicensePlate(plate, ip, code string) {
+// confirmPassage รอผลจาก loop ของไม้กั้นจองขาออก แล้วแจ้งทั้ง Cloud และห้อง reserve_out_<gate> (key = uuid ของ event จากกล้อง)
+func (h *Handler) confirmPassage(key, gateNo string, ref barrier_v2.PassageRef, openedAt time.Time) {
+	ev := barrier_v2.WatchPassage("EXT", gateNo, "RESE", ref, openedAt)
+	log.Printf("[passage] reserve gate=%s plate=%s uuid=%s event=%s err=%s", gateNo, ev.Plate, ev.UUID, ev.Event, ev.Error)
+
+	payload := map[string]any{
+		"event":         ev.Event,
+		"license_plate": ev.Plate,
+		"uuid":          ev.UUID,
+		"gate":          "ext",
+		"location":      "reserve",
+		"opened_at":     ev.OpenedAt.Format(time.RFC3339),
+		"time_stamp":    ev.At.Format(time.RFC3339),
+		"auto_closed":   ev.AutoClosed,
+	}
+	if ev.Error != "" {
+		payload["error"] = ev.Error
+	}
+	passage := events.VehiclePassage{
+		Event:        ev.Event,
+		LicensePlate: ev.Plate,
+		UUID:         ev.UUID,
+		OpenedAt:     ev.OpenedAt.Format(time.RFC3339),
+		AutoClosed:   ev.AutoClosed,
+		Error:        ev.Error,
+	}
+	h.events.Publish(events.New(events.TypeVehiclePassage, "reserve_out_"+gateNo, gateNo, "EXT", "", passage), payload)
+
+	payload["park_code"] = h.cfg.ParkingCode
+	url := fmt.Sprintf("%s/api/v1-202402/order/vehicle-passage", h.cfg.ServerURL)
+	outbox.Post(key, "vehicle_passage", url, payload)
+}
+
+// postParkingLicensePlate key = uuid ของ event จากกล้อง (ทุกงาน outbox ของรถคันนี้ใช้ key เดียวกัน → ส่งตามลำดับ)
+func (h *Handler) postParkingLicensePlate(key, plate, ip, code string, meta *events.PlateMeta) {
 	url := fmt.Sprintf("%s/api/v1-202402/order/parking_license_plate", h.cfg.ServerURL)
 	body := map[string]any{
 		"license_plate": plate,
 		"ip_address":    ip,
 		"parking_code":  code,
 	}
-	if _, err := h.postJSON(url, body); err != nil {
-		log.Println("Background task error:", err)
+	if meta != nil {
+		body["anpr"] = meta
 	}
-}
-
-func (h *Handler) postJSON(url string, body map[string]any) (map[string]any, error) {
-	b, _ := json.Marshal(body)
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(b))
-	req.Header.Set("Content-Type", "application/json")
-	resp, err := h.httpClient.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-	out := map[string]any{}
-	_ = json.NewDecoder(resp.Body).Decode(&out)
-	return out, nil
-}
-
-func (h *Handler) broadcastJSON(room string, payload map[string]any) {
-	b, _ := json.Marshal(payload)
-	h.hub.Broadcast(room, b)
-}
-
-func (h *Handler) logTimingsEntrance(c *gin.Context, t0 time.Time, t1, t2, t3, t4, t5, t6, t7 time.Duration, plate string) {
-	log.Printf("[RESERVE IN %s: LICENSE PLATE: %s]", c.Query("gate_no"), plate)
-	log.Printf(" - Parse Multipart:  %.2fs", t1.Seconds())
-	log.Printf(" - Split Files:      %.2fs", t2.Seconds())
-	log.Printf(" - Parse XML:        %.2fs", t3.Seconds())
-	log.Printf(" - De-dup:           %.2fs", t4.Seconds())
-	log.Printf(" - plpPost:          %.2fs", t5.Seconds())
-	log.Printf(" - Call API:         %.2fs", t6.Seconds())
-	log.Printf(" - Broadcast:        %.2fs", t7.Seconds())
-	log.Printf(" - Total Time:       %.2fs", time.Since(t0).Seconds())
-}
-
-func (h *Handler) logTimingsExit(c *gin.Context, t0 time.Time, t1, t2, t3, t4, t5, t6, t7 time.Duration, plate string) {
-	log.Printf("[RESERVE OUT %s: LICENSE PLATE: %s]", c.Query("gate_no"), plate)
-	log.Printf(" - Parse Multipart:  %.2fs", t1.Seconds())
-	log.Printf(" - Split Files:      %.2fs", t2.Seconds())
-	log.Printf(" - Parse XML:        %.2fs", t3.Seconds())
-	log.Printf(" - De-dup:           %.2fs", t4.Seconds())
-	log.Printf(" - plpPost:          %.2fs", t5.Seconds())
-	log.Printf(" - Call API:         %.2fs", t6.Seconds())
-	log.Printf(" - Broadcast:        %.2fs", t7.Seconds())
-	log.Printf(" - Total Time:       %.2fs", time.Since(t0).Seconds())
+	outbox.Post(key, "parking_license_plate", url, body)
 }
@@ -7,27 +7,67 @@ import (
 
 type Deduper struct {
 	mu   sync.Mutex
-	data map[string]time.Time
+	data map[string]dedupEntry
 	ttl  time.Duration
 }
 
+type dedupEntry struct {
+	first time.Time
+	exp   time.Time
+}
+
+// NewDeduper สร้าง deduper พร้อม janitor ลบ key ที่หมดอายุทุก ttl (อย่างน้อย 10 วิ)
 func NewDeduper(ttl time.Duration) *Deduper {
-	return &Deduper{
-		data: make(map[string]time.Time),
+	d := &Deduper{
+		data: make(map[string]dedupEntry),
 		ttl:  ttl,
 	}
+	go d.janitor()
+	return d
 }
 
 func (d *Deduper) Hit(key string) bool {
+	_, dup := d.Seen(key, d.ttl)
+	return dup
+}
+
+// Seen เหมือน Hit แต่กำหนด ttl ได้ต่อ key และคืนเวลาที่เห็นครั้งแรก (เมื่อซ้ำ)
+func (d *Deduper) Seen(key string, ttl time.Duration) (time.Time, bool) {
 	d.mu.Lock()
 	defer d.mu.Unlock()
 
 	now := time.Now()
-	if exp, ok := d.data[key]; ok && exp.After(now) {
+	if e, ok := d.data[key]; ok && e.exp.After(now) {
 		// เคยมีอยู่และยังไม่หมดอายุ → ถือว่าซ้ำ
-		return true
+		return e.first, true
 	}
 	// set ใหม่
-	d.data[key] = now.Add(d.ttl)
-	return false
+	d.data[key] = dedupEntry{first: now, exp: now.Add(ttl)}
+	return now, false
+}
+
+// Forget ลบ key ทิ้ง — ครั้งถัดไปที่เห็นไม่นับว่าซ้ำ
+func (d *Deduper) Forget(key string) {
+	d.mu.Lock()
+	delete(d.data, key)
+	d.mu.Unlock()
+}
+
+func (d *Deduper) janitor() {
+	every := d.ttl
+	if every < 10*time.Second {
+		every = 10 * time.Second
+	}
+	t := time.NewTicker(every)
+	defer t.Stop()
+	for range t.C {
+		now := time.Now()
+		d.mu.Lock()
+		for k, e := range d.data {
+			if !e.exp.After(now) {
+				delete(d.data, k)
+			}
+		}
+		d.mu.Unlock()
+	}
 }
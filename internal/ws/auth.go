@@ -0,0 +1,236 @@
+package ws
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ---------- Client authentication ----------
+//
+// ENV:
+//   WS_TOKENS="kiosk-out-1=abc123:gate_out_1,gate_in_1|snapshot_request,clear_led; control=xyz:*|*"
+//     name=token:room,room,...|permission,...  (room ใช้ pattern แบบ path.Match ได้ เช่น gate_out_*, exit:ZN01:*)
+//     permission = ชนิดคำสั่ง inbound (open_barrier, close_barrier, plate_correction, snapshot_request, clear_led) หรือ *
+//     ไม่ตั้งเลย → ปฏิเสธทุก client (เหมือน ADMIN_TOKEN / ANPR_WEBHOOK_TOKEN)
+//   WS_ALLOW_ANONYMOUS=true
+//     ใช้คู่กับไม่ตั้ง WS_TOKENS เท่านั้น → เปิดแบบไม่ตรวจ token ทุกห้อง (พฤติกรรมเดิม) และใช้สิทธิ์จาก WS_ANON_PERMS (default: ไม่มี)
+//   WS_ALLOWED_ORIGINS="http://10.10.22.5:3000,https://pms.example.com"
+//     ไม่ตั้ง/"*" → ไม่เช็ค origin, ไม่มี header Origin (แอป Android) → ผ่าน
+//
+// token ส่งมาได้ทาง ?token=..., header X-Device-Token หรือ Authorization: Bearer ...
+
+var (
+	ErrMissingToken = errors.New("missing token")
+	ErrInvalidToken = errors.New("invalid token")
+	ErrRoomDenied   = errors.New("token not allowed for room")
+	ErrAuthDisabled = errors.New("websocket disabled (WS_TOKENS not set)")
+)
+
+const maxRejections = 200
+
+type Token struct {
+	Name        string
+	Value       string
+	Rooms       []string
+	Permissions []string
+}
+
+// Can เช็คสิทธิ์สั่งงานผ่าน WebSocket (ack ทำได้เสมอ)
+func (t *Token) Can(action string) bool {
+	if action == TypeAck {
+		return true
+	}
+	for _, p := range t.Permissions {
+		if p == "*" || p == action {
+			return true
+		}
+	}
+	return false
+}
+
+// Allows เช็คว่า token นี้เข้าห้องนี้ได้ไหม
+func (t *Token) Allows(room string) bool {
+	for _, p := range t.Rooms {
+		if p == "*" || p == room {
+			return true
+		}
+		if ok, _ := path.Match(p, room); ok {
+			return true
+		}
+	}
+	return false
+}
+
+type Rejection struct {
+	At         time.Time `json:"at"`
+	RemoteAddr string    `json:"remote_addr"`
+	Origin     string    `json:"origin"`
+	Room       string    `json:"room"`
+	Token      string    `json:"token"` // ชื่อ token (ถ้ารู้) — ไม่เก็บค่า token
+	Reason     string    `json:"reason"`
+}
+
+type Authenticator struct {
+	tokens    map[string]*Token // key = ค่า token
+	origins   map[string]bool   // ว่าง = ไม่เช็ค
+	anonymous bool              // WS_ALLOW_ANONYMOUS (มีผลเมื่อไม่ตั้ง WS_TOKENS)
+	anonPerms []string
+
+	mu         sync.Mutex
+	rejections []Rejection
+}
+
+func NewAuthenticatorFromEnv() *Authenticator {
+	a := &Authenticator{
+		tokens:  parseTokens(os.Getenv("WS_TOKENS")),
+		origins: map[string]bool{},
+	}
+	a.anonPerms = splitList(os.Getenv("WS_ANON_PERMS"))
+	switch strings.ToLower(strings.TrimSpace(os.Getenv("WS_ALLOW_ANONYMOUS"))) {
+	case "1", "true", "yes":
+		a.anonymous = true
+	}
+	for _, o := range strings.Split(os.Getenv("WS_ALLOWED_ORIGINS"), ",") {
+		o = strings.TrimRight(strings.TrimSpace(o), "/")
+		if o != "" && o != "*" {
+			a.origins[strings.ToLower(o)] = true
+		}
+	}
+	switch {
+	case len(a.tokens) > 0:
+	case a.anonymous:
+		log.Println("[WS] !!! WARNING: WS_TOKENS not set and WS_ALLOW_ANONYMOUS=true — every websocket/SSE client can join every room !!!")
+	default:
+		log.Println("[WS] WS_TOKENS not set — websocket/SSE clients are refused (set WS_TOKENS, or WS_ALLOW_ANONYMOUS=true for open rooms)")
+	}
+	return a
+}
+
+func parseTokens(spec string) map[string]*Token {
+	out := map[string]*Token{}
+	for _, raw := range strings.Split(spec, ";") {
+		raw = strings.TrimSpace(raw)
+		if raw == "" {
+			continue
+		}
+		name, rest, ok := strings.Cut(raw, "=")
+		if !ok {
+			log.Printf("[WS] invalid WS_TOKENS entry %q (want name=token:rooms)", raw)
+			continue
+		}
+		value, rest, _ := strings.Cut(rest, ":")
+		rooms, perms, _ := strings.Cut(rest, "|")
+		t := &Token{
+			Name:        strings.TrimSpace(name),
+			Value:       strings.TrimSpace(value),
+			Rooms:       splitList(rooms),
+			Permissions: splitList(perms),
+		}
+		if t.Value == "" {
+			continue
+		}
+		out[t.Value] = t
+	}
+	return out
+}
+
+func splitList(s string) []string {
+	var out []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// Enabled true ถ้าตั้ง WS_TOKENS ไว้
+func (a *Authenticator) Enabled() bool {
+	return len(a.tokens) > 0
+}
+
+// CheckOrigin ใช้เป็น websocket.Upgrader.CheckOrigin
+func (a *Authenticator) CheckOrigin(r *http.Request) bool {
+	origin := strings.TrimRight(r.Header.Get("Origin"), "/")
+	if origin == "" || len(a.origins) == 0 || a.origins[strings.ToLower(origin)] {
+		return true
+	}
+	a.Reject(r, "", "", "origin not allowed")
+	return false
+}
+
+// TokenFromRequest ดึง token จาก query / header
+func TokenFromRequest(r *http.Request) string {
+	if t := r.URL.Query().Get("token"); t != "" {
+		return t
+	}
+	if t := r.Header.Get("X-Device-Token"); t != "" {
+		return t
+	}
+	if h := r.Header.Get("Authorization"); strings.HasPrefix(h, "Bearer ") {
+		return strings.TrimSpace(strings.TrimPrefix(h, "Bearer "))
+	}
+	return ""
+}
+
+// Authenticate ตรวจ token ของ request กับห้องที่จะเข้า
+// ไม่ตั้ง WS_TOKENS → ErrAuthDisabled ยกเว้น WS_ALLOW_ANONYMOUS=true คืน token "anonymous" ที่เข้าได้ทุกห้อง
+func (a *Authenticator) Authenticate(r *http.Request, room string) (*Token, error) {
+	if !a.Enabled() {
+		if !a.anonymous {
+			a.Reject(r, room, "", ErrAuthDisabled.Error())
+			return nil, ErrAuthDisabled
+		}
+		return &Token{Name: "anonymous", Rooms: []string{"*"}, Permissions: a.anonPerms}, nil
+	}
+
+	raw := TokenFromRequest(r)
+	if raw == "" {
+		a.Reject(r, room, "", ErrMissingToken.Error())
+		return nil, ErrMissingToken
+	}
+	t, ok := a.tokens[raw]
+	if !ok {
+		a.Reject(r, room, "", ErrInvalidToken.Error())
+		return nil, ErrInvalidToken
+	}
+	if room != "" && !t.Allows(room) {
+		a.Reject(r, room, t.Name, ErrRoomDenied.Error())
+		return nil, ErrRoomDenied
+	}
+	return t, nil
+}
+
+// Reject บันทึก rejection ลง log + ring buffer
+func (a *Authenticator) Reject(r *http.Request, room, tokenName, reason string) {
+	rj := Rejection{
+		At:         time.Now(),
+		RemoteAddr: r.RemoteAddr,
+		Origin:     r.Header.Get("Origin"),
+		Room:       room,
+		Token:      tokenName,
+		Reason:     reason,
+	}
+	log.Printf("[WS][reject] remote=%s origin=%q room=%s token=%s reason=%s",
+		rj.RemoteAddr, rj.Origin, rj.Room, rj.Token, rj.Reason)
+
+	a.mu.Lock()
+	a.rejections = append(a.rejections, rj)
+	if len(a.rejections) > maxRejections {
+		a.rejections = a.rejections[len(a.rejections)-maxRejections:]
+	}
+	a.mu.Unlock()
+}
+
+// Rejections คืนรายการที่ถูกปฏิเสธล่าสุด (เก่า → ใหม่)
+func (a *Authenticator) Rejections() []Rejection {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append([]Rejection{}, a.rejections...)
+}
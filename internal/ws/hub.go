@@ -1,17 +1,95 @@
 package ws
 
 import (
+	"encoding/json"
 	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
 )
 
+// ---------- Hub ----------
+//
+// loop ของ hub ไม่เขียน socket เอง: แต่ละ client มีคิวส่ง (WS_SEND_QUEUE) + writer goroutine ของตัวเอง
+// client ที่รับไม่ทัน (คิวเต็ม) จัดการตาม WS_SLOW_POLICY:
+//   disconnect (default) → ตัดทิ้ง ให้ client ต่อกลับด้วย ?since=<ack ล่าสุด>
+//   drop                 → ทิ้งข้อความนั้นเฉพาะ client นั้น (นับใน dropped)
+// Broadcast เข้าคิว WS_BROADCAST_QUEUE — เต็มจะรอได้ไม่เกิน WS_BROADCAST_TIMEOUT (default 500ms) แล้วจึงทิ้งพร้อม log
+// (ข้อความที่ทิ้งตรงนี้ยังไม่มี seq → client ที่ resume จะไม่เห็นช่องว่าง จึงรอก่อนทิ้ง)
+
+const (
+	SlowDisconnect = "disconnect"
+	SlowDrop       = "drop"
+)
+
 type Hub struct {
-	clients    map[string]map[*websocket.Conn]bool
+	clients    map[string]map[*Client]bool
 	broadcast  chan Message
 	register   chan Subscription
-	unregister chan Subscription
+	unregister chan *Client
+	ack        chan Ack
+	direct     chan Direct
+	watch      chan patternChange
+
+	// ต่อห้อง: seq ล่าสุด + buffer ข้อความ (ใช้ทั้ง replay และ resume ?since=seq)
+	seq         map[string]uint64
+	history     map[string][]storedMessage
+	bufferSize  int           // WS_RESUME_BUFFER
+	replayCount int           // WS_REPLAY_COUNT
+	replayTTL   time.Duration // WS_REPLAY_TTL
+
+	sendQueue        int           // WS_SEND_QUEUE
+	slowPolicy       string        // WS_SLOW_POLICY
+	broadcastTimeout time.Duration // WS_BROADCAST_TIMEOUT
+
+	pingInterval time.Duration // WS_PING_INTERVAL (0 = ไม่ ping)
+	pongTimeout  time.Duration // WS_PONG_TIMEOUT
+
+	// admin: ดูสถานะ / เตะ client (ทำใน loop ของ hub)
+	lastBroadcast map[string]time.Time
+	stats         chan chan Stats
+	kick          chan kickRequest
+	nextID        atomic.Uint64
+}
+
+// Client สมาชิกหนึ่งคนของห้อง
+type Client struct {
+	ID    string
+	Group string
+	Info  ClientInfo
+
+	connectedAt time.Time
+	lastPong    atomic.Int64 // unix nano
+	latency     atomic.Int64 // ns, pong ล่าสุด
+	avgLatency  atomic.Int64 // ns, EWMA
+
+	conn *websocket.Conn // nil = client ที่อ่านคิวเอง (SSE)
+	send chan Outbound
+	done chan struct{}
+	once sync.Once
+
+	lastAck  uint64            // แก้เฉพาะใน loop ของ hub
+	patterns []string          // supervisor: ห้องที่ติดตาม (แก้เฉพาะใน loop ของ hub)
+	allow    func(string) bool // supervisor: สิทธิ์ของ token ต่อห้อง
+	sent     atomic.Uint64
+	dropped  atomic.Uint64
+}
+
+// Outbound ข้อความหนึ่งรายการในคิวของ client (Seq = 0 คือข้อความเฉพาะตัว เช่น response/resync)
+type Outbound struct {
+	Seq  uint64
+	Data []byte
+}
+
+type storedMessage struct {
+	Seq  uint64
+	At   time.Time
+	Data []byte // JSON ที่ติด seq แล้ว
 }
 
 type Message struct {
@@ -19,80 +97,386 @@ type Message struct {
 	Data  []byte
 }
 
+// Subscription การเข้าห้อง — Since < 0 = ต่อใหม่ (replay ล่าสุด), Since >= 0 = resume ต่อจาก seq นั้น
 type Subscription struct {
-	Group string
-	Conn  *websocket.Conn
+	Client *Client
+	Since  int64
+}
+
+// Direct ข้อความถึง client คนเดียว (เช่น response ของคำสั่ง) — ไม่ติด seq ไม่เก็บ buffer
+type Direct struct {
+	Client *Client
+	Data   []byte
+}
+
+// Ack client ยืนยันว่าได้รับถึง seq แล้ว
+type Ack struct {
+	Client *Client
+	Seq    uint64
 }
 
 func NewHub() *Hub {
+	policy := strings.ToLower(strings.TrimSpace(os.Getenv("WS_SLOW_POLICY")))
+	if policy != SlowDrop {
+		policy = SlowDisconnect
+	}
 	return &Hub{
-		clients:    make(map[string]map[*websocket.Conn]bool),
-		broadcast:  make(chan Message),
+		clients:    make(map[string]map[*Client]bool),
+		broadcast:  make(chan Message, getenvInt("WS_BROADCAST_QUEUE", 1024)),
 		register:   make(chan Subscription),
-		unregister: make(chan Subscription),
+		unregister: make(chan *Client),
+		ack:        make(chan Ack),
+		direct:     make(chan Direct),
+		watch:      make(chan patternChange),
+
+		seq:         make(map[string]uint64),
+		history:     make(map[string][]storedMessage),
+		bufferSize:  getenvInt("WS_RESUME_BUFFER", 100),
+		replayCount: getenvInt("WS_REPLAY_COUNT", 1),
+		replayTTL:   getenvDuration("WS_REPLAY_TTL", 2*time.Minute),
+
+		sendQueue:        getenvInt("WS_SEND_QUEUE", 128),
+		slowPolicy:       policy,
+		broadcastTimeout: getenvDuration("WS_BROADCAST_TIMEOUT", 500*time.Millisecond),
+
+		pingInterval: getenvDuration("WS_PING_INTERVAL", 20*time.Second),
+		pongTimeout:  getenvDuration("WS_PONG_TIMEOUT", 50*time.Second),
+
+		lastBroadcast: make(map[string]time.Time),
+		stats:         make(chan chan Stats),
+		kick:          make(chan kickRequest),
 	}
 }
 
 func (h *Hub) Run() {
-	// กำหนด Timeout สำหรับการส่ง Data (ควรเท่ากับที่เราตั้งใน Handler)
-	const writeWait = 10 * time.Second
-
 	for {
 		select {
 		case s := <-h.register:
-			if _, ok := h.clients[s.Group]; !ok {
-				h.clients[s.Group] = make(map[*websocket.Conn]bool)
+			c := s.Client
+			if _, ok := h.clients[c.Group]; !ok {
+				h.clients[c.Group] = make(map[*Client]bool)
 			}
-			h.clients[s.Group][s.Conn] = true
-			log.Printf("[WS] client joined %s (Total: %d)", s.Group, len(h.clients[s.Group]))
-
-		case s := <-h.unregister:
-			if conns, ok := h.clients[s.Group]; ok {
-				if _, ok := conns[s.Conn]; ok {
-					delete(conns, s.Conn)
-					s.Conn.Close()
-					log.Printf("[WS] client left %s", s.Group)
-
-					// Optional: ถ้าในห้องไม่มีคนแล้ว ลบห้องทิ้งด้วยก็ได้เพื่อประหยัด Ram
-					if len(conns) == 0 {
-						delete(h.clients, s.Group)
-					}
-				}
+			h.clients[c.Group][c] = true
+			log.Printf("[WS] client joined %s (Total: %d)", c.Group, len(h.clients[c.Group]))
+			if s.Since >= 0 {
+				h.resume(c, uint64(s.Since))
+			} else {
+				h.replay(c)
 			}
 
+		case c := <-h.unregister:
+			h.remove(c)
+
+		case a := <-h.ack:
+			if h.clients[a.Client.Group][a.Client] && a.Seq > a.Client.lastAck {
+				a.Client.lastAck = a.Seq
+			}
+
+		case d := <-h.direct:
+			if h.clients[d.Client.Group][d.Client] {
+				h.enqueue(d.Client, Outbound{Data: d.Data})
+			}
+
+		case p := <-h.watch:
+			p.reply <- h.applyPatterns(p)
+
+		case reply := <-h.stats:
+			reply <- h.snapshot()
+
+		case k := <-h.kick:
+			k.reply <- h.kickClient(k.id)
+
 		case msg := <-h.broadcast:
-			if conns, ok := h.clients[msg.Group]; ok {
-				for c := range conns {
-					// 1. ตั้งเวลาตาย ถ้าส่งไม่ออกภายใน 10 วิ ให้ error เลย
-					c.SetWriteDeadline(time.Now().Add(writeWait))
-
-					// 2. ส่งข้อความ
-					err := c.WriteMessage(websocket.TextMessage, msg.Data)
-
-					// 3. ถ้าส่งไม่ผ่าน (เน็ตหลุด/Timeout) ให้ลบ Client นั้นทิ้งทันที
-					if err != nil {
-						log.Printf("[WS] write error: %v, removing client", err)
-						c.Close()
-						delete(conns, c)
-
-						if len(conns) == 0 {
-							delete(h.clients, msg.Group)
-						}
-					}
-				}
+			stored := h.remember(msg)
+			h.lastBroadcast[msg.Group] = stored.At
+			for c := range h.clients[msg.Group] {
+				h.enqueue(c, Outbound{Seq: stored.Seq, Data: stored.Data})
 			}
+			h.fanOut(msg.Group, stored)
 		}
 	}
 }
 
+// Broadcast ส่งข้อความเข้าห้อง — คิวของ hub เต็มจะรอไม่เกิน broadcastTimeout แล้วทิ้งข้อความ
 func (h *Hub) Broadcast(group string, data []byte) {
-	h.broadcast <- Message{Group: group, Data: data}
+	msg := Message{Group: group, Data: data}
+	select {
+	case h.broadcast <- msg:
+		return
+	default:
+	}
+
+	t := time.NewTimer(h.broadcastTimeout)
+	defer t.Stop()
+	select {
+	case h.broadcast <- msg:
+	case <-t.C:
+		log.Printf("[WS] broadcast queue full for %s, dropped message for %s", h.broadcastTimeout, group)
+	}
+}
+
+// Register เข้าห้องด้วย websocket แล้วเริ่ม writer goroutine
+func (h *Hub) Register(group string, conn *websocket.Conn, info ClientInfo) *Client {
+	return h.join(group, conn, -1, info)
+}
+
+// RegisterSince เข้าห้องแบบ resume: ส่งทุกข้อความที่ seq > since จาก buffer ก่อน
+func (h *Hub) RegisterSince(group string, conn *websocket.Conn, since uint64, info ClientInfo) *Client {
+	return h.join(group, conn, int64(since), info)
+}
+
+// Subscribe เข้าห้องโดยไม่มี websocket (เช่น SSE) — caller อ่านข้อความเองจาก Messages()
+// since < 0 = ต่อใหม่ (replay ล่าสุด), since >= 0 = resume ต่อจาก seq นั้น
+func (h *Hub) Subscribe(group string, since int64, info ClientInfo) *Client {
+	return h.join(group, nil, since, info)
+}
+
+func (h *Hub) join(group string, conn *websocket.Conn, since int64, info ClientInfo) *Client {
+	c := h.newClient(group, conn, info)
+	if conn != nil {
+		go h.writePump(c)
+	}
+	h.register <- Subscription{Client: c, Since: since}
+	return c
+}
+
+func (h *Hub) newClient(group string, conn *websocket.Conn, info ClientInfo) *Client {
+	// คิวต้องจุ buffer ของห้องได้ทั้งก้อน ไม่งั้น resume จะโดนตัดว่าเป็น slow client ตั้งแต่เริ่ม
+	size := h.sendQueue
+	if h.bufferSize+1 > size {
+		size = h.bufferSize + 1
+	}
+	return &Client{
+		ID:          "c" + strconv.FormatUint(h.nextID.Add(1), 10),
+		Group:       group,
+		Info:        info,
+		connectedAt: time.Now(),
+		conn:        conn,
+		send:        make(chan Outbound, size),
+		done:        make(chan struct{}),
+	}
+}
+
+func (h *Hub) Unregister(c *Client) {
+	h.unregister <- c
+}
+
+// Ack บันทึกว่า client ได้รับข้อความถึง seq แล้ว
+func (h *Hub) Ack(c *Client, seq uint64) {
+	h.ack <- Ack{Client: c, Seq: seq}
+}
+
+// Send ส่งข้อความถึง client คนเดียวผ่านคิวของ client นั้น
+func (h *Hub) Send(c *Client, data []byte) {
+	h.direct <- Direct{Client: c, Data: data}
+}
+
+// Messages คิวข้อความของ client ที่ Subscribe ไว้ (websocket client อย่าอ่านเอง)
+func (c *Client) Messages() <-chan Outbound {
+	return c.send
+}
+
+// Delivered นับว่าส่งถึง client แล้วหนึ่งข้อความ (สำหรับ client ที่อ่านคิวเอง)
+func (c *Client) Delivered() {
+	c.sent.Add(1)
+}
+
+// Done ปิดเมื่อ client ออกจากห้อง (ถูกตัดหรือ Unregister)
+func (c *Client) Done() <-chan struct{} {
+	return c.done
+}
+
+// enqueue ใส่ข้อความลงคิวของ client แบบไม่ block — คิวเต็มทำตาม WS_SLOW_POLICY
+func (h *Hub) enqueue(c *Client, m Outbound) bool {
+	select {
+	case c.send <- m:
+		return true
+	default:
+	}
+
+	c.dropped.Add(1)
+	if h.slowPolicy == SlowDrop {
+		log.Printf("[WS] slow client in %s, dropped seq=%d", c.Group, m.Seq)
+		return false
+	}
+	log.Printf("[WS] slow client in %s, disconnecting (last ack=%d)", c.Group, c.lastAck)
+	h.remove(c)
+	return false
 }
 
-func (h *Hub) Register(group string, conn *websocket.Conn) {
-	h.register <- Subscription{Group: group, Conn: conn}
+// remove เอา client ออกจากห้องแล้วสั่ง writer ให้ปิด connection
+func (h *Hub) remove(c *Client) {
+	conns, ok := h.clients[c.Group]
+	if !ok || !conns[c] {
+		return
+	}
+	delete(conns, c)
+	c.once.Do(func() { close(c.done) })
+	log.Printf("[WS] client left %s", c.Group)
+
+	// Optional: ถ้าในห้องไม่มีคนแล้ว ลบห้องทิ้งด้วยก็ได้เพื่อประหยัด Ram
+	if len(conns) == 0 {
+		delete(h.clients, c.Group)
+	}
+}
+
+// writePump เขียนข้อความจากคิวลง websocket — ช้า/ค้างได้โดยไม่กระทบห้องอื่น
+func (h *Hub) writePump(c *Client) {
+	// กำหนด Timeout สำหรับการส่ง Data (ควรเท่ากับที่เราตั้งใน Handler)
+	const writeWait = 10 * time.Second
+
+	// ping จาก server: ตรวจ client ที่หายไปเฉย ๆ (ไฟดับ/หลุด wifi) โดยไม่ต้องรอ read deadline
+	var pingC <-chan time.Time
+	if h.pingInterval > 0 {
+		ticker := time.NewTicker(h.pingInterval)
+		defer ticker.Stop()
+		pingC = ticker.C
+	}
+
+	defer c.conn.Close()
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-pingC:
+			if h.pongTimeout > 0 && time.Since(c.lastSeen()) > h.pongTimeout {
+				log.Printf("[WS] no pong from %s in %s for %s, removing client", c.ID, c.Group, time.Since(c.lastSeen()).Round(time.Second))
+				go h.Unregister(c)
+				return
+			}
+			if err := c.conn.WriteControl(websocket.PingMessage, pingPayload(), time.Now().Add(writeWait)); err != nil {
+				log.Printf("[WS] ping error: %v, removing client", err)
+				go h.Unregister(c)
+				return
+			}
+		case m := <-c.send:
+			// ถ้าส่งไม่ออกภายใน 10 วิ ให้ error แล้วออกจากห้อง
+			// client ต่อกลับมาด้วย ?since=<ack ล่าสุด> เพื่อรับส่วนที่หายไป
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.conn.WriteMessage(websocket.TextMessage, m.Data); err != nil {
+				log.Printf("[WS] write error: %v, removing client", err)
+				go h.Unregister(c)
+				return
+			}
+			c.sent.Add(1)
+		}
+	}
 }
 
-func (h *Hub) Unregister(group string, conn *websocket.Conn) {
-	h.unregister <- Subscription{Group: group, Conn: conn}
+// remember ติด seq ให้ข้อความ แล้วเก็บลง buffer ของห้อง
+func (h *Hub) remember(msg Message) storedMessage {
+	h.seq[msg.Group]++
+	seq := h.seq[msg.Group]
+
+	m := storedMessage{
+		Seq:  seq,
+		At:   time.Now(),
+		Data: withFields(msg.Data, map[string]any{"seq": seq}),
+	}
+
+	size := h.bufferSize
+	if h.replayCount > size {
+		size = h.replayCount
+	}
+	if size <= 0 {
+		return m
+	}
+	hist := append(h.history[msg.Group], m)
+	if len(hist) > size {
+		hist = hist[len(hist)-size:]
+	}
+	h.history[msg.Group] = hist
+	return m
+}
+
+// replay ส่งข้อความล่าสุดที่ยังไม่หมดอายุให้ client ที่เพิ่งเข้าห้อง (ติด "replayed": true)
+func (h *Hub) replay(c *Client) {
+	hist := h.history[c.Group]
+	if len(hist) > h.replayCount {
+		hist = hist[len(hist)-h.replayCount:]
+	}
+	if h.replayCount <= 0 {
+		hist = nil
+	}
+
+	cutoff := time.Now().Add(-h.replayTTL)
+	for _, m := range hist {
+		if m.At.Before(cutoff) {
+			continue
+		}
+		if !h.enqueue(c, Outbound{Seq: m.Seq, Data: withFields(m.Data, map[string]any{"replayed": true})}) {
+			return
+		}
+	}
+}
+
+// resume ส่งทุกข้อความที่ seq > since; ถ้า buffer ไม่ครอบคลุม (หลุดนานเกิน/server restart)
+// จะส่ง {"type":"resync"} ก่อนเพื่อให้ client รู้ว่ามีช่วงที่หายไป
+func (h *Hub) resume(c *Client, since uint64) {
+	hist := h.history[c.Group]
+	current := h.seq[c.Group]
+
+	var oldest uint64
+	if len(hist) > 0 {
+		oldest = hist[0].Seq
+	}
+	if since > current || (oldest > 0 && since+1 < oldest) || (len(hist) == 0 && since < current) {
+		notice, _ := json.Marshal(map[string]any{
+			"type":       "resync",
+			"room":       c.Group,
+			"since":      since,
+			"oldest_seq": oldest,
+			"seq":        current,
+		})
+		if !h.enqueue(c, Outbound{Data: notice}) {
+			return
+		}
+	}
+
+	for _, m := range hist {
+		if m.Seq <= since && since <= current {
+			continue
+		}
+		if !h.enqueue(c, Outbound{Seq: m.Seq, Data: withFields(m.Data, map[string]any{"replayed": true})}) {
+			return
+		}
+	}
+}
+
+// withFields เติม field ให้ JSON object (อย่างอื่นส่งตามเดิม)
+func withFields(data []byte, fields map[string]any) []byte {
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(data, &obj); err != nil || obj == nil {
+		return data
+	}
+	for k, v := range fields {
+		b, err := json.Marshal(v)
+		if err != nil {
+			continue
+		}
+		obj[k] = b
+	}
+	out, err := json.Marshal(obj)
+	if err != nil {
+		return data
+	}
+	return out
+}
+
+func getenvInt(k string, def int) int {
+	if v := os.Getenv(k); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			return n
+		}
+	}
+	return def
+}
+
+func getenvDuration(k string, def time.Duration) time.Duration {
+	if v := os.Getenv(k); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			return d
+		}
+	}
+	return def
 }
@@ -0,0 +1,107 @@
+package ws
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+)
+
+// testHub hub ที่ไม่ Run — เรียก remember/resume ตรง ๆ ได้ (buffer 3 ข้อความต่อห้อง)
+func testHub(t *testing.T) *Hub {
+	t.Helper()
+	t.Setenv("WS_RESUME_BUFFER", "3")
+	t.Setenv("WS_REPLAY_COUNT", "1")
+	return NewHub()
+}
+
+// drain อ่านคิวของ client จนหมด → seq ของแต่ละข้อความ (0 = resync) และว่ามี resync ไหม
+func drain(t *testing.T, c *Client) (seqs []uint64, resync bool) {
+	t.Helper()
+	for {
+		select {
+		case m := <-c.send:
+			var body struct {
+				Type string `json:"type"`
+				Seq  uint64 `json:"seq"`
+			}
+			if err := json.Unmarshal(m.Data, &body); err != nil {
+				t.Fatalf("bad message %s: %v", m.Data, err)
+			}
+			if body.Type == "resync" {
+				resync = true
+				continue
+			}
+			if body.Seq != m.Seq {
+				t.Errorf("payload seq %d != outbound seq %d", body.Seq, m.Seq)
+			}
+			seqs = append(seqs, m.Seq)
+		default:
+			return seqs, resync
+		}
+	}
+}
+
+func TestRemember(t *testing.T) {
+	h := testHub(t)
+	for range 5 {
+		h.remember(Message{Group: "gate_out_1", Data: []byte(`{"type":"x"}`)})
+	}
+	m := h.remember(Message{Group: "gate_in_1", Data: []byte(`{"type":"x"}`)})
+
+	if m.Seq != 1 {
+		t.Errorf("seq of first message in another room = %d, want 1", m.Seq)
+	}
+	if got := h.seq["gate_out_1"]; got != 5 {
+		t.Errorf("room seq = %d, want 5", got)
+	}
+	var seqs []uint64
+	for _, s := range h.history["gate_out_1"] {
+		seqs = append(seqs, s.Seq)
+	}
+	if want := []uint64{3, 4, 5}; !slices.Equal(seqs, want) {
+		t.Errorf("history = %v, want %v (trimmed to WS_RESUME_BUFFER)", seqs, want)
+	}
+
+	// ข้อความที่ไม่ใช่ JSON object ส่งตามเดิม
+	if m := h.remember(Message{Group: "raw", Data: []byte("hello")}); string(m.Data) != "hello" {
+		t.Errorf("non-JSON data = %q, want unchanged", m.Data)
+	}
+}
+
+func TestResume(t *testing.T) {
+	tests := []struct {
+		name       string
+		published  int // จำนวนข้อความในห้องก่อน resume (buffer เก็บ 3 ล่าสุด)
+		since      uint64
+		wantSeqs   []uint64
+		wantResync bool
+	}{
+		{"up to date", 5, 5, nil, false},
+		{"missed some", 5, 3, []uint64{4, 5}, false},
+		{"oldest buffered is next", 5, 2, []uint64{3, 4, 5}, false},
+		{"gap before buffer", 5, 1, []uint64{3, 4, 5}, true},
+		{"gap from zero", 5, 0, []uint64{3, 4, 5}, true},
+		{"since ahead of current (server restarted)", 5, 9, []uint64{3, 4, 5}, true},
+		{"since ahead of empty room", 0, 4, nil, true},
+		{"empty room from zero", 0, 0, nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := testHub(t)
+			for range tt.published {
+				h.remember(Message{Group: "gate_out_1", Data: []byte(`{"type":"x"}`)})
+			}
+			c := h.newClient("gate_out_1", nil, ClientInfo{})
+			h.clients["gate_out_1"] = map[*Client]bool{c: true}
+
+			h.resume(c, tt.since)
+			seqs, resync := drain(t, c)
+			if !slices.Equal(seqs, tt.wantSeqs) {
+				t.Errorf("resume(%d) sent seqs %v, want %v", tt.since, seqs, tt.wantSeqs)
+			}
+			if resync != tt.wantResync {
+				t.Errorf("resume(%d) resync = %v, want %v", tt.since, resync, tt.wantResync)
+			}
+		})
+	}
+}
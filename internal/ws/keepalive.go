@@ -0,0 +1,74 @@
+package ws
+
+import (
+	"strconv"
+	"time"
+)
+
+// ---------- Keepalive / connection quality ----------
+//
+// server ส่ง ping ทุก WS_PING_INTERVAL (payload = เวลาที่ส่ง) แล้ววัด latency จาก pong
+//   ไม่มี pong/ping จาก client นานเกิน 2×interval → stale (ยังไม่ตัด)
+//   นานเกิน WS_PONG_TIMEOUT → ถือว่าตาย ตัดทิ้งทันที (ไม่ต้องรอ read deadline)
+
+const (
+	QualityGood  = "good"  // latency < 200ms
+	QualityFair  = "fair"  // latency < 1s
+	QualityPoor  = "poor"  // latency >= 1s
+	QualityStale = "stale" // ไม่ตอบเกิน 2×ping interval
+)
+
+// Pong บันทึกว่า client ยังตอบอยู่ — appData คือ payload ของ pong ที่ตอบ ping ของ server
+// (ping จาก client เองส่ง "" มา: นับเป็น activity แต่ไม่คิด latency)
+func (c *Client) Pong(appData string) {
+	now := time.Now()
+	c.lastPong.Store(now.UnixNano())
+
+	sent, err := strconv.ParseInt(appData, 10, 64)
+	if err != nil || sent <= 0 {
+		return
+	}
+	rtt := now.UnixNano() - sent
+	if rtt < 0 {
+		return
+	}
+	c.latency.Store(rtt)
+	// ค่าเฉลี่ยแบบ EWMA (alpha 0.2) ให้ spike ครั้งเดียวไม่ทำให้ quality แกว่ง
+	if avg := c.avgLatency.Load(); avg > 0 {
+		c.avgLatency.Store(avg + (rtt-avg)/5)
+	} else {
+		c.avgLatency.Store(rtt)
+	}
+}
+
+// lastSeen เวลาที่ client ตอบล่าสุด (ยังไม่เคยตอบ = เวลาเชื่อมต่อ)
+func (c *Client) lastSeen() time.Time {
+	if ns := c.lastPong.Load(); ns > 0 {
+		return time.Unix(0, ns)
+	}
+	return c.connectedAt
+}
+
+// quality สรุปคุณภาพ connection ("" = client ที่ไม่มี ping เช่น SSE)
+func (h *Hub) quality(c *Client) (string, bool) {
+	if c.conn == nil || h.pingInterval <= 0 {
+		return "", false
+	}
+	if time.Since(c.lastSeen()) > 2*h.pingInterval {
+		return QualityStale, true
+	}
+	avg := time.Duration(c.avgLatency.Load())
+	switch {
+	case avg == 0 || avg < 200*time.Millisecond:
+		return QualityGood, false
+	case avg < time.Second:
+		return QualityFair, false
+	default:
+		return QualityPoor, false
+	}
+}
+
+// pingPayload เวลาที่ส่ง ping (unix nano) — client ต้องตอบ pong ด้วย payload เดิมตามกฎ WebSocket
+func pingPayload() []byte {
+	return []byte(strconv.FormatInt(time.Now().UnixNano(), 10))
+}
@@ -0,0 +1,73 @@
+package ws
+
+import "encoding/json"
+
+// ---------- Inbound messages (client → server) ----------
+//
+//   {"type":"ack","seq":42}                                       ยืนยันว่าได้รับข้อความถึง seq 42 แล้ว
+//   {"type":"open_barrier","request_id":"r1","reason":"..."}      เปิดไม้กั้นของห้องนี้
+//   {"type":"close_barrier","request_id":"r2"}                    ปิดไม้กั้นของห้องนี้
+//   {"type":"plate_correction","request_id":"r3","plate":"1กข1234","original_plate":"1กข1284","uuid":"..."}
+//   {"type":"snapshot_request","request_id":"r4"}                 ขอรูปป้ายล่าสุดจากกล้อง
+//   {"type":"clear_led","request_id":"r5"}                        ล้างจอ LED ของประตู
+//   {"type":"subscribe","request_id":"r6","rooms":["gate_out_*"]} (supervisor) เพิ่มห้อง/pattern ที่ติดตาม
+//   {"type":"unsubscribe","request_id":"r7","rooms":["gate_out_*"]}
+//
+// ทุกคำสั่ง (ยกเว้น ack) ได้ Response กลับหนึ่งข้อความ:
+//   {"type":"response","request_id":"r1","action":"open_barrier","ok":true,"message":"opened","data":{...}}
+
+const (
+	TypeAck             = "ack"
+	TypeOpenBarrier     = "open_barrier"
+	TypeCloseBarrier    = "close_barrier"
+	TypePlateCorrection = "plate_correction"
+	TypeSnapshotRequest = "snapshot_request"
+	TypeClearLED        = "clear_led"
+	TypeSubscribe       = "subscribe"
+	TypeUnsubscribe     = "unsubscribe"
+
+	TypeResponse = "response"
+)
+
+type Inbound struct {
+	Type      string `json:"type"`
+	Seq       uint64 `json:"seq,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+
+	Reason        string `json:"reason,omitempty"`
+	Plate         string `json:"plate,omitempty"`
+	OriginalPlate string `json:"original_plate,omitempty"`
+	UUID          string `json:"uuid,omitempty"`
+
+	Rooms []string `json:"rooms,omitempty"`
+}
+
+type Response struct {
+	Type      string `json:"type"`
+	RequestID string `json:"request_id,omitempty"`
+	Action    string `json:"action"`
+	OK        bool   `json:"ok"`
+	Message   string `json:"message"`
+	Data      any    `json:"data,omitempty"`
+}
+
+// ParseInbound แปลงข้อความจาก client (ไม่ใช่ JSON → ok=false)
+func ParseInbound(data []byte) (Inbound, bool) {
+	var in Inbound
+	if err := json.Unmarshal(data, &in); err != nil || in.Type == "" {
+		return Inbound{}, false
+	}
+	return in, true
+}
+
+// NewResponse สร้าง response ของคำสั่ง
+func NewResponse(in Inbound, ok bool, message string, data any) Response {
+	return Response{
+		Type:      TypeResponse,
+		RequestID: in.RequestID,
+		Action:    in.Type,
+		OK:        ok,
+		Message:   message,
+		Data:      data,
+	}
+}
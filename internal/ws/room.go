@@ -0,0 +1,46 @@
+package ws
+
+import "strings"
+
+// RoomInfo ข้อมูลประตูที่ได้จากชื่อห้อง
+//
+//	gate_in_1 / gate_out_1        → GATE
+//	reserve_in_1 / reserve_out_1  → RESE
+//	entrance:ZN01:1 / exit:ZN01:1 → ZONE
+type RoomInfo struct {
+	Room      string `json:"room"`
+	Kind      string `json:"kind"`      // gate_in | gate_out | reserve_in | reserve_out | entrance | exit
+	Direction string `json:"direction"` // ENT | EXT
+	Location  string `json:"location"`  // GATE | RESE | ZONE
+	Zoning    string `json:"zoning,omitempty"`
+	Gate      string `json:"gate"`
+}
+
+var roomPrefixes = []struct {
+	prefix, kind, direction, location string
+}{
+	{"gate_in_", "gate_in", "ENT", "GATE"},
+	{"gate_out_", "gate_out", "EXT", "GATE"},
+	{"reserve_in_", "reserve_in", "ENT", "RESE"},
+	{"reserve_out_", "reserve_out", "EXT", "RESE"},
+}
+
+// ParseRoom แยกชื่อห้องเป็นข้อมูลประตู
+func ParseRoom(room string) (RoomInfo, bool) {
+	for _, p := range roomPrefixes {
+		if gate, ok := strings.CutPrefix(room, p.prefix); ok && gate != "" {
+			return RoomInfo{Room: room, Kind: p.kind, Direction: p.direction, Location: p.location, Gate: gate}, true
+		}
+	}
+
+	parts := strings.Split(room, ":")
+	if len(parts) == 3 && parts[2] != "" {
+		switch parts[0] {
+		case "entrance":
+			return RoomInfo{Room: room, Kind: "entrance", Direction: "ENT", Location: "ZONE", Zoning: parts[1], Gate: parts[2]}, true
+		case "exit":
+			return RoomInfo{Room: room, Kind: "exit", Direction: "EXT", Location: "ZONE", Zoning: parts[1], Gate: parts[2]}, true
+		}
+	}
+	return RoomInfo{Room: room}, false
+}
@@ -0,0 +1,160 @@
+package ws
+
+import (
+	"net/http"
+	"sort"
+	"time"
+)
+
+// ---------- Introspection (admin) ----------
+
+// ClientInfo ข้อมูลของ connection ตอนเข้าห้อง
+type ClientInfo struct {
+	Kind       string `json:"kind"` // ws | sse | supervisor
+	RemoteAddr string `json:"remote_addr"`
+	UserAgent  string `json:"user_agent"`
+	Token      string `json:"token"` // ชื่อ token (ไม่ใช่ค่า)
+}
+
+// NewClientInfo ดึงข้อมูลจาก request + token ที่ผ่าน Authenticate แล้ว
+func NewClientInfo(kind string, r *http.Request, tok *Token) ClientInfo {
+	info := ClientInfo{
+		Kind:       kind,
+		RemoteAddr: r.RemoteAddr,
+		UserAgent:  r.UserAgent(),
+	}
+	if tok != nil {
+		info.Token = tok.Name
+	}
+	return info
+}
+
+type ClientStats struct {
+	ID string `json:"id"`
+	ClientInfo
+	ConnectedAt time.Time  `json:"connected_at"`
+	LastPong    *time.Time `json:"last_pong,omitempty"`
+	LatencyMs   float64    `json:"latency_ms,omitempty"`
+	AvgLatency  float64    `json:"avg_latency_ms,omitempty"`
+	Quality     string     `json:"quality,omitempty"` // good | fair | poor | stale
+	Stale       bool       `json:"stale"`
+	LastAck     uint64     `json:"last_ack"`
+	Sent        uint64     `json:"sent"`
+	Dropped     uint64     `json:"dropped"`
+	Queued      int        `json:"queued"`
+	Patterns    []string   `json:"patterns,omitempty"`
+}
+
+type RoomStats struct {
+	Room          string        `json:"room"`
+	Seq           uint64        `json:"seq"`
+	Buffered      int           `json:"buffered"`
+	LastBroadcast *time.Time    `json:"last_broadcast,omitempty"`
+	Clients       []ClientStats `json:"clients"`
+}
+
+type Stats struct {
+	At             time.Time   `json:"at"`
+	SlowPolicy     string      `json:"slow_policy"`
+	PingInterval   string      `json:"ping_interval"`
+	StaleClients   int         `json:"stale_clients"`
+	BroadcastQueue int         `json:"broadcast_queue"`
+	Rooms          []RoomStats `json:"rooms"`
+}
+
+type kickRequest struct {
+	id    string
+	reply chan bool
+}
+
+// Stats คืนสถานะทุกห้อง/ทุก client ณ ตอนนี้
+func (h *Hub) Stats() Stats {
+	reply := make(chan Stats, 1)
+	h.stats <- reply
+	return <-reply
+}
+
+// Kick ตัด client ตาม id — false ถ้าไม่เจอ
+func (h *Hub) Kick(id string) bool {
+	reply := make(chan bool, 1)
+	h.kick <- kickRequest{id: id, reply: reply}
+	return <-reply
+}
+
+func (h *Hub) kickClient(id string) bool {
+	for _, conns := range h.clients {
+		for c := range conns {
+			if c.ID == id {
+				h.remove(c)
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (h *Hub) snapshot() Stats {
+	rooms := map[string]*RoomStats{}
+	room := func(name string) *RoomStats {
+		r, ok := rooms[name]
+		if !ok {
+			r = &RoomStats{Room: name, Seq: h.seq[name], Buffered: len(h.history[name]), Clients: []ClientStats{}}
+			if t, ok := h.lastBroadcast[name]; ok {
+				r.LastBroadcast = &t
+			}
+			rooms[name] = r
+		}
+		return r
+	}
+
+	for name := range h.seq {
+		room(name)
+	}
+	for name, conns := range h.clients {
+		r := room(name)
+		for c := range conns {
+			st := c.stats()
+			st.Quality, st.Stale = h.quality(c)
+			r.Clients = append(r.Clients, st)
+		}
+		sort.Slice(r.Clients, func(i, j int) bool { return r.Clients[i].ConnectedAt.Before(r.Clients[j].ConnectedAt) })
+	}
+
+	out := Stats{
+		At:             time.Now(),
+		SlowPolicy:     h.slowPolicy,
+		PingInterval:   h.pingInterval.String(),
+		BroadcastQueue: len(h.broadcast),
+		Rooms:          make([]RoomStats, 0, len(rooms)),
+	}
+	for _, r := range rooms {
+		for _, c := range r.Clients {
+			if c.Stale {
+				out.StaleClients++
+			}
+		}
+		out.Rooms = append(out.Rooms, *r)
+	}
+	sort.Slice(out.Rooms, func(i, j int) bool { return out.Rooms[i].Room < out.Rooms[j].Room })
+	return out
+}
+
+func (c *Client) stats() ClientStats {
+	st := ClientStats{
+		ID:          c.ID,
+		ClientInfo:  c.Info,
+		ConnectedAt: c.connectedAt,
+		LastAck:     c.lastAck,
+		Sent:        c.sent.Load(),
+		Dropped:     c.dropped.Load(),
+		Queued:      len(c.send),
+		Patterns:    append([]string(nil), c.patterns...),
+	}
+	if ns := c.lastPong.Load(); ns > 0 {
+		t := time.Unix(0, ns)
+		st.LastPong = &t
+	}
+	st.LatencyMs = float64(c.latency.Load()) / float64(time.Millisecond)
+	st.AvgLatency = float64(c.avgLatency.Load()) / float64(time.Millisecond)
+	return st
+}
@@ -0,0 +1,139 @@
+package ws
+
+import (
+	"errors"
+	"path"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// ---------- Supervisor (หลายห้องต่อ connection) ----------
+//
+// จอห้องควบคุมติดตามได้หลายห้อง/pattern (path.Match) เช่น gate_out_*, exit:ZN01:*
+// ทุกข้อความติด "room" (และ "seq" ของห้องนั้น) — เปลี่ยนรายการห้องได้ระหว่างต่ออยู่
+// ห้องที่ token ไม่มีสิทธิ์จะไม่ถูกส่งถึงแม้ pattern จะตรง
+
+// SupervisorGroup กลุ่มของ client แบบ supervisor ใน hub
+const SupervisorGroup = "supervisor"
+
+var ErrBadPattern = errors.New("invalid room pattern")
+
+type patternChange struct {
+	client *Client
+	add    []string
+	remove []string
+	reply  chan []string
+}
+
+// Watch เข้าเป็น supervisor — allow คือสิทธิ์ของ token ต่อห้อง (nil = ทุกห้อง)
+func (h *Hub) Watch(conn *websocket.Conn, allow func(room string) bool, info ClientInfo) *Client {
+	c := h.newClient(SupervisorGroup, conn, info)
+	c.allow = allow
+	if conn != nil {
+		go h.writePump(c)
+	}
+	h.register <- Subscription{Client: c, Since: -1}
+	return c
+}
+
+// SetPatterns เพิ่ม/ลบ pattern ของ supervisor แล้วคืนรายการปัจจุบัน
+// ห้องที่เพิ่งตรง pattern ใหม่จะได้ข้อความล่าสุด (ตาม WS_REPLAY_COUNT/TTL) ทันที
+func (h *Hub) SetPatterns(c *Client, add, remove []string) ([]string, error) {
+	for _, p := range add {
+		if _, err := path.Match(p, ""); err != nil {
+			return nil, ErrBadPattern
+		}
+	}
+	reply := make(chan []string, 1)
+	h.watch <- patternChange{client: c, add: add, remove: remove, reply: reply}
+	return <-reply, nil
+}
+
+func (h *Hub) applyPatterns(p patternChange) []string {
+	c := p.client
+	if !h.clients[SupervisorGroup][c] {
+		return nil
+	}
+
+	before := c.patterns
+	var kept []string
+	for _, pat := range c.patterns {
+		if !contains(p.remove, pat) {
+			kept = append(kept, pat)
+		}
+	}
+	for _, pat := range p.add {
+		if !contains(kept, pat) {
+			kept = append(kept, pat)
+		}
+	}
+	c.patterns = kept
+
+	// ส่งข้อความล่าสุดของห้องที่เพิ่งเริ่มติดตาม
+	cutoff := time.Now().Add(-h.replayTTL)
+	for room, hist := range h.history {
+		if matchAny(before, room) || !h.watches(c, room) {
+			continue
+		}
+		if len(hist) > h.replayCount {
+			hist = hist[len(hist)-h.replayCount:]
+		}
+		if h.replayCount <= 0 {
+			continue
+		}
+		for _, m := range hist {
+			if m.At.Before(cutoff) {
+				continue
+			}
+			data := withFields(m.Data, map[string]any{"room": room, "replayed": true})
+			if !h.enqueue(c, Outbound{Data: data}) {
+				return append([]string(nil), kept...)
+			}
+		}
+	}
+	return append([]string(nil), kept...)
+}
+
+// fanOut ส่งข้อความของห้องให้ supervisor ที่ติดตามห้องนั้น
+func (h *Hub) fanOut(room string, m storedMessage) {
+	watchers := h.clients[SupervisorGroup]
+	if len(watchers) == 0 || room == SupervisorGroup {
+		return
+	}
+	var data []byte
+	for c := range watchers {
+		if !h.watches(c, room) {
+			continue
+		}
+		if data == nil {
+			data = withFields(m.Data, map[string]any{"room": room})
+		}
+		h.enqueue(c, Outbound{Data: data})
+	}
+}
+
+func (h *Hub) watches(c *Client, room string) bool {
+	return matchAny(c.patterns, room) && (c.allow == nil || c.allow(room))
+}
+
+func matchAny(patterns []string, room string) bool {
+	for _, p := range patterns {
+		if p == "*" || p == room {
+			return true
+		}
+		if ok, _ := path.Match(p, room); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
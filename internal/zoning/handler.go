@@ -1,25 +1,20 @@
-// ------------------------------------------------------------
-// XML models (ลองมี namespace ก่อน แล้วค่อย fallback no-NS)
-// โครงนี้ match กับ VerifyMember/VerifyLicensePlateOut เดิม
-// ------------------------------------------------------------
-
 package zoning
 
 import (
+	"GO_LANG_WORKSPACE/internal/anpr"
 	"GO_LANG_WORKSPACE/internal/barrier_v2"
 	"GO_LANG_WORKSPACE/internal/config"
+	"GO_LANG_WORKSPACE/internal/events"
+	"GO_LANG_WORKSPACE/internal/offline"
+	"GO_LANG_WORKSPACE/internal/outbox"
 	"GO_LANG_WORKSPACE/internal/utils"
 	"GO_LANG_WORKSPACE/internal/ws"
 	"bytes"
 	"context"
 	"encoding/base64"
 	"encoding/json"
-	"encoding/xml"
 	"fmt"
-	"io"
 	"log"
-	"mime"
-	"mime/multipart"
 	"net/http"
 	"net/url"
 	"os"
@@ -27,146 +22,31 @@ import (
 	"strconv"
 	"strings"
 	"time"
-
-	"github.com/gin-gonic/gin"
 )
 
 type Handler struct {
 	cfg        *config.Config
 	hub        *ws.Hub
+	events     *events.Publisher
 	httpClient *http.Client
-	deduper    *utils.Deduper
 }
 
 func NewHandler(cfg *config.Config, hub *ws.Hub) *Handler {
 	return &Handler{
-		cfg: cfg,
-		hub: hub,
+		cfg:    cfg,
+		hub:    hub,
+		events: events.NewPublisher(hub),
 		httpClient: &http.Client{
 			Timeout:   6 * time.Second,
 			Transport: config.NewHTTPTransport(),
 		},
-		deduper: utils.NewDeduper(30 * time.Second),
 	}
 }
 
-type eventXML struct {
-	XMLName   xml.Name `xml:"http://www.isapi.org/ver20/XMLSchema EventNotificationAlert"`
-	UUID      string   `xml:"UUID"`
-	DateTime  string   `xml:"dateTime"`
-	IPAddress string   `xml:"ipAddress"`
-
-	ANPR struct {
-		LicensePlate string `xml:"licensePlate"`
-		VehicleType  string `xml:"vehicleType"`
-	} `xml:"ANPR"`
-}
-
-type eventXMLNoNS struct {
-	UUID      string `xml:"UUID"`
-	DateTime  string `xml:"dateTime"`
-	IPAddress string `xml:"ipAddress"`
-
-	ANPR struct {
-		LicensePlate string `xml:"licensePlate"`
-		VehicleType  string `xml:"vehicleType"`
-	} `xml:"ANPR"`
-}
-
 // ------------------------------------------------------------
 // Helpers (ยึดสไตล์ไฟล์ order เดิม)
 // ------------------------------------------------------------
 
-func (h *Handler) parseMultipartExpectXML(c *gin.Context) (xmlBuf, lpImg, dtImg []byte, ok bool) {
-	ct := c.GetHeader("Content-Type")
-	mediaType, params, err := mime.ParseMediaType(ct)
-	if err != nil || !strings.HasPrefix(mediaType, "multipart/") {
-		c.String(http.StatusOK, "Invalid request")
-		return nil, nil, nil, false
-	}
-
-	// กัน body ใหญ่เกิน (เช่น กล้องส่งรูปบวม/ผิดพลาด) — ป้องกันค้างยาว
-	const maxBody = int64(16 << 20) // 16MB รวมทั้ง multipart
-	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBody)
-	defer c.Request.Body.Close()
-
-	mr := multipart.NewReader(c.Request.Body, params["boundary"])
-
-	parts := 0
-	const maxParts = 10 // กันลูปไม่รู้จบจาก input แปลก
-
-	for {
-		part, err := mr.NextPart()
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			// <-- เปลี่ยนจาก log แล้ว continue เป็น "ตอบกลับ + return" ทันที
-			if ne, ok := err.(interface{ Timeout() bool }); ok && ne.Timeout() {
-				c.String(http.StatusRequestTimeout, "multipart read timeout")
-			} else {
-				log.Println("[Parse Err]", err)
-				c.String(http.StatusOK, "invalid multipart")
-			}
-			return nil, nil, nil, false
-		}
-
-		parts++
-		if parts > maxParts {
-			_ = part.Close()
-			c.String(http.StatusOK, "too many parts")
-			return nil, nil, nil, false
-		}
-
-		fn := part.FileName()
-		if fn == "" {
-			_, _ = io.Copy(io.Discard, part)
-			_ = part.Close()
-			continue
-		}
-		buf, _ := io.ReadAll(part)
-		_ = part.Close()
-
-		switch {
-		case strings.HasSuffix(strings.ToLower(fn), ".xml"):
-			xmlBuf = buf
-		case fn == "licensePlatePicture.jpg":
-			lpImg = buf
-		case fn == "detectedImage.jpg" || fn == "pedestrianDetectionPicture.jpg":
-			dtImg = buf
-		}
-	}
-	if len(xmlBuf) == 0 {
-		c.String(http.StatusOK, "Missing XML file")
-		return nil, nil, nil, false
-	}
-	return xmlBuf, lpImg, dtImg, true
-}
-
-func (h *Handler) parsePlateBundle(xmlBuf []byte) (plate, uuid, timeIn, ip, vehicleType string, ok bool) {
-	var ev eventXML
-	if err := xml.Unmarshal(xmlBuf, &ev); err == nil && strings.TrimSpace(ev.ANPR.LicensePlate) != "" {
-		return strings.TrimSpace(ev.ANPR.LicensePlate),
-			strings.TrimSpace(ev.UUID),
-			strings.TrimSpace(ev.DateTime),
-			strings.TrimSpace(ev.IPAddress),
-			strings.TrimSpace(ev.ANPR.VehicleType),
-			true
-	}
-
-	var ev2 eventXMLNoNS
-	if err2 := xml.Unmarshal(xmlBuf, &ev2); err2 == nil && strings.TrimSpace(ev2.ANPR.LicensePlate) != "" {
-		// NOTE: ยึดสไตล์เดิมของ VerifyMember (รักษา vehicleType ตาม struct แรกถ้าจะคง “ตรรกะเดิมเป๊ะๆ”)
-		return strings.TrimSpace(ev2.ANPR.LicensePlate),
-			strings.TrimSpace(ev2.UUID),
-			strings.TrimSpace(ev2.DateTime),
-			strings.TrimSpace(ev2.IPAddress),
-			strings.TrimSpace(ev2.ANPR.VehicleType),
-			true
-	}
-	return "", "", "", "", "", false
-}
-
 func (h *Handler) boolish(v any) bool {
 	switch x := v.(type) {
 	case bool:
@@ -192,38 +72,47 @@ func (h *Handler) getUUIDFromData(m map[string]any) string {
 }
 
 // ------------------------------------------------------------
-// ZoningEntrance: POST /api/v2-202402/zoning/entrance/:zoning_code?gate_no=1
+// Routes สำหรับ anpr pipeline
+//   POST /api/v2-202402/zoning/entrance/:zoning_code?gate_no=1                     → zoning_entrance
+//   POST /api/v2-202402/zoning/exit/:zoning_code?gate_no=1&next_zone=zn25050001   → zoning_exit
 // ------------------------------------------------------------
 
-func (h *Handler) ZoningEntrance(c *gin.Context) {
-	t0 := time.Now()
-
-	// Step 1: multipart
-	xmlBuf, lpImg, dtImg, ok := h.parseMultipartExpectXML(c)
-	if !ok {
-		return
+func (h *Handler) Routes() []anpr.Route {
+	return []anpr.Route{
+		{Name: "zoning_entrance", Label: "ZONING ENT", Direction: "ENT", Location: "ZONE", Decide: h.decideEntrance,
+			Room: func(ev *anpr.PlateEvent) string { return fmt.Sprintf("entrance:%s:%s", ev.Zoning, ev.GateNo) }},
+		{Name: "zoning_exit", Label: "ZONING EXT", Direction: "EXT", Location: "ZONE", Decide: h.decideExit,
+			Room: func(ev *anpr.PlateEvent) string { return fmt.Sprintf("exit:%s:%s", ev.Zoning, ev.GateNo) }},
 	}
-	t1 := time.Since(t0)
+}
 
-	// Step 2: parse XML
-	plate, _, _, ip, vehicleType, ok := h.parsePlateBundle(xmlBuf)
-	if !ok {
-		c.String(http.StatusOK, "Failed to parse XML")
-		return
-	}
-	t2 := time.Since(t0) - t1
+func (h *Handler) decideEntrance(ctx context.Context, ev *anpr.PlateEvent) error {
+	// ขาเข้า transition ไปยัง zone นี้เอง
+	return h.transition(ev, "ENT", ev.Zoning)
+}
 
-	// Step 3: Background save PLP
-	go h.postParkingLicensePlate(plate, ip, h.cfg.ParkingCode)
-	t3 := time.Since(t0) - t1 - t2
+func (h *Handler) decideExit(ctx context.Context, ev *anpr.PlateEvent) error {
+	// ขาออก transition ไปยัง next_zone ตาม Python
+	return h.transition(ev, "EXT", ev.Query.Get("next_zone"))
+}
 
-	// Step 4: หาก unknown → broadcast แบบ minimal แล้วจบ
-	gateNo := c.Query("gate_no")
-	zoningCode := c.Param("zoning_code")
-	// เดิม: room := "zoning_ent_" + zoningCode + "_" + gateNo
-	room := fmt.Sprintf("entrance:%s:%s", zoningCode, gateNo)
+// transition ขั้นตอนร่วมของ zoning ทั้งสองทิศ
+func (h *Handler) transition(ev *anpr.PlateEvent, direction, targetZone string) error {
+	plate, gateNo, zoningCode := ev.Plate, ev.GateNo, ev.Zoning
+	dir := strings.ToLower(direction) // ent | ext
+	lpImg, dtImg := ev.PlateImage, ev.SceneImage
 
-	if plate == "unknown" {
+	eventType, room := events.TypeZoningEntry, fmt.Sprintf("entrance:%s:%s", zoningCode, gateNo)
+	if direction == "EXT" {
+		eventType, room = events.TypeZoningExit, fmt.Sprintf("exit:%s:%s", zoningCode, gateNo)
+	}
+
+	// Background save PLP
+	h.postParkingLicensePlate(ev.UUID, plate, ev.CameraIP, h.cfg.ParkingCode, ev.Metadata())
+	ev.Mark("plpPost")
+
+	// หาก unknown → broadcast แบบ minimal แล้วจบ
+	if ev.Unknown() {
 		payload := map[string]any{
 			"status":  false,
 			"message": "cannot read license plate",
@@ -232,42 +121,77 @@ func (h *Handler) ZoningEntrance(c *gin.Context) {
 				"license_plate_img_base64": base64.StdEncoding.EncodeToString(dtImg),
 			},
 		}
-		h.broadcastJSON(room, payload)
+		unreadable := events.PlateUnreadable{
+			Vehicle:    events.Vehicle{LicensePlate: plate, LicensePlateImage: base64.StdEncoding.EncodeToString(dtImg), ANPR: ev.Metadata()},
+			ZoningCode: zoningCode,
+		}
+		if ev.LowConfidence {
+			unreadable.ReadPlate = ev.RawPlate
+			payload["data"].(map[string]any)["read_plate"] = ev.RawPlate
+		}
+		h.publish(ev.RequestID, events.TypePlateUnreadable, room, gateNo, direction, unreadable, payload)
 
 		// แสดง LED แม้ plate เป็น unknown
 		gateNoE, _ := strconv.Atoi(gateNo)
-		envKey := fmt.Sprintf("HIK_LED_ZONE_ENT_%02d", gateNoE)
+		envKey := fmt.Sprintf("HIK_LED_ZONE_%s_%02d", direction, gateNoE)
 		if value, ok := os.LookupEnv(envKey); ok && value != "" {
-			if disErr := utils.DisplayHexData(value, 9999, plate, "ent", "zone", fmt.Sprintf("%d THB", 0)); disErr != nil {
-				log.Printf("[LED][ENT][unknown] error: %v", disErr)
+			disErr := utils.DisplayHexData(value, 9999, plate, dir, "zone", fmt.Sprintf("%d THB", 0))
+			ev.RecordLED(value, plate+" 0 THB", disErr)
+			if disErr != nil {
+				log.Printf("[LED][%s][unknown] error: %v", direction, disErr)
 			}
 		}
+		return nil
+	}
 
-		h.logZoningTiming("ENT", zoningCode, gateNo, plate, t1, t2, t3, 0, 0, 0, 0, t0)
-		c.String(http.StatusOK, "File(s) uploaded successfully")
-		return
+	// ตารางเวลาประตู: closed / reservation-only ไม่ทำ transition
+	mode := config.GateModeAt(direction, "ZONE", gateNo, time.Now())
+	if mode == config.ModeClosed || mode == config.ModeReservationOnly {
+		closed := events.ZoningTransition{
+			Vehicle:    events.Vehicle{LicensePlate: plate, LicensePlateImage: base64.StdEncoding.EncodeToString(lpImg)},
+			Decision:   events.Decision{Message: mode.Message(), GateMode: string(mode)},
+			ZoningCode: zoningCode,
+		}
+		h.publish(ev.RequestID, eventType, room, gateNo, direction, closed, map[string]any{
+			"status":    false,
+			"message":   mode.Message(),
+			"gate_mode": mode,
+			"data": map[string]any{
+				"license_plate":            plate,
+				"license_plate_img_base64": base64.StdEncoding.EncodeToString(lpImg),
+			},
+		})
+		return nil
 	}
 
-	// Step 5: Call transition (zoning_code = zoningCode)
+	// Call transition
 	base, _ := url.Parse(h.cfg.ServerURL)
 	base.Path = path.Join(base.Path, "/api/v1-202402/zoning/transition")
 
 	reqBody := map[string]any{
 		"license_plate":   plate,
 		"parking_code":    h.cfg.ParkingCode,
-		"zoning_code":     zoningCode,
-		"vehicle_type_id": utils.VehicleType(vehicleType), // เหมือน VerifyMember (map → int)
+		"zoning_code":     targetZone,
+		"vehicle_type_id": utils.VehicleType(ev.VehicleType), // เหมือน gate_in (map → int)
 		"gate_id":         gateNo,
 	}
+	if meta := ev.Metadata(); meta != nil {
+		reqBody["anpr"] = meta
+	}
 	transitionURL := base.String()
 
-	resData, err := h.postJSON(transitionURL, reqBody)
+	started := time.Now()
+	resData, status, err := h.cloudJSON(transitionURL, reqBody)
+	ev.RecordCloud(http.MethodPost, transitionURL, reqBody, resData, status, err, started)
+	isOffline := err != nil
 	if err != nil {
-		log.Printf("[transition][ENT] error: %v", err)
-		c.String(http.StatusBadGateway, "transition failed")
-		return
+		log.Printf("[transition][%s] error: %v", direction, err)
+		// Cloud ไม่ตอบ → ตัดสินจาก offline cache แล้วส่งผลให้ Cloud ทีหลัง (free-flow ยังเปิดตามเดิม)
+		d := offline.Decide(direction, "ZONE", gateNo, plate)
+		resData = d.Response(plate)
+		offline.Reconcile(h.cfg.ServerURL, h.cfg.ParkingCode, direction, "ZONE", gateNo, plate, ev.UUID, d)
 	}
-	t4 := time.Since(t0) - t1 - t2 - t3
+	ev.Mark("Transition(" + dir + ")")
 
 	// เติม base64 รูปป้ายเข้า data
 	if resData != nil {
@@ -279,8 +203,9 @@ func (h *Handler) ZoningEntrance(c *gin.Context) {
 		}
 	}
 
-	// ถ้าสำเร็จ → BG collect-image + เปิดไม้กั้น zone
-	if resData != nil && h.boolish(resData["status"]) {
+	// ถ้าสำเร็จ → BG collect-image (payload ใช้ zoning_code เดิม + "gate":"ent" ทั้งสองทิศ ตาม Python)
+	// ตัดสินออฟไลน์ไม่มี uuid ของ transition → ไม่ส่งรูป
+	if !isOffline && resData != nil && h.boolish(resData["status"]) {
 		u := h.getUUIDFromData(resData)
 
 		collectBase, _ := url.Parse(h.cfg.ServerURL)
@@ -296,214 +221,48 @@ func (h *Handler) ZoningEntrance(c *gin.Context) {
 			"license_plate_img_base64": base64.StdEncoding.EncodeToString(lpImg),
 			"driver_img_base_64":       base64.StdEncoding.EncodeToString(dtImg),
 		}
-		go func() {
-			// PUT collect image
-			_, err := h.putJSON(collectURL, payload)
-			if err != nil {
-				log.Printf("[collect-image][ENT] err: %v", err)
-			}
-		}()
-
-		// เปิดไม้กั้น zone ทันที
-		if err := barrier_v2.OpenZoningByGate("ENT", gateNo); err != nil {
-			log.Printf("[barrier][ENT] failed to open zone barrier: %v", err)
-		} else {
-			log.Printf("[barrier][ENT] opened zone barrier for plate: %s", plate)
-		}
+		// PUT collect image ผ่าน outbox (เน็ตหลุดก็ส่งทีหลัง) — key เดียวกับ parking_license_plate ของ event นี้
+		outbox.Put(ev.UUID, "zoning_collect_image", collectURL, payload)
 	}
-	t5 := time.Since(t0) - t1 - t2 - t3 - t4
 
-	// Step 6: Broadcast
-	h.broadcastJSON(room, resData)
-	t6 := time.Since(t0) - t1 - t2 - t3 - t4 - t5
-
-	gateStr := c.Query("gate_no") // "01", "1", ...
-	gateNoE, err := strconv.Atoi(gateStr)
-	if err != nil {
-		// ถ้าอยาก safety หน่อย:
-		log.Printf("invalid gate_no %q: %v", gateStr, err)
-		c.String(http.StatusOK, "invalid gate_no")
-		return
-	}
-
-	// ENTRANCE
-	envKey := fmt.Sprintf("HIK_LED_ZONE_ENT_%02d", gateNoE)
-	// EXIT
-	// envKey := fmt.Sprintf("HIK_LED_ZONE_EXT_%02d", gateNo)
-
-	value, ok := os.LookupEnv(envKey) // ช่วยแยก "ไม่ได้ตั้ง" กับ "ตั้งแต่ค่าว่าง"
-	if !ok || value == "" {
-		log.Printf("Environment variable %s not found or empty", envKey)
-		// จะ return เลยหรือข้ามการแสดง LED ไปก็ได้ แล้วทำงานต่อส่วนอื่น
-		// return
-	}
-
-	// (Optional) แสดง LED
-	disErr := utils.DisplayHexData(
-		value,                    // screen_ip
-		9999,                     // screen_port
-		plate,                    // license_plate
-		"ent",                    // direction
-		"zone",                   // state_type
-		fmt.Sprintf("%d THB", 0), // line3
-	)
-	if disErr != nil {
-		fmt.Println("Error:", disErr)
-	} else {
-		fmt.Println("Packet sent successfully.")
-	}
-
-	// Log timing
-	h.logZoningTiming("ENT", zoningCode, gateNo, plate, t1, t2, t3, t4, t5, t6, 0, t0)
-
-	c.String(http.StatusOK, "File(s) uploaded successfully")
-}
-
-// ------------------------------------------------------------
-// ZoningExit: POST /api/v2-202402/zoning/exit/:zoning_code?gate_no=1&next_zone=zn25050001
-// ------------------------------------------------------------
-
-func (h *Handler) ZoningExit(c *gin.Context) {
-	t0 := time.Now()
-
-	// Step 1: multipart
-	xmlBuf, lpImg, dtImg, ok := h.parseMultipartExpectXML(c)
-	if !ok {
-		return
-	}
-	t1 := time.Since(t0)
-
-	// Step 2: parse XML
-	plate, _, _, ip, vehicleType, ok := h.parsePlateBundle(xmlBuf)
-	if !ok {
-		c.String(http.StatusOK, "Failed to parse XML")
-		return
-	}
-	t2 := time.Since(t0) - t1
-
-	// Step 3: BG save
-	go h.postParkingLicensePlate(plate, ip, h.cfg.ParkingCode)
-	t3 := time.Since(t0) - t1 - t2
-
-	gateNo := c.Query("gate_no")
-	zoningCode := c.Param("zoning_code")
-	nextZone := c.Query("next_zone")
-	// เดิม: room := "zoning_ext_" + zoningCode + "_" + gateNo
-	room := fmt.Sprintf("exit:%s:%s", zoningCode, gateNo)
-
-	// unknown
-	if plate == "unknown" {
-		payload := map[string]any{
-			"status":  false,
-			"message": "cannot read license plate",
-			"data": map[string]any{
-				"license_plate":            plate,
-				"license_plate_img_base64": base64.StdEncoding.EncodeToString(dtImg),
-			},
-		}
-		h.broadcastJSON(room, payload)
-
-		// แสดง LED แม้ plate เป็น unknown
-		gateNoE, _ := strconv.Atoi(gateNo)
-		envKey := fmt.Sprintf("HIK_LED_ZONE_EXT_%02d", gateNoE)
-		if value, ok := os.LookupEnv(envKey); ok && value != "" {
-			if disErr := utils.DisplayHexData(value, 9999, plate, "ext", "zone", fmt.Sprintf("%d THB", 0)); disErr != nil {
-				log.Printf("[LED][EXT][unknown] error: %v", disErr)
-			}
+	// เปิดไม้กั้น zone ทันที (free-flow เปิดแม้ transition ไม่ผ่าน)
+	if mode.ShouldOpen(resData != nil && h.boolish(resData["status"]), false) {
+		err := barrier_v2.OpenZoningByGate(direction, gateNo)
+		ev.RecordBarrier("open_zone", err)
+		if err != nil {
+			log.Printf("[barrier][%s] failed to open zone barrier: %v", direction, err)
+		} else {
+			log.Printf("[barrier][%s] opened zone barrier for plate: %s", direction, plate)
 		}
-
-		h.logZoningTiming("EXT", zoningCode, gateNo, plate, t1, t2, t3, 0, 0, 0, 0, t0)
-		c.String(http.StatusOK, "File(s) uploaded successfully")
-		return
 	}
+	ev.Mark("CollectImage BG")
 
-	// Step 4: transition (ใช้ zoning_code = next_zone ตาม Python)
-	base, _ := url.Parse(h.cfg.ServerURL)
-	base.Path = path.Join(base.Path, "/api/v1-202402/zoning/transition")
-
-	reqBody := map[string]any{
-		"license_plate":   plate,
-		"parking_code":    h.cfg.ParkingCode,
-		"zoning_code":     nextZone,
-		"vehicle_type_id": utils.VehicleType(vehicleType),
-		"gate_id":         gateNo,
+	// Broadcast
+	if resData != nil && mode != config.ModeNormal {
+		resData["gate_mode"] = mode
 	}
-	transitionURL := base.String()
-
-	resData, err := h.postJSON(transitionURL, reqBody)
-	if err != nil {
-		log.Printf("[transition][EXT] error: %v", err)
-		c.String(http.StatusBadGateway, "transition failed")
-		return
-	}
-	t4 := time.Since(t0) - t1 - t2 - t3
-
-	// เติมรูปป้ายเข้า data
-	if resData != nil {
-		if _, ok := resData["data"]; !ok {
-			resData["data"] = map[string]any{}
-		}
-		if dm, ok := resData["data"].(map[string]any); ok {
-			dm["license_plate_img_base64"] = base64.StdEncoding.EncodeToString(lpImg)
-		}
+	transition := events.ZoningTransition{
+		Vehicle:    events.Vehicle{LicensePlate: plate, UUID: h.getUUIDFromData(resData), LicensePlateImage: base64.StdEncoding.EncodeToString(lpImg), ANPR: ev.Metadata()},
+		Decision:   events.FromCloud(resData),
+		ZoningCode: zoningCode,
+		Cloud:      resData,
 	}
-
-	// ถ้า success → PUT collect-image (payload ใช้ zoning_code เดิม + "gate":"ent" ตาม Python) + เปิดไม้กั้น zone
-	if resData != nil && h.boolish(resData["status"]) {
-		u := h.getUUIDFromData(resData)
-
-		collectBase, _ := url.Parse(h.cfg.ServerURL)
-		collectBase.Path = path.Join(collectBase.Path, "/api/v1-202402/zoning/collect-image/", u)
-		collectURL := collectBase.String()
-
-		payload := map[string]any{
-			"license_plate":            plate,
-			"park_code":                h.cfg.ParkingCode,
-			"zoning_code":              zoningCode, // Python เดิมใช้ค่าตัวนี้ (ไม่ใช่ next_zone)
-			"time_stamp":               time.Now().Format(time.RFC3339),
-			"gate":                     "ent", // คงค่าตามต้นฉบับ
-			"license_plate_img_base64": base64.StdEncoding.EncodeToString(lpImg),
-			"driver_img_base_64":       base64.StdEncoding.EncodeToString(dtImg),
-		}
-		go func() {
-			_, err := h.putJSON(collectURL, payload)
-			if err != nil {
-				log.Printf("[collect-image][EXT] err: %v", err)
-			}
-		}()
-
-		// เปิดไม้กั้น zone ทันที
-		if err := barrier_v2.OpenZoningByGate("EXT", gateNo); err != nil {
-			log.Printf("[barrier][EXT] failed to open zone barrier: %v", err)
-		} else {
-			log.Printf("[barrier][EXT] opened zone barrier for plate: %s", plate)
-		}
+	if mode != config.ModeNormal {
+		transition.GateMode = string(mode)
 	}
-	t5 := time.Since(t0) - t1 - t2 - t3 - t4
-
-	// Step 5: broadcast
-	h.broadcastJSON(room, resData)
-	t6 := time.Since(t0) - t1 - t2 - t3 - t4 - t5
+	h.publish(ev.RequestID, eventType, room, gateNo, direction, transition, resData)
+	ev.Mark("Broadcast")
 
-	gateStr := c.Query("gate_no") // "01", "1", ...
-	gateNoE, err := strconv.Atoi(gateStr)
+	gateNoE, err := strconv.Atoi(gateNo) // "01", "1", ...
 	if err != nil {
-		// ถ้าอยาก safety หน่อย:
-		log.Printf("invalid gate_no %q: %v", gateStr, err)
-		c.String(http.StatusOK, "invalid gate_no")
-		return
+		log.Printf("invalid gate_no %q: %v", gateNo, err)
+		return anpr.Reject(http.StatusOK, "invalid gate_no")
 	}
 
-	// ENTRANCE
-	envKey := fmt.Sprintf("HIK_LED_ZONE_EXT_%02d", gateNoE)
-	// EXIT
-	// envKey := fmt.Sprintf("HIK_LED_ZONE_EXT_%02d", gateNo)
-
+	envKey := fmt.Sprintf("HIK_LED_ZONE_%s_%02d", direction, gateNoE)
 	value, ok := os.LookupEnv(envKey) // ช่วยแยก "ไม่ได้ตั้ง" กับ "ตั้งแต่ค่าว่าง"
 	if !ok || value == "" {
 		log.Printf("Environment variable %s not found or empty", envKey)
-		// จะ return เลยหรือข้ามการแสดง LED ไปก็ได้ แล้วทำงานต่อส่วนอื่น
-		// return
 	}
 
 	// (Optional) แสดง LED
@@ -511,84 +270,46 @@ func (h *Handler) ZoningExit(c *gin.Context) {
 		value,                    // screen_ip
 		9999,                     // screen_port
 		plate,                    // license_plate
-		"ext",                    // direction
+		dir,                      // direction
 		"zone",                   // state_type
 		fmt.Sprintf("%d THB", 0), // line3
 	)
+	ev.RecordLED(value, plate+" 0 THB", disErr)
 	if disErr != nil {
 		fmt.Println("Error:", disErr)
 	} else {
 		fmt.Println("Packet sent successfully.")
 	}
-
-	// Log timing
-	h.logZoningTiming("EXT", zoningCode, gateNo, plate, t1, t2, t3, t4, t5, t6, 0, t0)
-
-	c.String(http.StatusOK, "File(s) uploaded successfully")
-}
-
-// ------------------------------------------------------------
-// putJSON: เพิ่มเติมสำหรับ collect-image (pattern เดียวกับ post/get)
-// ------------------------------------------------------------
-
-func (h *Handler) putJSON(url string, body map[string]any) (map[string]any, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	b, _ := json.Marshal(body)
-	req, _ := http.NewRequestWithContext(ctx, http.MethodPut, url, strings.NewReader(string(b)))
-	req.Header.Set("Content-Type", "application/json")
-
-	resp, err := h.httpClient.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	out := map[string]any{}
-	_ = json.NewDecoder(resp.Body).Decode(&out)
-	return out, nil
-}
-
-// ------------------------------------------------------------
-// Logging ให้หน้าตาคล้ายของ order.*
-// ------------------------------------------------------------
-
-func (h *Handler) logZoningTiming(dir, zoning, gate, plate string,
-	t1, t2, t3, t4, t5, t6, t7 time.Duration, t0 time.Time) {
-
-	tag := "ZONING " + dir
-	log.Printf("[%s %s:%s, LICENSE PLATE: %s]", tag, zoning, gate, plate)
-	log.Printf(" - Parse Multipart:  %.2fs", t1.Seconds())
-	log.Printf(" - Parse XML:        %.2fs", t2.Seconds())
-	log.Printf(" - plpPost:          %.2fs", t3.Seconds())
-	if dir == "ENT" {
-		log.Printf(" - Transition(ent):  %.2fs", t4.Seconds())
-	} else {
-		log.Printf(" - Transition(ext):  %.2fs", t4.Seconds())
-	}
-	log.Printf(" - CollectImage BG:  %.2fs", t5.Seconds())
-	log.Printf(" - Broadcast:        %.2fs", t6.Seconds())
-	if t7 > 0 {
-		log.Printf(" - Extra:            %.2fs", t7.Seconds())
-	}
-	log.Printf(" - Total Time:       %.2fs", time.Since(t0).Seconds())
+	return nil
 }
 
 // ----------------- helpers -----------------
-func (h *Handler) postParkingLicensePlate(plate, ip, code string) {
+// postParkingLicensePlate key = uuid ของ event จากกล้อง (ทุกงาน outbox ของรถคันนี้ใช้ key เดียวกัน → ส่งตามลำดับ)
+func (h *Handler) postParkingLicensePlate(key, plate, ip, code string, meta *events.PlateMeta) {
 	url := fmt.Sprintf("%s/api/v1-202402/order/parking_license_plate", h.cfg.ServerURL)
 	body := map[string]any{
 		"license_plate": plate,
 		"ip_address":    ip,
 		"parking_code":  code,
 	}
-	if _, err := h.postJSON(url, body); err != nil {
-		log.Println("Background task error:", err)
+	if meta != nil {
+		body["anpr"] = meta
 	}
+	outbox.Post(key, "parking_license_plate", url, body)
 }
 
-func (h *Handler) postJSON(url string, body map[string]any) (map[string]any, error) {
+// cloudJSON postJSON ผ่าน circuit breaker — วงจรเปิดอยู่คืน offline.ErrOpen ทันทีไม่ต้องรอ timeout
+func (h *Handler) cloudJSON(url string, body map[string]any) (map[string]any, int, error) {
+	if !offline.Allow() {
+		return nil, 0, offline.ErrOpen
+	}
+	res, status, err := h.postJSON(url, body)
+	offline.Report(err)
+	return res, status, err
+}
+
+// postJSON คืน body ที่ decode แล้ว + HTTP status (0 = ต่อไม่ได้) สำหรับ journal
+func (h *Handler) postJSON(url string, body map[string]any) (map[string]any, int, error) {
 	b, _ := json.Marshal(body)
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
@@ -596,15 +317,17 @@ func (h *Handler) postJSON(url string, body map[string]any) (map[string]any, err
 	req.Header.Set("Content-Type", "application/json")
 	resp, err := h.httpClient.Do(req)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 	defer resp.Body.Close()
 	out := map[string]any{}
-	_ = json.NewDecoder(resp.Body).Decode(&out)
-	return out, nil
+	if err := offline.ResponseError(resp.StatusCode, json.NewDecoder(resp.Body).Decode(&out)); err != nil {
+		return nil, resp.StatusCode, err
+	}
+	return out, resp.StatusCode, nil
 }
 
-func (h *Handler) broadcastJSON(room string, payload map[string]any) {
-	b, _ := json.Marshal(payload)
-	h.hub.Broadcast(room, b)
+// publish ส่ง event เข้าห้อง zoning — ห้อง legacy ได้ payload รูปแบบเดิม
+func (h *Handler) publish(requestID, eventType, room, gateNo, direction string, payload any, legacy map[string]any) {
+	h.events.Publish(events.New(eventType, room, gateNo, direction, requestID, payload), legacy)
 }